@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+// analyzeReport is the output of the analyze command
+type analyzeReport struct {
+	Size              int64          `json:"size"`
+	Entropy           float64        `json:"entropy"`
+	AverageCodeLength float64        `json:"average_code_length"`
+	Efficiency        float64        `json:"efficiency"`
+	Headers           []headerReport `json:"headers"`
+	Codecs            []codecReport  `json:"codecs"`
+	Symbols           []symbolReport `json:"symbols"`
+}
+
+type headerReport struct {
+	Mode        string `json:"mode"`
+	HeaderSize  int64  `json:"header_size"`
+	PayloadSize int64  `json:"payload_size"`
+	TotalSize   int64  `json:"total_size"`
+}
+
+type codecReport struct {
+	Codec          string `json:"codec"`
+	CompressedSize int64  `json:"compressed_size"`
+}
+
+type symbolReport struct {
+	Byte        byte    `json:"byte"`
+	Symbol      string  `json:"symbol"`
+	Count       int     `json:"count"`
+	Probability float64 `json:"probability"`
+	Information float64 `json:"information"`
+	Code        string  `json:"code"`
+}
+
+var analyzeCmd = &cobra.Command{
+	Use:   "analyze",
+	Short: "Report the entropy of the input file and how well every codec compresses it",
+	Long: `Report the Shannon entropy of the input file, the average length and efficiency of its Huffman code, the exact encoded size with every header mode, the compressed size with every codec and the code of every byte, most frequent first. Entropy and code lengths are in bits per byte.
+
+Use --format json or csv for output other tools can read, and - as the input path to read from stdin.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		write, ok := map[string]func(io.Writer, *analyzeReport) error{
+			"text": writeAnalyzeText,
+			"json": writeAnalyzeJSON,
+			"csv":  writeAnalyzeCSV,
+		}[reportFormat]
+		if !ok {
+			log.Fatalf("Error: unknown format %q", reportFormat)
+		}
+
+		input, err := openInput(inputFile)
+		if err != nil {
+			log.Fatalf("Error opening input file: %v", err)
+		}
+		defer input.Close()
+
+		data, err := io.ReadAll(input)
+		if err != nil {
+			log.Fatalf("Error reading input file: %v", err)
+		}
+
+		analysis, err := huffman.Analyze(data, blockSize, maxCodeLength)
+		if err != nil {
+			log.Fatalf("Error analyzing input: %v", err)
+		}
+		report := &analyzeReport{
+			Size:              analysis.Size,
+			Entropy:           analysis.Entropy,
+			AverageCodeLength: analysis.AverageCodeLength,
+			Efficiency:        analysis.Efficiency,
+			Symbols:           []symbolReport{},
+		}
+		for _, size := range analysis.Modes {
+			report.Headers = append(report.Headers, headerReport{size.Mode.String(), size.Header, size.Payload, size.Total()})
+		}
+		for _, s := range analysis.Symbols {
+			report.Symbols = append(report.Symbols, symbolReport{s.Symbol, fmt.Sprintf("%q", s.Symbol), s.Count, s.Probability, s.Information, s.Code})
+		}
+
+		codecs := []huffman.Codec{huffman.CodecHuffman, huffman.CodecRange, huffman.CodecContext, huffman.CodecAdaptive, huffman.CodecLZH, huffman.CodecBWT}
+		for _, codec := range codecs {
+			compressed := &countingWriter{w: io.Discard}
+			zw, err := huffman.NewWriterOptions(compressed, huffman.WriterOptions{Codec: codec, BlockSize: blockSize, MaxCodeLength: maxCodeLength})
+			if err != nil {
+				log.Fatalf("Error creating encoder: %v", err)
+			}
+			if _, err := zw.Write(data); err != nil {
+				log.Fatalf("Error encoding input with %s: %v", codec, err)
+			}
+			if err := zw.Close(); err != nil {
+				log.Fatalf("Error encoding input with %s: %v", codec, err)
+			}
+			report.Codecs = append(report.Codecs, codecReport{codec.String(), compressed.n})
+		}
+
+		if err := write(os.Stdout, report); err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+	},
+}
+
+// ratio formats size as a percentage of original
+func ratio(size, original int64) string {
+	if original == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", float64(size)/float64(original)*100)
+}
+
+func writeAnalyzeText(out io.Writer, report *analyzeReport) error {
+	fmt.Fprintf(out, "Original size: %d bytes\n", report.Size)
+	fmt.Fprintf(out, "Entropy: %.4f bits per byte\n", report.Entropy)
+	fmt.Fprintf(out, "Average code length: %.4f bits per byte\n", report.AverageCodeLength)
+	fmt.Fprintf(out, "Efficiency: %.2f%%\n\n", report.Efficiency*100)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Header\tHeader size\tPayload size\tTotal\tRatio")
+	for _, h := range report.Headers {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", h.Mode, h.HeaderSize, h.PayloadSize, h.TotalSize, ratio(h.TotalSize, report.Size))
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Codec\tCompressed\tRatio\tGain over huffman")
+	base := report.Codecs[0].CompressedSize
+	for _, c := range report.Codecs {
+		gain := "-"
+		if c.Codec != huffman.CodecHuffman.String() {
+			gain = fmt.Sprintf("%d bytes (%.2f%%)", base-c.CompressedSize, float64(base-c.CompressedSize)/float64(base)*100)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", c.Codec, c.CompressedSize, ratio(c.CompressedSize, report.Size), gain)
+	}
+	w.Flush()
+	fmt.Fprintln(out)
+
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Symbol\tCount\tProbability\tInformation\tCode length\tCode")
+	for _, s := range report.Symbols {
+		fmt.Fprintf(w, "%s\t%d\t%.6f\t%.4f\t%d\t%s\n", s.Symbol, s.Count, s.Probability, s.Information, len(s.Code), s.Code)
+	}
+	return w.Flush()
+}
+
+func writeAnalyzeJSON(out io.Writer, report *analyzeReport) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// writeAnalyzeCSV writes the report as section,item,metric,value rows, one value per
+// row, so that every part of it fits the same four columns
+func writeAnalyzeCSV(out io.Writer, report *analyzeReport) error {
+	w := csv.NewWriter(out)
+	float := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	integer := func(v int64) string { return strconv.FormatInt(v, 10) }
+
+	rows := [][]string{
+		{"section", "item", "metric", "value"},
+		{"summary", "", "size", integer(report.Size)},
+		{"summary", "", "entropy", float(report.Entropy)},
+		{"summary", "", "average_code_length", float(report.AverageCodeLength)},
+		{"summary", "", "efficiency", float(report.Efficiency)},
+	}
+	for _, h := range report.Headers {
+		rows = append(rows,
+			[]string{"header", h.Mode, "header_size", integer(h.HeaderSize)},
+			[]string{"header", h.Mode, "payload_size", integer(h.PayloadSize)},
+			[]string{"header", h.Mode, "total_size", integer(h.TotalSize)},
+		)
+	}
+	for _, c := range report.Codecs {
+		rows = append(rows, []string{"codec", c.Codec, "compressed_size", integer(c.CompressedSize)})
+	}
+	for _, s := range report.Symbols {
+		item := strconv.Itoa(int(s.Byte))
+		rows = append(rows,
+			[]string{"symbol", item, "count", strconv.Itoa(s.Count)},
+			[]string{"symbol", item, "probability", float(s.Probability)},
+			[]string{"symbol", item, "information", float(s.Information)},
+			[]string{"symbol", item, "code", s.Code},
+		)
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return err
+	}
+	return w.Error()
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+var packCmd = &cobra.Command{
+	Use:   "pack path...",
+	Short: "Pack files and directories into an archive",
+	Long:  `Pack files and directories into an archive, compressing every file independently and keeping its mode and modification time. A directory is packed under its own name with everything below it. Use - as the output path to write to stdout.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		codec, err := huffman.ParseCodec(codecName)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		output, err := createOutput(outputFile)
+		if err != nil {
+			log.Fatalf("Error creating output file: %v", err)
+		}
+		defer output.Close()
+		// Don't pack the archive into itself when it's written inside a packed directory
+		outputInfo, _ := os.Stat(output.Name())
+
+		compressed := &countingWriter{w: output}
+		aw := huffman.NewArchiveWriter(compressed, huffman.WriterOptions{Codec: codec, Concurrency: workers})
+		files, size := 0, int64(0)
+		for _, root := range args {
+			root = filepath.Clean(root)
+			base := filepath.Dir(root)
+			err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				name, err := filepath.Rel(base, path)
+				if err != nil || name == "." {
+					return err
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				if outputInfo != nil && os.SameFile(info, outputInfo) {
+					return nil
+				}
+
+				entry := huffman.ArchiveEntry{Path: filepath.ToSlash(name), Mode: info.Mode(), ModTime: info.ModTime()}
+				switch {
+				case info.IsDir():
+					return aw.Add(entry, nil)
+				case info.Mode().IsRegular():
+					file, err := os.Open(path)
+					if err != nil {
+						return err
+					}
+					defer file.Close()
+					if err := aw.Add(entry, file); err != nil {
+						return fmt.Errorf("%s: %w", path, err)
+					}
+					files++
+					size += info.Size()
+				default:
+					fmt.Fprintf(os.Stderr, "Skipping %s: not a regular file or directory\n", path)
+				}
+				return nil
+			})
+			if err != nil {
+				log.Fatalf("Error packing %s: %v", root, err)
+			}
+		}
+		if err := aw.Close(); err != nil {
+			log.Fatalf("Error writing archive: %v", err)
+		}
+
+		status := statusWriter(outputFile)
+		fmt.Fprintf(status, "Packed %d files (%d bytes). Output written to %s\n", files, size, output.Name())
+		fmt.Fprintf(status, "Archive size: %d bytes\n", compressed.n)
+	},
+}
+
+var unpackCmd = &cobra.Command{
+	Use:   "unpack archive",
+	Short: "Unpack the files and directories of an archive",
+	Long:  `Unpack every file and directory of an archive below the destination directory, restoring their modes and modification times.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, ar, err := openArchive(args[0])
+		if err != nil {
+			log.Fatalf("Error opening archive: %v", err)
+		}
+		defer file.Close()
+
+		files := 0
+		for i, entry := range ar.Entries {
+			target := filepath.Join(destDir, filepath.FromSlash(entry.Path))
+			if entry.Mode.IsDir() {
+				if err := os.MkdirAll(target, 0o755); err != nil {
+					log.Fatalf("Error creating directory: %v", err)
+				}
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				log.Fatalf("Error creating directory: %v", err)
+			}
+			if err := unpackFile(ar, i, target); err != nil {
+				log.Fatalf("Error unpacking %s: %v", entry.Path, err)
+			}
+			files++
+		}
+
+		// Directories come last, deepest first: unpacking into a directory changes its
+		// modification time, and a read-only directory can't be unpacked into
+		for i := len(ar.Entries) - 1; i >= 0; i-- {
+			entry := ar.Entries[i]
+			if !entry.Mode.IsDir() {
+				continue
+			}
+			target := filepath.Join(destDir, filepath.FromSlash(entry.Path))
+			if err := os.Chmod(target, entry.Mode.Perm()); err != nil {
+				log.Fatalf("Error restoring %s: %v", entry.Path, err)
+			}
+			if err := os.Chtimes(target, entry.ModTime, entry.ModTime); err != nil {
+				log.Fatalf("Error restoring %s: %v", entry.Path, err)
+			}
+		}
+
+		fmt.Printf("Unpacked %d files into %s\n", files, destDir)
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list archive",
+	Short: "List the files and directories of an archive",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, ar, err := openArchive(args[0])
+		if err != nil {
+			log.Fatalf("Error opening archive: %v", err)
+		}
+		defer file.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Mode\tSize\tCompressed\tRatio\tModified\tPath")
+		var size, compressed int64
+		for _, entry := range ar.Entries {
+			ratio := "-"
+			if entry.Size > 0 {
+				ratio = fmt.Sprintf("%.2f%%", float64(entry.CompressedSize)/float64(entry.Size)*100)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", entry.Mode, entry.Size, entry.CompressedSize, ratio, entry.ModTime.Format("2006-01-02 15:04"), entry.Path)
+			size += entry.Size
+			compressed += entry.CompressedSize
+		}
+		w.Flush()
+		fmt.Printf("%d entries, %d bytes, %d bytes compressed\n", len(ar.Entries), size, compressed)
+	},
+}
+
+// openArchive opens the archive at path and reads its directory
+func openArchive(path string) (*os.File, *huffman.ArchiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	ar, err := huffman.NewArchiveReader(file, info.Size(), huffman.ReaderOptions{Concurrency: workers})
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, ar, nil
+}
+
+// unpackFile decompresses entry i of ar to target and restores its mode and
+// modification time
+func unpackFile(ar *huffman.ArchiveReader, i int, target string) error {
+	entry := ar.Entries[i]
+	zr, err := ar.Open(i)
+	if err != nil {
+		return err
+	}
+	output, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, entry.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(output, zr); err != nil {
+		output.Close()
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(target, entry.Mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
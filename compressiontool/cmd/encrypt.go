@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+// passphraseEnv is the environment variable read for a passphrase when neither
+// --key-file nor --passphrase-file is given
+const passphraseEnv = "HUFFMAN_PASSPHRASE"
+
+var encrypt bool
+var keyFile string
+var passphraseFile string
+
+// loadEncryption returns the key of --key-file or the passphrase of --passphrase-file
+// or $HUFFMAN_PASSPHRASE, or nil when none is given. A key file holds the key as raw
+// bytes or as hex digits.
+func loadEncryption() (*huffman.Encryption, error) {
+	switch {
+	case keyFile != "" && passphraseFile != "":
+		return nil, errors.New("--key-file and --passphrase-file can't be used together")
+	case keyFile != "":
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == huffman.KeySize {
+			return &huffman.Encryption{Key: data}, nil
+		}
+		key, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(key) != huffman.KeySize {
+			return nil, fmt.Errorf("key file %s must hold %d bytes, raw or as hex digits", keyFile, huffman.KeySize)
+		}
+		return &huffman.Encryption{Key: key}, nil
+	case passphraseFile != "":
+		data, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		// Only the line ending is dropped, so that echo and editors can write the file
+		passphrase := bytes.TrimRight(data, "\r\n")
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("passphrase file %s is empty", passphraseFile)
+		}
+		return &huffman.Encryption{Passphrase: passphrase}, nil
+	}
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return &huffman.Encryption{Passphrase: []byte(passphrase)}, nil
+	}
+	return nil, nil
+}
+
+// encryptionHint adds the ways to give a key to an error about a missing one
+func encryptionHint(err error) error {
+	if errors.Is(err, huffman.ErrEncrypted) {
+		return fmt.Errorf("%w: give its key with --key-file, --passphrase-file or $%s", err, passphraseEnv)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+// Formats accepted by --format
+const (
+	formatHuffz = "huffz"
+	formatGzip  = "gzip"
+)
+
+// newEncoder returns the compressor for --format, configured from the encode flags
+func newEncoder(cmd *cobra.Command, w io.Writer) (io.WriteCloser, error) {
+	switch formatName {
+	case formatGzip:
+		for _, name := range []string{"codec", "header", "use-tree", "max-code-length", "block-size", "workers", "model", "symbols", "index", "encrypt", "key-file", "passphrase-file"} {
+			if cmd.Flags().Changed(name) {
+				return nil, fmt.Errorf("--%s can't be used with --format gzip", name)
+			}
+		}
+		return huffman.NewGzipWriter(w), nil
+	case formatHuffz:
+	default:
+		return nil, fmt.Errorf("unknown format %q", formatName)
+	}
+
+	codec, err := huffman.ParseCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	header, err := huffman.ParseHeaderMode(headerMode)
+	if err != nil {
+		return nil, err
+	}
+	if useTree {
+		header = huffman.TreeHeader
+	}
+	symbols, err := huffman.ParseSymbolMode(symbolMode)
+	if err != nil {
+		return nil, err
+	}
+	model, err := loadModel(modelFile)
+	if err != nil {
+		return nil, err
+	}
+	var encryption *huffman.Encryption
+	if encrypt {
+		if encryption, err = loadEncryption(); err != nil {
+			return nil, err
+		}
+		if encryption == nil {
+			return nil, fmt.Errorf("--encrypt needs --key-file, --passphrase-file or $%s", passphraseEnv)
+		}
+	} else if keyFile != "" || passphraseFile != "" {
+		return nil, errors.New("--key-file and --passphrase-file need --encrypt")
+	}
+
+	return huffman.NewWriterOptions(w, huffman.WriterOptions{
+		Codec:         codec,
+		Header:        header,
+		MaxCodeLength: maxCodeLength,
+		BlockSize:     blockSize,
+		Concurrency:   workers,
+		Model:         model,
+		Symbols:       symbols,
+		Index:         writeIndex,
+		Encryption:    encryption,
+	})
+}
+
+// newDecoder returns the decompressor for --format
+func newDecoder(r io.Reader) (io.Reader, error) {
+	switch formatName {
+	case formatGzip:
+		if modelFile != "" {
+			return nil, fmt.Errorf("--model can't be used with --format gzip")
+		}
+		if maxDecodeSize != 0 || maxDecodeBlockSize != 0 {
+			return nil, fmt.Errorf("--max-size and --max-block-size can't be used with --format gzip")
+		}
+		if keyFile != "" || passphraseFile != "" {
+			return nil, fmt.Errorf("--key-file and --passphrase-file can't be used with --format gzip")
+		}
+		return huffman.NewGzipReader(r)
+	case formatHuffz:
+		model, err := loadModel(modelFile)
+		if err != nil {
+			return nil, err
+		}
+		encryption, err := loadEncryption()
+		if err != nil {
+			return nil, err
+		}
+		zr, err := huffman.NewReaderOptions(r, huffman.ReaderOptions{
+			Concurrency:  workers,
+			Model:        model,
+			MaxBlockSize: maxDecodeBlockSize,
+			MaxSize:      maxDecodeSize,
+			Encryption:   encryption,
+		})
+		if err != nil {
+			return nil, encryptionHint(err)
+		}
+		return zr, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", formatName)
+}
+
+// loadModel reads the model file at path, or returns nil when path is empty
+func loadModel(path string) (*huffman.Model, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return huffman.ReadModel(file)
+}
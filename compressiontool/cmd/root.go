@@ -1,16 +1,15 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
+	"io"
+	"io/fs"
 	"log" // Add this import
 	"os"
-	"strings"
+	"path/filepath"
 
 	"github.com/vishal151/compression/internal/huffman"
 
-	"encoding/binary"
-
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +22,21 @@ var rootCmd = &cobra.Command{
 var inputFile string
 var outputFile string
 var useTree bool
+var headerMode string
+var codecName string
+var maxCodeLength int
+var blockSize int
+var workers int
+var formatName string
+var modelFile string
+var symbolMode string
+var destDir string
+var writeIndex bool
+var extractOffset int64
+var extractLength int64
+var maxDecodeSize int64
+var maxDecodeBlockSize int
+var reportFormat string
 
 func init() {
 	rootCmd.AddCommand(frequencyCmd)
@@ -30,22 +44,91 @@ func init() {
 	rootCmd.AddCommand(codesCmd)
 	rootCmd.AddCommand(encodeCmd)
 	rootCmd.AddCommand(decodeCmd)
+	rootCmd.AddCommand(analyzeCmd)
+	rootCmd.AddCommand(trainCmd)
+	rootCmd.AddCommand(packCmd)
+	rootCmd.AddCommand(unpackCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(extractCmd)
+	rootCmd.AddCommand(traceCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(infoCmd)
 	frequencyCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	frequencyCmd.Flags().StringVar(&symbolMode, "symbols", "byte", "Symbols to count: byte, rune or word")
 	frequencyCmd.MarkFlagRequired("input")
 	treeCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	treeCmd.Flags().StringVar(&reportFormat, "format", "text", "Output format: text, dot for Graphviz, or json")
 	treeCmd.MarkFlagRequired("input")
 	codesCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	codesCmd.Flags().StringVar(&symbolMode, "symbols", "byte", "Symbols to code: byte, rune or word")
 	codesCmd.MarkFlagRequired("input")
 	encodeCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
 	encodeCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path")
-	encodeCmd.Flags().BoolVarP(&useTree, "use-tree", "t", false, "Use tree structure instead of frequency table")
+	encodeCmd.Flags().BoolVarP(&useTree, "use-tree", "t", false, "Use tree structure instead of frequency table (same as --header tree)")
+	encodeCmd.Flags().StringVar(&codecName, "codec", "huffman", "Compression codec: huffman, lzh, adaptive, range, context or bwt")
+	encodeCmd.Flags().StringVar(&headerMode, "header", "canonical", "Code description stored in each block: canonical, table or tree")
+	encodeCmd.Flags().IntVar(&maxCodeLength, "max-code-length", huffman.DefaultMaxCodeLength, "Longest Huffman code in bits (8-64)")
+	encodeCmd.Flags().IntVar(&blockSize, "block-size", huffman.DefaultBlockSize, "Bytes of input coded as one block with its own Huffman table")
+	encodeCmd.Flags().IntVarP(&workers, "workers", "w", 0, "Blocks encoded in parallel (0 uses every CPU)")
+	encodeCmd.Flags().StringVar(&formatName, "format", formatHuffz, "Output format: huffz, or gzip for output standard tools can read")
+	encodeCmd.Flags().StringVar(&symbolMode, "symbols", "byte", "Symbols to code with the huffman codec: byte, rune or word")
+	encodeCmd.Flags().BoolVar(&writeIndex, "index", false, "Write a block index so that extract can read byte ranges without decoding everything")
+	encodeCmd.Flags().StringVar(&modelFile, "model", "", "Model file from the train command; blocks then store no code table")
+	encodeCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt and authenticate the output with AES-256-GCM")
+	encodeCmd.Flags().StringVar(&keyFile, "key-file", "", "File holding the 32 byte encryption key, raw or as hex digits")
+	encodeCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding a passphrase to derive the encryption key from (default $"+passphraseEnv+")")
 	encodeCmd.MarkFlagRequired("input")
 	encodeCmd.MarkFlagRequired("output")
 	decodeCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
 	decodeCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path")
 	decodeCmd.Flags().BoolVarP(&useTree, "use-tree", "t", false, "Use tree structure instead of frequency table")
+	decodeCmd.Flags().IntVarP(&workers, "workers", "w", 0, "Blocks decoded in parallel (0 uses every CPU)")
+	decodeCmd.Flags().StringVar(&formatName, "format", formatHuffz, "Input format: huffz, or gzip to read files from gzip and other tools")
+	decodeCmd.Flags().StringVar(&modelFile, "model", "", "Model file the input was encoded with")
+	decodeCmd.Flags().StringVar(&keyFile, "key-file", "", "File holding the key of an encrypted input")
+	decodeCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of an encrypted input (default $"+passphraseEnv+")")
+	decodeCmd.Flags().Int64Var(&maxDecodeSize, "max-size", 0, "Fail if the input decodes to more than this many bytes (0 means no limit)")
+	decodeCmd.Flags().IntVar(&maxDecodeBlockSize, "max-block-size", 0, "Reject blocks larger than this many bytes (0 allows any valid block)")
 	decodeCmd.MarkFlagRequired("input")
 	decodeCmd.MarkFlagRequired("output")
+	analyzeCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	analyzeCmd.Flags().IntVar(&blockSize, "block-size", huffman.DefaultBlockSize, "Bytes of input coded as one block")
+	analyzeCmd.Flags().IntVar(&maxCodeLength, "max-code-length", huffman.DefaultMaxCodeLength, "Longest Huffman code in bits (8-64)")
+	analyzeCmd.Flags().StringVar(&reportFormat, "format", "text", "Report format: text, json or csv")
+	analyzeCmd.MarkFlagRequired("input")
+	trainCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Corpus directory")
+	trainCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Model file path")
+	trainCmd.MarkFlagRequired("input")
+	trainCmd.MarkFlagRequired("output")
+	packCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Archive path")
+	packCmd.Flags().StringVar(&codecName, "codec", "huffman", "Compression codec: huffman, lzh, adaptive, range, context or bwt")
+	packCmd.Flags().IntVarP(&workers, "workers", "w", 0, "Blocks encoded in parallel (0 uses every CPU)")
+	packCmd.MarkFlagRequired("output")
+	unpackCmd.Flags().StringVarP(&destDir, "directory", "C", ".", "Directory to unpack into")
+	unpackCmd.Flags().IntVarP(&workers, "workers", "w", 0, "Blocks decoded in parallel (0 uses every CPU)")
+	extractCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	extractCmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path")
+	extractCmd.Flags().Int64Var(&extractOffset, "offset", 0, "Offset in the original data to extract from")
+	extractCmd.Flags().Int64Var(&extractLength, "length", -1, "Bytes to extract (-1 extracts up to the end)")
+	extractCmd.Flags().StringVar(&modelFile, "model", "", "Model file the input was encoded with")
+	extractCmd.MarkFlagRequired("input")
+	extractCmd.MarkFlagRequired("output")
+	traceCmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file path")
+	traceCmd.Flags().Int64Var(&traceFromBit, "from-bit", 0, "Offset in bits from the start of the file of the first bit to trace")
+	traceCmd.Flags().Int64Var(&traceCount, "count", -1, "Bits to trace (-1 traces up to the end)")
+	traceCmd.Flags().StringVar(&reportFormat, "format", "text", "Output format: text, or json for one object per line")
+	traceCmd.Flags().StringVar(&modelFile, "model", "", "Model file the input was encoded with")
+	traceCmd.MarkFlagRequired("input")
+	verifyCmd.Flags().StringVar(&formatName, "format", formatHuffz, "Input format: huffz, or gzip to check gzip files")
+	verifyCmd.Flags().StringVar(&modelFile, "model", "", "Model file the input was encoded with")
+	verifyCmd.Flags().StringVar(&keyFile, "key-file", "", "File holding the key of an encrypted input")
+	verifyCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of an encrypted input (default $"+passphraseEnv+")")
+	verifyCmd.Flags().IntVarP(&workers, "workers", "w", 0, "Blocks decoded in parallel (0 uses every CPU)")
+	verifyCmd.Flags().Int64Var(&maxDecodeSize, "max-size", 0, "Fail if a file decodes to more than this many bytes (0 means no limit)")
+	verifyCmd.Flags().IntVar(&maxDecodeBlockSize, "max-block-size", 0, "Reject blocks larger than this many bytes (0 allows any valid block)")
+	infoCmd.Flags().StringVar(&modelFile, "model", "", "Model file the input was encoded with")
+	infoCmd.Flags().StringVar(&keyFile, "key-file", "", "File holding the key of an encrypted input")
+	infoCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File holding the passphrase of an encrypted input (default $"+passphraseEnv+")")
 }
 
 var frequencyCmd = &cobra.Command{
@@ -59,28 +142,22 @@ var frequencyCmd = &cobra.Command{
 		}
 		defer file.Close()
 
-		frequencies, err := huffman.CountFrequencies(file)
+		mode, err := huffman.ParseSymbolMode(symbolMode)
 		if err != nil {
-			fmt.Printf("Error counting frequencies: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
 			return
 		}
-
-		for char, count := range frequencies {
-			fmt.Printf("%q: %d\n", char, count)
-		}
-	},
-}
-
-var treeCmd = &cobra.Command{
-	Use:   "tree",
-	Short: "Build and display the Huffman tree for the input file",
-	Run: func(cmd *cobra.Command, args []string) {
-		file, err := os.Open(inputFile)
-		if err != nil {
-			fmt.Printf("Error opening file: %v\n", err)
+		if mode != huffman.ByteSymbols {
+			counts, err := huffman.CountSymbols(file, mode)
+			if err != nil {
+				fmt.Printf("Error counting frequencies: %v\n", err)
+				return
+			}
+			for _, symbol := range byCount(counts, func(a, b string) bool { return a < b }) {
+				fmt.Printf("%s: %d\n", formatSymbol(symbol, mode), counts[symbol])
+			}
 			return
 		}
-		defer file.Close()
 
 		frequencies, err := huffman.CountFrequencies(file)
 		if err != nil {
@@ -88,11 +165,9 @@ var treeCmd = &cobra.Command{
 			return
 		}
 
-		root := huffman.BuildHuffmanTree(frequencies)
-		fmt.Println("Huffman Tree built successfully.")
-		fmt.Printf("Root frequency: %d\n", root.Freq)
-		fmt.Println("Tree structure (simplified):")
-		printTree(root, 0)
+		for _, char := range byCount(frequencies, func(a, b byte) bool { return a < b }) {
+			fmt.Printf("%q: %d\n", char, frequencies[char])
+		}
 	},
 }
 
@@ -107,18 +182,44 @@ var codesCmd = &cobra.Command{
 		}
 		defer file.Close()
 
+		mode, err := huffman.ParseSymbolMode(symbolMode)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		if mode != huffman.ByteSymbols {
+			counts, err := huffman.CountSymbols(file, mode)
+			if err != nil {
+				fmt.Printf("Error counting frequencies: %v\n", err)
+				return
+			}
+			if len(counts) == 0 {
+				return
+			}
+			less := func(a, b string) bool { return a < b }
+			codes := huffman.GenerateCodes(huffman.BuildTree(counts, less))
+			fmt.Println("Huffman Codes:")
+			for _, symbol := range byCount(counts, less) {
+				fmt.Printf("%s: %s\n", formatSymbol(symbol, mode), codes[symbol])
+			}
+			return
+		}
+
 		frequencies, err := huffman.CountFrequencies(file)
 		if err != nil {
 			fmt.Printf("Error counting frequencies: %v\n", err)
 			return
 		}
 
+		if len(frequencies) == 0 {
+			return
+		}
 		root := huffman.BuildHuffmanTree(frequencies)
 		codes := huffman.GenerateHuffmanCodes(root)
 
 		fmt.Println("Huffman Codes:")
-		for char, code := range codes {
-			fmt.Printf("%q: %s\n", char, code)
+		for _, char := range byCount(frequencies, func(a, b byte) bool { return a < b }) {
+			fmt.Printf("%q: %s\n", char, codes[char])
 		}
 	},
 }
@@ -126,126 +227,178 @@ var codesCmd = &cobra.Command{
 var encodeCmd = &cobra.Command{
 	Use:   "encode",
 	Short: "Encode the input file using Huffman coding",
-	Run: func(cmd *cobra.Command, args []string) {
-		input, err := os.ReadFile(inputFile)
-		if err != nil {
-			log.Fatalf("Error reading input file: %v", err)
-		}
+	Long: `Encode the input file using Huffman coding. Use - as the input or output path to read from stdin or write to stdout.
 
-		frequencies, err := huffman.CountFrequencies(bytes.NewReader(input))
+With --encrypt everything after the header is encrypted and authenticated with AES-256-GCM, block by block, using the key in --key-file or a key derived with scrypt from the passphrase in --passphrase-file or $` + passphraseEnv + `. Decoding then needs the same key or passphrase, and fails on any change to the file, header included.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := openInput(inputFile)
 		if err != nil {
-			log.Fatalf("Error counting frequencies: %v", err)
+			log.Fatalf("Error opening input file: %v", err)
 		}
+		defer input.Close()
 
-		root := huffman.BuildHuffmanTree(frequencies)
-		codes := huffman.GenerateHuffmanCodes(root)
-		encoded := huffman.EncodeText(input, codes)
-
-		outputFile, err := os.Create(outputFile)
+		output, err := createOutput(outputFile)
 		if err != nil {
 			log.Fatalf("Error creating output file: %v", err)
 		}
-		defer outputFile.Close()
-
-		if err := binary.Write(outputFile, binary.LittleEndian, useTree); err != nil {
-			log.Fatalf("Error writing use-tree flag: %v", err)
-		}
+		defer output.Close()
 
-		if useTree {
-			if err := huffman.WriteTree(root, outputFile); err != nil {
-				log.Fatalf("Error writing tree: %v", err)
-			}
-		} else {
-			if err := huffman.WriteFrequencyTable(frequencies, outputFile); err != nil {
-				log.Fatalf("Error writing frequency table: %v", err)
-			}
+		compressed := &countingWriter{w: output}
+		zw, err := newEncoder(cmd, compressed)
+		if err != nil {
+			log.Fatalf("Error creating encoder: %v", err)
 		}
 
-		if err := binary.Write(outputFile, binary.LittleEndian, uint32(root.Freq)); err != nil {
-			log.Fatalf("Error writing total frequency: %v", err)
+		originalSize, err := io.Copy(zw, input)
+		if err != nil {
+			log.Fatalf("Error encoding input: %v", err)
 		}
-
-		if _, err := outputFile.Write(encoded); err != nil {
+		if err := zw.Close(); err != nil {
 			log.Fatalf("Error writing encoded data: %v", err)
 		}
 
-		fmt.Printf("File encoded successfully. Output written to %s\n", outputFile.Name())
-		fmt.Printf("Original size: %d bytes\n", len(input))
-		fmt.Printf("Compressed size: %d bytes\n", len(encoded))
-		fmt.Printf("Compression ratio: %.2f%%\n", float64(len(encoded))/float64(len(input))*100)
+		status := statusWriter(outputFile)
+		fmt.Fprintf(status, "File encoded successfully. Output written to %s\n", output.Name())
+		fmt.Fprintf(status, "Original size: %d bytes\n", originalSize)
+		fmt.Fprintf(status, "Compressed size: %d bytes\n", compressed.n)
+		if originalSize > 0 {
+			fmt.Fprintf(status, "Compression ratio: %.2f%%\n", float64(compressed.n)/float64(originalSize)*100)
+		}
 	},
 }
 
 var decodeCmd = &cobra.Command{
 	Use:   "decode",
 	Short: "Decode a Huffman-encoded file",
+	Long:  `Decode a Huffman-encoded file. Use - as the input or output path to read from stdin or write to stdout.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		inputData, err := os.ReadFile(inputFile)
+		input, err := openInput(inputFile)
 		if err != nil {
-			log.Fatalf("Error reading input file: %v", err)
+			log.Fatalf("Error opening input file: %v", err)
 		}
+		defer input.Close()
 
-		reader := bytes.NewReader(inputData)
+		compressed := &countingReader{r: input}
+		zr, err := newDecoder(compressed)
+		if err != nil {
+			log.Fatalf("Error reading header: %v", err)
+		}
 
-		var usedTree bool
-		if err := binary.Read(reader, binary.LittleEndian, &usedTree); err != nil {
-			log.Fatalf("Error reading use-tree flag: %v", err)
+		output, err := createOutput(outputFile)
+		if err != nil {
+			log.Fatalf("Error creating output file: %v", err)
 		}
+		defer output.Close()
 
-		var root *huffman.Node
-		if usedTree {
-			root, err = huffman.ReadTree(reader)
-			if err != nil {
-				log.Fatalf("Error reading Huffman tree: %v", err)
-			}
-		} else {
-			frequencies, err := huffman.ReadFrequencyTable(reader)
-			if err != nil {
-				log.Fatalf("Error reading frequency table: %v", err)
-			}
-			root = huffman.BuildHuffmanTree(frequencies)
+		decodedSize, err := io.Copy(output, zr)
+		if err != nil {
+			log.Fatalf("Error decoding input: %v", err)
 		}
 
-		var totalFreq uint32
-		if err := binary.Read(reader, binary.LittleEndian, &totalFreq); err != nil {
-			log.Fatalf("Error reading total frequency: %v", err)
+		status := statusWriter(outputFile)
+		fmt.Fprintf(status, "File decoded successfully. Output written to %s\n", output.Name())
+		fmt.Fprintf(status, "Compressed size: %d bytes\n", compressed.n)
+		fmt.Fprintf(status, "Decompressed size: %d bytes\n", decodedSize)
+	},
+}
+
+var extractCmd = &cobra.Command{
+	Use:   "extract",
+	Short: "Decode a byte range of a file encoded with --index",
+	Long:  `Decode a byte range of the original data of a file encoded with --index, decoding only the blocks that hold it. Use - as the output path to write to stdout.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := os.Open(inputFile)
+		if err != nil {
+			log.Fatalf("Error opening input file: %v", err)
+		}
+		defer input.Close()
+		info, err := input.Stat()
+		if err != nil {
+			log.Fatalf("Error opening input file: %v", err)
 		}
-		root.Freq = int(totalFreq)
 
-		encodedData := inputData[len(inputData)-reader.Len():]
-		decoded, err := huffman.DecodeText(encodedData, root)
+		model, err := loadModel(modelFile)
 		if err != nil {
-			log.Fatalf("Error decoding text: %v", err)
+			log.Fatalf("Error reading model: %v", err)
+		}
+		zr, err := huffman.NewReaderAt(input, info.Size(), huffman.ReaderOptions{Model: model})
+		if err != nil {
+			log.Fatalf("Error reading header: %v", err)
+		}
+		if extractOffset < 0 || extractOffset > zr.Size() {
+			log.Fatalf("Offset %d is outside the %d bytes of original data", extractOffset, zr.Size())
+		}
+		length := extractLength
+		if length < 0 || length > zr.Size()-extractOffset {
+			length = zr.Size() - extractOffset
 		}
 
-		// Preserve line endings
-		decoded = bytes.ReplaceAll(decoded, []byte{'\r', '\n'}, []byte{'\n'})
+		output, err := createOutput(outputFile)
+		if err != nil {
+			log.Fatalf("Error creating output file: %v", err)
+		}
+		defer output.Close()
 
-		err = os.WriteFile(outputFile, decoded, 0644)
+		extracted, err := io.Copy(output, io.NewSectionReader(zr, extractOffset, length))
 		if err != nil {
-			log.Fatalf("Error writing output file: %v", err)
+			log.Fatalf("Error decoding input: %v", err)
 		}
 
-		fmt.Printf("File decoded successfully. Output written to %s\n", outputFile)
-		fmt.Printf("Compressed size: %d bytes\n", len(inputData))
-		fmt.Printf("Decompressed size: %d bytes\n", len(decoded))
+		status := statusWriter(outputFile)
+		fmt.Fprintf(status, "Extracted %d bytes from offset %d. Output written to %s\n", extracted, extractOffset, output.Name())
 	},
 }
 
-func printTree(node *huffman.Node, level int) {
-	if node == nil {
-		return
-	}
+var trainCmd = &cobra.Command{
+	Use:   "train",
+	Short: "Train a shared Huffman model on a corpus directory",
+	Long:  `Count the byte frequencies of every file under the corpus directory and write a model file. Files encoded with --model store only the model ID instead of a code table, which pays off for many small files like the corpus. Use - as the output path to write to stdout.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		frequencies := make(map[byte]int)
+		files, size := 0, 0
+		err := filepath.WalkDir(inputFile, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
 
-	indent := strings.Repeat("  ", level)
-	if node.Char != 0 {
-		fmt.Printf("%s'%c' (%d)\n", indent, node.Char, node.Freq)
-	} else {
-		fmt.Printf("%sInternal Node (%d)\n", indent, node.Freq)
-	}
+			counts, err := huffman.CountFrequencies(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			for char, count := range counts {
+				frequencies[char] += count
+				size += count
+			}
+			files++
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Error reading corpus: %v", err)
+		}
+
+		model, err := huffman.TrainModel(frequencies)
+		if err != nil {
+			log.Fatalf("Error training model: %v", err)
+		}
 
-	printTree(node.Left, level+1)
-	printTree(node.Right, level+1)
+		output, err := createOutput(outputFile)
+		if err != nil {
+			log.Fatalf("Error creating output file: %v", err)
+		}
+		defer output.Close()
+		if _, err := model.WriteTo(output); err != nil {
+			log.Fatalf("Error writing model: %v", err)
+		}
+
+		status := statusWriter(outputFile)
+		fmt.Fprintf(status, "Model trained on %d files (%d bytes). Output written to %s\n", files, size, output.Name())
+		fmt.Fprintf(status, "Model ID: %016x\n", model.ID)
+	},
 }
 
 func Execute() {
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io"
+	"os"
+)
+
+// stdioPath is the path that selects stdin or stdout instead of a file
+const stdioPath = "-"
+
+// namedReadCloser is an input that can report the path it was opened from
+type namedReadCloser interface {
+	io.ReadCloser
+	Name() string
+}
+
+// namedWriteCloser is an output that can report the path it was created at
+type namedWriteCloser interface {
+	io.WriteCloser
+	Name() string
+}
+
+// openInput opens path for reading, or returns stdin when path is "-"
+func openInput(path string) (namedReadCloser, error) {
+	if path == stdioPath {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+// createOutput creates path for writing, or returns stdout when path is "-"
+func createOutput(path string) (namedWriteCloser, error) {
+	if path == stdioPath {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// statusWriter returns where progress messages go, keeping stdout clean when it carries data
+func statusWriter(outputPath string) io.Writer {
+	if outputPath == stdioPath {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+// formatSymbol quotes a symbol of mode for display: runes as Go rune literals, and
+// words, and bytes that aren't valid UTF-8, as Go string literals
+func formatSymbol(symbol string, mode huffman.SymbolMode) string {
+	if r, size := utf8.DecodeRuneInString(symbol); mode == huffman.RuneSymbols && size == len(symbol) && r != utf8.RuneError {
+		return fmt.Sprintf("%q", r)
+	}
+	return fmt.Sprintf("%q", symbol)
+}
+
+// byCount returns the symbols of counts, most frequent first and in the order given by
+// less among symbols of the same count, so that listings don't depend on map order
+func byCount[T comparable](counts map[T]int, less func(a, b T) bool) []T {
+	symbols := make([]T, 0, len(counts))
+	for symbol := range counts {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		return counts[a] > counts[b] || counts[a] == counts[b] && less(a, b)
+	})
+	return symbols
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+var traceFromBit int64
+var traceCount int64
+
+// errTraceDone stops tracing once --count bits have been written
+var errTraceDone = errors.New("trace done")
+
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Trace the decoding of an encoded file bit by bit",
+	Long: `Decode the Huffman blocks of an encoded file one bit at a time and print what every bit does: its offset, the byte holding it, the path it extends from the root of the tree and the symbol it decodes when it reaches a leaf. Bit offsets count from the start of the file, so byte N of a hex dump starts at bit 8*N. Blocks of other codecs are skipped.
+
+Use --from-bit and --count to trace part of a file, --format json for one JSON object per line, and - as the input path to read from stdin.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		newWriter, ok := map[string]func(io.Writer) func(huffman.TraceEvent) error{
+			"text": newTraceTextWriter,
+			"json": newTraceJSONWriter,
+		}[reportFormat]
+		if !ok {
+			log.Fatalf("Error: unknown format %q", reportFormat)
+		}
+		if traceFromBit < 0 {
+			log.Fatalf("Error: invalid bit offset %d", traceFromBit)
+		}
+
+		input, err := openInput(inputFile)
+		if err != nil {
+			log.Fatalf("Error opening input file: %v", err)
+		}
+		defer input.Close()
+		model, err := loadModel(modelFile)
+		if err != nil {
+			log.Fatalf("Error reading model: %v", err)
+		}
+
+		out := bufio.NewWriter(os.Stdout)
+		write := newWriter(out)
+		traced := int64(0)
+		err = huffman.Trace(input, huffman.ReaderOptions{Model: model}, traceFromBit, func(e huffman.TraceEvent) error {
+			if traceCount >= 0 && traced == traceCount {
+				return errTraceDone
+			}
+			traced++
+			return write(e)
+		})
+		if flushErr := out.Flush(); flushErr != nil && err == nil {
+			err = flushErr
+		}
+		if err != nil && err != errTraceDone {
+			log.Fatalf("Error tracing input: %v", err)
+		}
+		if traced == 0 {
+			fmt.Fprintln(os.Stderr, "No Huffman coded bits to trace")
+		}
+	},
+}
+
+// newTraceTextWriter returns a function writing every event as a line, after a line
+// naming the block whenever a new block starts
+func newTraceTextWriter(w io.Writer) func(huffman.TraceEvent) error {
+	block := -1
+	return func(e huffman.TraceEvent) error {
+		if e.Block != block {
+			block = e.Block
+			fmt.Fprintf(w, "Block %d\n", block)
+		}
+		if !e.Leaf {
+			_, err := fmt.Fprintf(w, "  bit %-10d byte %-8d %08b  %d  path %s\n", e.Bit, e.Bit/8, e.Byte, e.Value, e.Path)
+			return err
+		}
+		_, err := fmt.Fprintf(w, "  bit %-10d byte %-8d %08b  %d  path %-16s -> %q at %d\n", e.Bit, e.Bit/8, e.Byte, e.Value, e.Path, e.Symbol, e.Position)
+		return err
+	}
+}
+
+// traceJSON is an event in the JSON output. Only events reaching a leaf have a byte
+// and a symbol.
+type traceJSON struct {
+	Block       int    `json:"block"`
+	Bit         int64  `json:"bit"`
+	InputOffset int64  `json:"input_offset"`
+	InputByte   byte   `json:"input_byte"`
+	Value       byte   `json:"value"`
+	Path        string `json:"path"`
+	Leaf        bool   `json:"leaf"`
+	Byte        *byte  `json:"byte,omitempty"`
+	Symbol      string `json:"symbol,omitempty"`
+	Position    int64  `json:"position"`
+}
+
+// newTraceJSONWriter returns a function writing every event as a JSON object on a line
+// of its own
+func newTraceJSONWriter(w io.Writer) func(huffman.TraceEvent) error {
+	enc := json.NewEncoder(w)
+	return func(e huffman.TraceEvent) error {
+		t := traceJSON{
+			Block:       e.Block,
+			Bit:         e.Bit,
+			InputOffset: e.Bit / 8,
+			InputByte:   e.Byte,
+			Value:       e.Value,
+			Path:        e.Path,
+			Leaf:        e.Leaf,
+			Position:    e.Position,
+		}
+		if e.Leaf {
+			symbol := e.Symbol
+			t.Byte = &symbol
+			t.Symbol = fmt.Sprintf("%q", symbol)
+		}
+		return enc.Encode(t)
+	}
+}
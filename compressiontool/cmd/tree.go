@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+var treeCmd = &cobra.Command{
+	Use:   "tree",
+	Short: "Build and display the Huffman tree for the input file",
+	Long: `Build the Huffman tree for the input file and print it as an indented outline, as a Graphviz graph with --format dot, or as nested JSON objects with --format json. Branches are labelled with the bit they add to the code: 0 for the left child and 1 for the right one.
+
+Render a graph with: huffman tree -i file --format dot | dot -Tsvg -o tree.svg`,
+	Run: func(cmd *cobra.Command, args []string) {
+		write, ok := map[string]func(io.Writer, *huffman.Node[byte]) error{
+			"text": writeTreeText,
+			"dot":  writeTreeDOT,
+			"json": writeTreeJSON,
+		}[reportFormat]
+		if !ok {
+			log.Fatalf("Error: unknown format %q", reportFormat)
+		}
+
+		file, err := os.Open(inputFile)
+		if err != nil {
+			log.Fatalf("Error opening file: %v", err)
+		}
+		defer file.Close()
+
+		frequencies, err := huffman.CountFrequencies(file)
+		if err != nil {
+			log.Fatalf("Error counting frequencies: %v", err)
+		}
+
+		// An empty file has no tree
+		var root *huffman.Node[byte]
+		if len(frequencies) > 0 {
+			root = huffman.BuildHuffmanTree(frequencies)
+		}
+		out := bufio.NewWriter(os.Stdout)
+		if err := write(out, root); err != nil {
+			log.Fatalf("Error writing tree: %v", err)
+		}
+		if err := out.Flush(); err != nil {
+			log.Fatalf("Error writing tree: %v", err)
+		}
+	},
+}
+
+func isLeaf(node *huffman.Node[byte]) bool {
+	return node.Left == nil && node.Right == nil
+}
+
+// writeTreeText writes the tree as an outline, one node per line below its parent
+func writeTreeText(w io.Writer, root *huffman.Node[byte]) error {
+	if root == nil {
+		_, err := fmt.Fprintln(w, "Empty input: no tree")
+		return err
+	}
+	fmt.Fprintf(w, "Huffman tree of %d bytes\n", root.Freq)
+	writeTreeNode(w, root, "", "")
+	return nil
+}
+
+// writeTreeNode writes node after the branch leading to it, and its children indented
+// by prefix
+func writeTreeNode(w io.Writer, node *huffman.Node[byte], branch, prefix string) {
+	if isLeaf(node) {
+		fmt.Fprintf(w, "%s%q (%d)\n", branch, node.Char, node.Freq)
+		return
+	}
+	fmt.Fprintf(w, "%s(%d)\n", branch, node.Freq)
+	writeTreeNode(w, node.Left, prefix+"├─0─ ", prefix+"│    ")
+	writeTreeNode(w, node.Right, prefix+"└─1─ ", prefix+"     ")
+}
+
+// writeTreeDOT writes the tree as a Graphviz digraph: internal nodes are circles
+// holding their frequency, leaves are boxes holding their symbol, as a Go literal, and
+// their frequency
+func writeTreeDOT(w io.Writer, root *huffman.Node[byte]) error {
+	fmt.Fprintln(w, "digraph huffman {")
+	fmt.Fprintln(w, "\tnode [fontname=\"monospace\"];")
+	fmt.Fprintln(w, "\tedge [fontname=\"monospace\"];")
+	if root != nil {
+		next := 0
+		writeDOTNode(w, root, &next)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// writeDOTNode writes node and the subtree below it, numbering nodes from *next, and
+// returns the ID of node
+func writeDOTNode(w io.Writer, node *huffman.Node[byte], next *int) string {
+	id := fmt.Sprintf("n%d", *next)
+	*next++
+	if isLeaf(node) {
+		fmt.Fprintf(w, "\t%s [shape=box, label=\"%s\\n%d\"];\n", id, dotEscape(fmt.Sprintf("%q", node.Char)), node.Freq)
+		return id
+	}
+	fmt.Fprintf(w, "\t%s [shape=circle, label=\"%d\"];\n", id, node.Freq)
+	for bit, child := range []*huffman.Node[byte]{node.Left, node.Right} {
+		fmt.Fprintf(w, "\t%s -> %s [label=\"%d\"];\n", id, writeDOTNode(w, child, next), bit)
+	}
+	return id
+}
+
+// dotEscape escapes s for a double-quoted DOT string, in which only quotes and
+// backslashes are special
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// treeJSON is a node of the tree in the JSON output. Only leaves have a byte and a
+// symbol; only internal nodes have children.
+type treeJSON struct {
+	Frequency int       `json:"frequency"`
+	Code      string    `json:"code"`
+	Byte      *byte     `json:"byte,omitempty"`
+	Symbol    string    `json:"symbol,omitempty"`
+	Left      *treeJSON `json:"left,omitempty"`
+	Right     *treeJSON `json:"right,omitempty"`
+}
+
+// writeTreeJSON writes the tree as nested objects, or null for an empty input
+func writeTreeJSON(w io.Writer, root *huffman.Node[byte]) error {
+	var tree *treeJSON
+	if root != nil {
+		tree = newTreeJSON(root, "")
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(tree)
+}
+
+func newTreeJSON(node *huffman.Node[byte], code string) *treeJSON {
+	t := &treeJSON{Frequency: node.Freq, Code: code}
+	if isLeaf(node) {
+		char := node.Char
+		t.Byte = &char
+		t.Symbol = fmt.Sprintf("%q", char)
+		return t
+	}
+	t.Left = newTreeJSON(node.Left, code+"0")
+	t.Right = newTreeJSON(node.Right, code+"1")
+	return t
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/vishal151/compression/internal/huffman"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify file...",
+	Short: "Check that encoded files decode and match their stored checksums",
+	Long:  `Decode every file without writing the result anywhere and check the length and checksum stored at its end. The exit status is 1 if any file fails. Use - as a path to read from stdin.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := 0
+		for _, path := range args {
+			size, err := verifyFile(path)
+			if err != nil {
+				fmt.Printf("%s: FAILED: %v\n", path, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: OK (%d bytes)\n", path, size)
+		}
+		if failed > 0 {
+			fmt.Fprintf(os.Stderr, "%d of %d files failed verification\n", failed, len(args))
+			os.Exit(1)
+		}
+	},
+}
+
+// verifyFile decodes the file at path into io.Discard, returning the decoded size. The
+// decoder checks the stored length and checksum once it reaches the end.
+func verifyFile(path string) (int64, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+
+	zr, err := newDecoder(input)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(io.Discard, zr)
+}
+
+var infoCmd = &cobra.Command{
+	Use:   "info file",
+	Short: "Describe an encoded file without decoding it",
+	Long:  `Print the codec, the header mode of the blocks, the number of distinct symbols, the original size, the compression ratio and the header overhead of an encoded file. Only the code descriptions are read, so info is fast on large files, but it doesn't check the data: use verify for that. Encrypted files need their key. Use - as the path to read from stdin.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := openInput(args[0])
+		if err != nil {
+			log.Fatalf("Error opening input file: %v", err)
+		}
+		defer input.Close()
+		model, err := loadModel(modelFile)
+		if err != nil {
+			log.Fatalf("Error reading model: %v", err)
+		}
+
+		encryption, err := loadEncryption()
+		if err != nil {
+			log.Fatalf("Error reading key: %v", err)
+		}
+
+		info, err := huffman.Inspect(input, huffman.ReaderOptions{Model: model, Encryption: encryption})
+		if err != nil {
+			log.Fatalf("Error reading input: %v", encryptionHint(err))
+		}
+
+		fmt.Printf("File: %s\n", args[0])
+		if info.Header.Legacy() {
+			fmt.Println("Format: legacy, before the container format")
+			if info.LegacyHeader == huffman.TreeHeader {
+				fmt.Println("Header: tree")
+			} else {
+				fmt.Println("Header: frequency table")
+			}
+		} else {
+			fmt.Printf("Format: version %d\n", info.Header.Version)
+			fmt.Printf("Codec: %s\n", info.Header.Codec)
+		}
+		if info.Header.Encrypted() {
+			fmt.Println("Encryption: AES-256-GCM")
+		}
+		if info.Header.ModelID != 0 {
+			fmt.Printf("Model: %016x\n", info.Header.ModelID)
+		}
+
+		var blocks []string
+		total := 0
+		for kind, n := range info.Blocks {
+			blocks = append(blocks, fmt.Sprintf("%d %s", n, kind))
+			total += n
+		}
+		sort.Strings(blocks)
+		if total > 0 {
+			fmt.Printf("Blocks: %d (%s)\n", total, strings.Join(blocks, ", "))
+		}
+
+		switch {
+		case info.Symbols >= 0:
+			fmt.Printf("Symbols: %d distinct bytes\n", info.Symbols)
+		case info.Header.Codec == huffman.CodecAdaptive:
+			fmt.Println("Symbols: unknown, an adaptive stream stores no code and builds it while decoding")
+		default:
+			fmt.Println("Symbols: not counted, the blocks don't code bytes with a single Huffman code")
+		}
+		fmt.Printf("Original size: %d bytes\n", info.Size)
+		fmt.Printf("Compressed size: %d bytes\n", info.CompressedSize)
+		fmt.Printf("Compression ratio: %s\n", ratio(info.CompressedSize, info.Size))
+		if overhead := info.Overhead(); overhead >= 0 {
+			fmt.Printf("Header overhead: %d bytes (%s of the file)\n", overhead, ratio(overhead, info.CompressedSize))
+		} else {
+			fmt.Println("Header overhead: unknown, the coded data of the blocks can't be told apart")
+		}
+	},
+}
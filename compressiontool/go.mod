@@ -1,8 +1,11 @@
 module github.com/vishal151/compression
 
-go 1.19
+go 1.20
 
-require github.com/spf13/cobra v1.8.1
+require (
+	github.com/spf13/cobra v1.8.1
+	golang.org/x/crypto v0.24.0
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
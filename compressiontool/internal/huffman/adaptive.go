@@ -0,0 +1,223 @@
+package huffman
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// The adaptive codec uses the FGK algorithm: encoder and decoder start from a tree
+// holding only the NYT ("not yet transmitted") leaf and update it the same way after
+// every symbol, so no code description is ever stored. A symbol seen for the first time
+// is sent as the code of the NYT leaf followed by the symbol in adaptiveRawBits bits.
+//
+// The codec has 257 symbols: the byte values and adaptiveEOF, which ends the stream.
+// An adaptive container holds one bitstream from the header to the footer instead of
+// blocks, so the encoder can emit output as soon as input arrives.
+
+const (
+	// adaptiveEOF is the symbol that ends an adaptive stream
+	adaptiveEOF = 256
+	// adaptiveSymbols is the number of symbols of the adaptive code
+	adaptiveSymbols = adaptiveEOF + 1
+	// adaptiveRawBits is the width of a symbol sent after the NYT code
+	adaptiveRawBits = 9
+	// adaptiveNodes is the size of a tree with every symbol and the NYT leaf
+	adaptiveNodes = 2*adaptiveSymbols + 1
+	// adaptiveChunkSize is how many bytes the decoder produces at a time
+	adaptiveChunkSize = 1 << 16
+)
+
+// adaptiveNode is a node of an adaptiveTree. Nodes are stored in the order of the
+// sibling property, so their index is their node number.
+type adaptiveNode struct {
+	weight int
+	parent int
+	// left and right are -1 for leaves
+	left, right int
+	// symbol is -1 for internal nodes and the NYT leaf
+	symbol int
+}
+
+// adaptiveTree is an FGK Huffman tree. Weights never decrease with the node number,
+// and siblings have adjacent numbers.
+type adaptiveTree struct {
+	nodes [adaptiveNodes]adaptiveNode
+	// leaves maps a symbol to its leaf, or 0 when the symbol hasn't been seen
+	leaves [adaptiveSymbols]int
+	nyt    int
+}
+
+const adaptiveRoot = adaptiveNodes - 1
+
+func newAdaptiveTree() *adaptiveTree {
+	t := &adaptiveTree{nyt: adaptiveRoot}
+	t.nodes[adaptiveRoot] = adaptiveNode{parent: -1, left: -1, right: -1, symbol: -1}
+	return t
+}
+
+// leaf returns the leaf coding symbol: its own leaf, or the NYT leaf for a new symbol
+func (t *adaptiveTree) leaf(symbol int) int {
+	if node := t.leaves[symbol]; node != 0 {
+		return node
+	}
+	return t.nyt
+}
+
+// update adds one occurrence of symbol to the tree
+func (t *adaptiveTree) update(symbol int) {
+	q := t.leaves[symbol]
+	if q == 0 {
+		// The NYT leaf becomes an internal node with the new NYT leaf on the left and
+		// the new symbol on the right, both weighing nothing yet
+		old := t.nyt
+		t.nyt, q = old-2, old-1
+		t.nodes[t.nyt] = adaptiveNode{parent: old, left: -1, right: -1, symbol: -1}
+		t.nodes[q] = adaptiveNode{parent: old, left: -1, right: -1, symbol: symbol}
+		t.nodes[old].left, t.nodes[old].right = t.nyt, q
+		t.leaves[symbol] = q
+	}
+
+	for {
+		// Move q to the highest number among the nodes of its weight, so that adding
+		// one keeps the weights ordered
+		leader := q
+		for leader < adaptiveRoot && t.nodes[leader+1].weight == t.nodes[q].weight {
+			leader++
+		}
+		if leader != q && leader != t.nodes[q].parent {
+			t.swap(q, leader)
+			q = leader
+		}
+
+		t.nodes[q].weight++
+		if q == adaptiveRoot {
+			return
+		}
+		q = t.nodes[q].parent
+	}
+}
+
+// swap exchanges the subtrees at nodes i and j, which have the same weight
+func (t *adaptiveTree) swap(i, j int) {
+	a, b := &t.nodes[i], &t.nodes[j]
+	a.left, b.left = b.left, a.left
+	a.right, b.right = b.right, a.right
+	a.symbol, b.symbol = b.symbol, a.symbol
+	t.adopt(i)
+	t.adopt(j)
+}
+
+// adopt points the children or the symbol of node i back at it after a swap
+func (t *adaptiveTree) adopt(i int) {
+	node := &t.nodes[i]
+	if node.left >= 0 {
+		t.nodes[node.left].parent = i
+		t.nodes[node.right].parent = i
+	} else if node.symbol >= 0 {
+		t.leaves[node.symbol] = i
+	}
+	if node.left < 0 && node.symbol < 0 {
+		t.nyt = i
+	}
+}
+
+// encode writes the code of symbol and updates the tree
+func (t *adaptiveTree) encode(w *bitWriter, symbol int) {
+	q := t.leaf(symbol)
+
+	// Walking up from the leaf gives the code backwards: collect it in 64-bit chunks,
+	// then write the chunk nearest the root first
+	var chunks [adaptiveSymbols/64 + 1]uint64
+	n := uint(0)
+	for q != adaptiveRoot {
+		parent := t.nodes[q].parent
+		if t.nodes[parent].right == q {
+			chunks[n/64] |= 1 << (n % 64)
+		}
+		n++
+		q = parent
+	}
+	if n > 0 {
+		last := (n - 1) / 64
+		w.writeBits(chunks[last], n-64*last)
+		for i := int(last) - 1; i >= 0; i-- {
+			w.writeBits(chunks[i], 64)
+		}
+	}
+
+	if t.leaves[symbol] == 0 {
+		w.writeBits(uint64(symbol), adaptiveRawBits)
+	}
+	t.update(symbol)
+}
+
+// adaptiveDecoder decodes an adaptive bitstream, reading one byte at a time so that
+// the footer after it is left unread
+type adaptiveDecoder struct {
+	tree  *adaptiveTree
+	r     *bufio.Reader
+	bits  byte
+	count uint
+	ended bool
+}
+
+func newAdaptiveDecoder(r *bufio.Reader) *adaptiveDecoder {
+	return &adaptiveDecoder{tree: newAdaptiveTree(), r: r}
+}
+
+func (d *adaptiveDecoder) readBit() (int, error) {
+	if d.count == 0 {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		d.bits, d.count = b, 8
+	}
+	d.count--
+	return int(d.bits>>d.count) & 1, nil
+}
+
+// decode returns up to adaptiveChunkSize decoded bytes. Once the EOF symbol has been
+// read it sets ended and skips the padding of the last byte.
+func (d *adaptiveDecoder) decode() ([]byte, error) {
+	var decoded []byte
+	for !d.ended && len(decoded) < adaptiveChunkSize {
+		t := d.tree
+		q := adaptiveRoot
+		for t.nodes[q].left >= 0 {
+			bit, err := d.readBit()
+			if err != nil {
+				return nil, err
+			}
+			if bit == 1 {
+				q = t.nodes[q].right
+			} else {
+				q = t.nodes[q].left
+			}
+		}
+
+		symbol := t.nodes[q].symbol
+		if q == t.nyt {
+			symbol = 0
+			for i := 0; i < adaptiveRawBits; i++ {
+				bit, err := d.readBit()
+				if err != nil {
+					return nil, err
+				}
+				symbol = symbol<<1 | bit
+			}
+			if symbol >= adaptiveSymbols || t.leaves[symbol] != 0 {
+				return nil, fmt.Errorf("%w: invalid new symbol %d in adaptive stream", ErrCorrupt, symbol)
+			}
+		}
+
+		if symbol == adaptiveEOF {
+			d.ended = true
+			d.count = 0
+			break
+		}
+		t.update(symbol)
+		decoded = append(decoded, byte(symbol))
+	}
+	return decoded, nil
+}
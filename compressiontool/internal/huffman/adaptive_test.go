@@ -0,0 +1,144 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// checkSiblingProperty fails unless weights never decrease with the node number and
+// every internal node weighs as much as its children
+func checkSiblingProperty(t *testing.T, tree *adaptiveTree) {
+	t.Helper()
+	for i := tree.nyt; i < adaptiveRoot; i++ {
+		if tree.nodes[i].weight > tree.nodes[i+1].weight {
+			t.Fatalf("Node %d weighs %d, more than node %d with %d", i, tree.nodes[i].weight, i+1, tree.nodes[i+1].weight)
+		}
+	}
+	for i := tree.nyt; i <= adaptiveRoot; i++ {
+		node := tree.nodes[i]
+		if node.left < 0 {
+			continue
+		}
+		if node.weight != tree.nodes[node.left].weight+tree.nodes[node.right].weight {
+			t.Fatalf("Node %d weighs %d, not the sum of its children", i, node.weight)
+		}
+		if tree.nodes[node.left].parent != i || tree.nodes[node.right].parent != i {
+			t.Fatalf("Children of node %d don't point back at it", i)
+		}
+	}
+}
+
+func TestAdaptiveTreeSiblingProperty(t *testing.T) {
+	tree := newAdaptiveTree()
+	for _, b := range []byte("abracadabra, mississippi and a bookkeeper") {
+		tree.update(int(b))
+		checkSiblingProperty(t, tree)
+	}
+
+	for c := 0; c < adaptiveSymbols; c++ {
+		tree.update(c)
+	}
+	checkSiblingProperty(t, tree)
+	if tree.nyt != 0 {
+		t.Errorf("Expected the NYT leaf at node 0 once every symbol was seen, got %d", tree.nyt)
+	}
+}
+
+func TestAdaptiveRoundTrip(t *testing.T) {
+	var allBytes []byte
+	for c := 0; c < 256; c++ {
+		allBytes = append(allBytes, bytes.Repeat([]byte{byte(c)}, c%7+1)...)
+	}
+
+	inputs := map[string][]byte{
+		"Empty":       {},
+		"Single byte": []byte("a"),
+		"Single run":  bytes.Repeat([]byte{'z'}, 10000),
+		"Abracadabra": []byte("abracadabra"),
+		"All bytes":   allBytes,
+		"Corpus":      readCorpus(t),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := NewWriterOptions(&buf, WriterOptions{Codec: CodecAdaptive})
+			if err != nil {
+				t.Fatalf("NewWriterOptions returned an error: %v", err)
+			}
+			// Writes of odd sizes check that the tree carries over between writes
+			for len(input) > 0 {
+				n := len(input)
+				if n > 777 {
+					n = 777
+				}
+				zw.Write(input[:n])
+				input = input[n:]
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("Close returned an error: %v", err)
+			}
+
+			zr, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			if zr.Header.Codec != CodecAdaptive {
+				t.Errorf("Expected codec %v, got %v", CodecAdaptive, zr.Header.Codec)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, inputs[name]) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(inputs[name]))
+			}
+		})
+	}
+}
+
+func TestAdaptiveWriterStreams(t *testing.T) {
+	var buf bytes.Buffer
+	zw, _ := NewWriterOptions(&buf, WriterOptions{Codec: CodecAdaptive, BlockSize: DefaultBlockSize})
+
+	// Output must appear long before a block's worth of input has been written
+	zw.Write(bytes.Repeat([]byte("streaming "), 100))
+	if buf.Len() <= len(magic)+3 {
+		t.Errorf("Expected coded output before Close, got %d bytes", buf.Len())
+	}
+}
+
+func TestAdaptiveCloseToStaticHuffman(t *testing.T) {
+	corpus := readCorpus(t)
+
+	var static, adaptive bytes.Buffer
+	zw, _ := NewWriterOptions(&static, WriterOptions{BlockSize: MaxBlockSize})
+	zw.Write(corpus)
+	zw.Close()
+	zw, _ = NewWriterOptions(&adaptive, WriterOptions{Codec: CodecAdaptive})
+	zw.Write(corpus)
+	zw.Close()
+
+	// Adaptive coding pays for learning the statistics instead of storing them, which
+	// should cost well under one percent on a large text
+	if limit := static.Len() + static.Len()/100; adaptive.Len() > limit {
+		t.Errorf("Expected at most %d bytes, got %d", limit, adaptive.Len())
+	}
+}
+
+func TestAdaptiveTruncatedStream(t *testing.T) {
+	var buf bytes.Buffer
+	zw, _ := NewWriterOptions(&buf, WriterOptions{Codec: CodecAdaptive})
+	zw.Write([]byte("abracadabra abracadabra"))
+	zw.Close()
+
+	truncated := buf.Bytes()[:buf.Len()-footerSize-2]
+	zr, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	if _, err := io.ReadAll(zr); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
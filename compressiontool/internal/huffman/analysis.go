@@ -0,0 +1,152 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"sort"
+)
+
+// Analysis describes how well Huffman coding compresses some data
+type Analysis struct {
+	// Size is the number of bytes analyzed
+	Size int64
+	// Entropy is the Shannon entropy of the byte frequencies in bits per byte, the
+	// least any code for single bytes can average
+	Entropy float64
+	// AverageCodeLength is the average length in bits of the code of a byte, for a
+	// single code over all of the data
+	AverageCodeLength float64
+	// Efficiency is Entropy divided by AverageCodeLength, 1 for a perfect code
+	Efficiency float64
+	// Modes holds the encoded size of the data with each header mode
+	Modes []ModeSize
+	// Symbols holds every byte that occurs, most frequent first
+	Symbols []SymbolStats
+}
+
+// ModeSize is the size of a container encoded with a header mode
+type ModeSize struct {
+	Mode HeaderMode
+	// Header is everything in the container but the coded data: the container header
+	// and footer, and the framing and code description of every block
+	Header int64
+	// Payload is the size of the coded data of every block
+	Payload int64
+}
+
+// Total returns the size of the container
+func (s ModeSize) Total() int64 {
+	return s.Header + s.Payload
+}
+
+// SymbolStats describes the coding of one byte value
+type SymbolStats struct {
+	Symbol byte
+	Count  int
+	// Probability is the share of the data taken by the byte
+	Probability float64
+	// Information is the ideal code length of the byte in bits, -log2(Probability)
+	Information float64
+	// Code is the Huffman code of the byte in a single code over all of the data
+	Code string
+}
+
+// Analyze reports on the Huffman coding of data. The entropy, the average code length
+// and the symbol table are for a single code over all of the data; the sizes of every
+// header mode are exactly those of a container that Writer writes with CodecHuffman,
+// the given block size and code length limit. Zero means the default for either.
+func Analyze(data []byte, blockSize, maxCodeLength int) (*Analysis, error) {
+	zw, err := NewWriterOptions(io.Discard, WriterOptions{BlockSize: blockSize, MaxCodeLength: maxCodeLength})
+	if err != nil {
+		return nil, err
+	}
+	opts := zw.opts
+
+	frequencies, err := CountFrequencies(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	a := &Analysis{Size: int64(len(data)), Efficiency: 1}
+	if len(data) > 0 {
+		root, _, err := limitTree(BuildHuffmanTree(frequencies), frequencies, opts.MaxCodeLength)
+		if err != nil {
+			return nil, err
+		}
+		codes := GenerateHuffmanCodes(root)
+		for c, count := range frequencies {
+			p := float64(count) / float64(len(data))
+			a.Entropy -= p * math.Log2(p)
+			a.AverageCodeLength += p * float64(len(codes[c]))
+			a.Symbols = append(a.Symbols, SymbolStats{Symbol: c, Count: count, Probability: p, Information: -math.Log2(p), Code: codes[c]})
+		}
+		// Data made of a single byte value needs no bits at all, which is a perfect code
+		if a.AverageCodeLength > 0 {
+			a.Efficiency = a.Entropy / a.AverageCodeLength
+		}
+	}
+	sort.Slice(a.Symbols, func(i, j int) bool {
+		x, y := a.Symbols[i], a.Symbols[j]
+		return x.Count > y.Count || x.Count == y.Count && x.Symbol < y.Symbol
+	})
+
+	for _, mode := range []HeaderMode{CanonicalHeader, FrequencyTableHeader, TreeHeader} {
+		size := ModeSize{Mode: mode, Header: int64(len(magic)) + 3 + 1 + footerSize}
+		for start := 0; start < len(data); start += opts.BlockSize {
+			end := start + opts.BlockSize
+			if end > len(data) {
+				end = len(data)
+			}
+			header, payload, err := encodedBlockSize(data[start:end], mode, opts.MaxCodeLength)
+			if err != nil {
+				return nil, err
+			}
+			size.Header += header
+			size.Payload += payload
+		}
+		a.Modes = append(a.Modes, size)
+	}
+	return a, nil
+}
+
+// encodedBlockSize returns the size of everything but the payload, and the size of the
+// payload, of the block encodeBlock writes for data
+func encodedBlockSize(data []byte, mode HeaderMode, maxCodeLength int) (header, payload int64, err error) {
+	frequencies, err := CountFrequencies(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	root, limited, err := limitTree(BuildHuffmanTree(frequencies), frequencies, maxCodeLength)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var description bytes.Buffer
+	switch mode {
+	case CanonicalHeader:
+		err = WriteCodeLengths(CodeLengths(root), &description)
+	case TreeHeader:
+		err = WriteTree(root, &description)
+	default:
+		if limited {
+			description.WriteByte(byte(maxCodeLength))
+		}
+		err = WriteFrequencyTable(frequencies, &description)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Canonical codes have the same lengths as the codes of the tree
+	bits := int64(0)
+	for c, code := range NewCodeTable(root) {
+		bits += int64(frequencies[byte(c)]) * int64(code.Len)
+	}
+	payload = (bits + 7) / 8
+
+	var uvarint [binary.MaxVarintLen64]byte
+	header = 1 + int64(binary.PutUvarint(uvarint[:], uint64(len(data)))) + int64(description.Len()) +
+		int64(binary.PutUvarint(uvarint[:], uint64(payload)))
+	return header, payload, nil
+}
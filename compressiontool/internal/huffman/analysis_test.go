@@ -0,0 +1,70 @@
+package huffman
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	// Probabilities that are powers of two have a perfect Huffman code
+	a, err := Analyze([]byte("aaaabbcd"), 0, 0)
+	if err != nil {
+		t.Fatalf("Analyze returned an error: %v", err)
+	}
+
+	if a.Size != 8 || a.Entropy != 1.75 || a.AverageCodeLength != 1.75 || a.Efficiency != 1 {
+		t.Errorf("Unexpected analysis %+v", a)
+	}
+	want := []SymbolStats{
+		{Symbol: 'a', Count: 4, Probability: 0.5, Information: 1, Code: "0"},
+		{Symbol: 'b', Count: 2, Probability: 0.25, Information: 2, Code: "10"},
+		{Symbol: 'c', Count: 1, Probability: 0.125, Information: 3, Code: "110"},
+		{Symbol: 'd', Count: 1, Probability: 0.125, Information: 3, Code: "111"},
+	}
+	if len(a.Symbols) != len(want) {
+		t.Fatalf("Expected %d symbols, got %d", len(want), len(a.Symbols))
+	}
+	for i := range want {
+		if a.Symbols[i] != want[i] {
+			t.Errorf("Symbol %d: expected %+v, got %+v", i, want[i], a.Symbols[i])
+		}
+	}
+}
+
+func TestAnalyzeEfficiency(t *testing.T) {
+	a, err := Analyze(readCorpus(t), 0, 0)
+	if err != nil {
+		t.Fatalf("Analyze returned an error: %v", err)
+	}
+	if a.AverageCodeLength < a.Entropy || a.AverageCodeLength > a.Entropy+1 {
+		t.Errorf("Average code length %f is outside [%f, %f]", a.AverageCodeLength, a.Entropy, a.Entropy+1)
+	}
+	if math.Abs(a.Efficiency-a.Entropy/a.AverageCodeLength) > 1e-12 || a.Efficiency > 1 {
+		t.Errorf("Unexpected efficiency %f", a.Efficiency)
+	}
+}
+
+func TestAnalyzeMatchesEncodedSize(t *testing.T) {
+	inputs := map[string][]byte{
+		"Empty":         {},
+		"Single symbol": bytes.Repeat([]byte{'a'}, 5000),
+		"Corpus":        readCorpus(t)[:300000],
+	}
+
+	for name, input := range inputs {
+		a, err := Analyze(input, 64<<10, 9)
+		if err != nil {
+			t.Fatalf("Analyze returned an error: %v", err)
+		}
+		for _, size := range a.Modes {
+			var buf bytes.Buffer
+			zw, _ := NewWriterOptions(&buf, WriterOptions{Header: size.Mode, BlockSize: 64 << 10, MaxCodeLength: 9})
+			zw.Write(input)
+			zw.Close()
+			if size.Total() != int64(buf.Len()) {
+				t.Errorf("%s with %s headers: expected %d bytes, Analyze reported %d", name, size.Mode, buf.Len(), size.Total())
+			}
+		}
+	}
+}
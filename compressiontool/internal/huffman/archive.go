@@ -0,0 +1,300 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// An archive stores many files, each compressed independently as a container, and is
+// laid out as
+//
+//	magic "HUFA" | version (1 byte)
+//	the container of every file entry, one after another
+//	directory
+//	directory offset (uint64 LE) | magic "HUFA"
+//
+// The directory is written last, like the central directory of a zip file, so that an
+// archive can be written in one pass and listed without decompressing anything. It is
+// the uvarint number of entries followed, for every entry, by the uvarint length of the
+// path, the path, the uvarint mode, the varint modification time in Unix nanoseconds,
+// the uvarint original size and the uvarint compressed size. Directory entries have no
+// container and a compressed size of zero.
+
+var archiveMagic = [4]byte{'H', 'U', 'F', 'A'}
+
+// archiveVersion is the archive version written by ArchiveWriter
+const archiveVersion = 1
+
+// archiveTrailerSize is the size of the trailing directory offset and magic
+const archiveTrailerSize = 12
+
+// ErrArchive is returned when the input is not an archive
+var ErrArchive = errors.New("huffman: not an archive")
+
+// ArchiveEntry describes a file or directory stored in an archive
+type ArchiveEntry struct {
+	// Path is slash separated and relative to the archive root
+	Path    string
+	Mode    fs.FileMode
+	ModTime time.Time
+	// Size is the original size of the file
+	Size int64
+	// CompressedSize is the size of the file's container in the archive
+	CompressedSize int64
+
+	offset int64
+}
+
+// ArchiveWriter writes an archive, compressing every file added to it
+type ArchiveWriter struct {
+	w           io.Writer
+	opts        WriterOptions
+	entries     []ArchiveEntry
+	offset      int64
+	wroteHeader bool
+	err         error
+}
+
+// NewArchiveWriter returns an ArchiveWriter that writes to w, compressing files with opts
+func NewArchiveWriter(w io.Writer, opts WriterOptions) *ArchiveWriter {
+	return &ArchiveWriter{w: w, opts: opts}
+}
+
+// Add stores entry in the archive. The contents of a file are read from r; directories
+// have none and r is ignored. Size and CompressedSize are filled in by Add.
+func (aw *ArchiveWriter) Add(entry ArchiveEntry, r io.Reader) error {
+	if aw.err != nil {
+		return aw.err
+	}
+	if err := validArchivePath(entry.Path); err != nil {
+		return err
+	}
+	if !aw.wroteHeader {
+		aw.wroteHeader = true
+		if err := aw.write(append(archiveMagic[:], archiveVersion)); err != nil {
+			return err
+		}
+	}
+
+	entry.offset = aw.offset
+	entry.Size, entry.CompressedSize = 0, 0
+	if !entry.Mode.IsDir() {
+		compressed := &archiveCounter{w: aw.w}
+		zw, err := NewWriterOptions(compressed, aw.opts)
+		if err != nil {
+			aw.err = err
+			return err
+		}
+		if entry.Size, err = io.Copy(zw, r); err != nil {
+			aw.err = err
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			aw.err = err
+			return err
+		}
+		entry.CompressedSize = compressed.n
+		aw.offset += compressed.n
+	}
+
+	aw.entries = append(aw.entries, entry)
+	return nil
+}
+
+// Close writes the directory and the trailer. It does not close the underlying writer.
+func (aw *ArchiveWriter) Close() error {
+	if aw.err != nil {
+		return aw.err
+	}
+	if !aw.wroteHeader {
+		aw.wroteHeader = true
+		if err := aw.write(append(archiveMagic[:], archiveVersion)); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	writeUvarint(&buf, uint64(len(aw.entries)))
+	for _, entry := range aw.entries {
+		writeUvarint(&buf, uint64(len(entry.Path)))
+		buf.WriteString(entry.Path)
+		writeUvarint(&buf, uint64(entry.Mode))
+		var mtime [binary.MaxVarintLen64]byte
+		buf.Write(mtime[:binary.PutVarint(mtime[:], entry.ModTime.UnixNano())])
+		writeUvarint(&buf, uint64(entry.Size))
+		writeUvarint(&buf, uint64(entry.CompressedSize))
+	}
+	directoryOffset := aw.offset
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(directoryOffset)))
+	buf.Write(archiveMagic[:])
+	if err := aw.write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	aw.err = errors.New("huffman: write to closed ArchiveWriter")
+	return nil
+}
+
+func (aw *ArchiveWriter) write(p []byte) error {
+	n, err := aw.w.Write(p)
+	aw.offset += int64(n)
+	if err != nil {
+		aw.err = err
+	}
+	return err
+}
+
+// archiveCounter counts the bytes of a container written into the archive
+type archiveCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *archiveCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ArchiveReader reads the directory of an archive and opens its entries
+type ArchiveReader struct {
+	Entries []ArchiveEntry
+
+	r    io.ReaderAt
+	opts ReaderOptions
+}
+
+// NewArchiveReader reads the directory of the archive of the given size in r
+func NewArchiveReader(r io.ReaderAt, size int64, opts ReaderOptions) (*ArchiveReader, error) {
+	if size < int64(len(archiveMagic))+1+archiveTrailerSize {
+		return nil, ErrArchive
+	}
+	var head [len(archiveMagic) + 1]byte
+	if _, err := r.ReadAt(head[:], 0); err != nil {
+		return nil, err
+	}
+	var trailer [archiveTrailerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-archiveTrailerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(head[:len(archiveMagic)], archiveMagic[:]) || !bytes.Equal(trailer[8:], archiveMagic[:]) {
+		return nil, ErrArchive
+	}
+	if head[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("huffman: unsupported archive version %d", head[len(archiveMagic)])
+	}
+
+	directoryOffset := binary.LittleEndian.Uint64(trailer[:8])
+	directoryEnd := uint64(size - archiveTrailerSize)
+	if directoryOffset < uint64(len(head)) || directoryOffset > directoryEnd {
+		return nil, fmt.Errorf("%w: archive directory offset %d out of range", ErrCorrupt, directoryOffset)
+	}
+	directory := make([]byte, directoryEnd-directoryOffset)
+	if _, err := r.ReadAt(directory, int64(directoryOffset)); err != nil {
+		return nil, err
+	}
+
+	entries, err := readArchiveDirectory(bytes.NewReader(directory), int64(len(head)), int64(directoryOffset))
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveReader{Entries: entries, r: r, opts: opts}, nil
+}
+
+// readArchiveDirectory parses the directory of an archive whose containers run from
+// start to end
+func readArchiveDirectory(r *bytes.Reader, start, end int64) ([]ArchiveEntry, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	// Every entry takes at least six bytes
+	if count > uint64(r.Len())/6 {
+		return nil, fmt.Errorf("%w: archive directory with %d entries", ErrCorrupt, count)
+	}
+
+	entries := make([]ArchiveEntry, count)
+	offset := start
+	for i := range entries {
+		pathLen, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if pathLen > uint64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		name := make([]byte, pathLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, noEOF(err)
+		}
+		mode, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		mtime, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		compressedSize, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+
+		entry := ArchiveEntry{
+			Path:           string(name),
+			Mode:           fs.FileMode(mode),
+			ModTime:        time.Unix(0, mtime),
+			Size:           int64(size),
+			CompressedSize: int64(compressedSize),
+			offset:         offset,
+		}
+		if err := validArchivePath(entry.Path); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		if mode > uint64(^uint32(0)) || size > 1<<62 || compressedSize > uint64(end-offset) {
+			return nil, fmt.Errorf("%w: invalid archive entry %q", ErrCorrupt, entry.Path)
+		}
+		if entry.Mode.IsDir() && compressedSize != 0 {
+			return nil, fmt.Errorf("%w: directory %q has contents", ErrCorrupt, entry.Path)
+		}
+		offset += entry.CompressedSize
+		entries[i] = entry
+	}
+	if offset != end {
+		return nil, fmt.Errorf("%w: archive entries don't fill the archive", ErrCorrupt)
+	}
+	return entries, nil
+}
+
+// Open returns a Reader that decompresses the file of entry i
+func (ar *ArchiveReader) Open(i int) (*Reader, error) {
+	entry := ar.Entries[i]
+	if entry.Mode.IsDir() {
+		return nil, fmt.Errorf("huffman: %s is a directory", entry.Path)
+	}
+	return NewReaderOptions(io.NewSectionReader(ar.r, entry.offset, entry.CompressedSize), ar.opts)
+}
+
+// validArchivePath rejects paths that could escape the directory an archive is
+// extracted to. Paths are slash separated on every system, and backslashes, colons and
+// names that aren't local once converted with filepath.FromSlash, like Windows drive
+// letters and reserved names, are rejected too.
+func validArchivePath(p string) error {
+	if p == "" || p == "." || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") ||
+		strings.ContainsAny(p, `\:`) || !filepath.IsLocal(filepath.FromSlash(p)) {
+		return fmt.Errorf("huffman: invalid archive path %q", p)
+	}
+	return nil
+}
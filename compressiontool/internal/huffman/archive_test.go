@@ -0,0 +1,113 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	mtime := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	files := []struct {
+		entry ArchiveEntry
+		data  []byte
+	}{
+		{ArchiveEntry{Path: "docs", Mode: fs.ModeDir | 0o755, ModTime: mtime}, nil},
+		{ArchiveEntry{Path: "docs/readme.txt", Mode: 0o644, ModTime: mtime}, []byte("abracadabra abracadabra")},
+		{ArchiveEntry{Path: "docs/empty", Mode: 0o600, ModTime: mtime}, []byte{}},
+		{ArchiveEntry{Path: "corpus.txt", Mode: 0o640, ModTime: mtime.Add(time.Hour)}, readCorpus(t)},
+	}
+
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf, WriterOptions{})
+	for _, f := range files {
+		if err := aw.Add(f.entry, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("Add returned an error: %v", err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+
+	ar, err := NewArchiveReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ReaderOptions{})
+	if err != nil {
+		t.Fatalf("NewArchiveReader returned an error: %v", err)
+	}
+	if len(ar.Entries) != len(files) {
+		t.Fatalf("Expected %d entries, got %d", len(files), len(ar.Entries))
+	}
+
+	for i, f := range files {
+		entry := ar.Entries[i]
+		if entry.Path != f.entry.Path || entry.Mode != f.entry.Mode || !entry.ModTime.Equal(f.entry.ModTime) || entry.Size != int64(len(f.data)) {
+			t.Errorf("Entry %d: expected %+v with size %d, got %+v", i, f.entry, len(f.data), entry)
+		}
+		if entry.Mode.IsDir() {
+			continue
+		}
+
+		zr, err := ar.Open(i)
+		if err != nil {
+			t.Fatalf("Open(%d) returned an error: %v", i, err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Reading %s returned an error: %v", entry.Path, err)
+		}
+		if !bytes.Equal(data, f.data) {
+			t.Errorf("%s doesn't match. Got %d bytes, want %d", entry.Path, len(data), len(f.data))
+		}
+	}
+}
+
+func TestArchiveRejectsUnsafePaths(t *testing.T) {
+	paths := []string{"", ".", "..", "../etc/passwd", "/etc/passwd", "a/../../b", "a//b", `..\..\evil`, `a\b`, "C:evil", "a/b:c"}
+	if runtime.GOOS == "windows" {
+		// Reserved names are only rejected by filepath.IsLocal on Windows
+		paths = append(paths, "NUL", "a/aux")
+	}
+	for _, path := range paths {
+		aw := NewArchiveWriter(io.Discard, WriterOptions{})
+		if err := aw.Add(ArchiveEntry{Path: path}, bytes.NewReader(nil)); err == nil {
+			t.Errorf("Expected an error adding %q", path)
+		}
+	}
+}
+
+func TestArchiveRejectsInvalidInput(t *testing.T) {
+	var buf bytes.Buffer
+	aw := NewArchiveWriter(&buf, WriterOptions{})
+	if err := aw.Add(ArchiveEntry{Path: "a.txt"}, bytes.NewReader([]byte("hello"))); err != nil {
+		t.Fatalf("Add returned an error: %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	valid := buf.Bytes()
+
+	badOffset := append([]byte{}, valid...)
+	badOffset[len(badOffset)-archiveTrailerSize] ^= 0xff
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"Container", encodeString(t, "hello"), ErrArchive},
+		{"Truncated", valid[:len(valid)-1], ErrArchive},
+		{"Directory offset", badOffset, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewArchiveReader(bytes.NewReader(tt.input), int64(len(tt.input)), ReaderOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package huffman
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// decodeTreeWalk is the original bit-by-bit decoder, kept as the baseline the table
+// decoder is benchmarked and checked against
+func decodeTreeWalk(input []byte, root *Node[byte]) ([]byte, error) {
+	var decoded []byte
+	node := root
+
+	for _, b := range input {
+		for i := 7; i >= 0; i-- {
+			if len(decoded) == root.Freq {
+				return decoded, nil
+			}
+
+			if (b>>i)&1 == 0 {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+			if node == nil {
+				return nil, fmt.Errorf("invalid encoded data")
+			}
+
+			if node.Left == nil && node.Right == nil {
+				decoded = append(decoded, node.Char)
+				node = root
+			}
+		}
+	}
+
+	if len(decoded) < root.Freq {
+		return nil, fmt.Errorf("unexpected end of input")
+	}
+	return decoded, nil
+}
+
+// encodeStringCodes is the original encoder that walks the '0' and '1' characters of
+// each code, kept as the baseline for the packed encoder
+func encodeStringCodes(input []byte, codes HuffmanCode) []byte {
+	var encoded []byte
+	var currentByte byte
+	bitCount := 0
+
+	for _, b := range input {
+		for _, bit := range codes[b] {
+			if bit == '1' {
+				currentByte |= 1 << (7 - bitCount)
+			}
+			bitCount++
+			if bitCount == 8 {
+				encoded = append(encoded, currentByte)
+				currentByte = 0
+				bitCount = 0
+			}
+		}
+	}
+
+	if bitCount > 0 {
+		encoded = append(encoded, currentByte)
+	}
+	return encoded
+}
+
+func BenchmarkEncodeStringCodes(b *testing.B) {
+	input := readCorpus(b)
+	frequencies, _ := CountFrequencies(bytes.NewReader(input))
+	codes := GenerateHuffmanCodes(BuildHuffmanTree(frequencies))
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		encodeStringCodes(input, codes)
+	}
+}
+
+func BenchmarkEncodeCodeTable(b *testing.B) {
+	input := readCorpus(b)
+	frequencies, _ := CountFrequencies(bytes.NewReader(input))
+	table := NewCodeTable(BuildHuffmanTree(frequencies))
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Encode(input)
+	}
+}
+
+func BenchmarkWriter(b *testing.B) {
+	input := readCorpus(b)
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zw := NewWriter(io.Discard)
+		zw.Write(input)
+		if err := zw.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecode(b *testing.B, decode func([]byte, *Node[byte]) ([]byte, error)) {
+	input := readCorpus(b)
+	frequencies, _ := CountFrequencies(bytes.NewReader(input))
+	root := BuildHuffmanTree(frequencies)
+	encoded := EncodeText(input, GenerateHuffmanCodes(root))
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decode(encoded, root); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeTreeWalk(b *testing.B) {
+	benchmarkDecode(b, decodeTreeWalk)
+}
+
+func BenchmarkDecodeTable(b *testing.B) {
+	benchmarkDecode(b, DecodeText)
+}
+
+func BenchmarkReader(b *testing.B) {
+	input := readCorpus(b)
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	zw.Write(input)
+	zw.Close()
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zr, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
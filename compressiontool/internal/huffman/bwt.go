@@ -0,0 +1,385 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// A BWT block runs its data through the pipeline of bzip2: the Burrows-Wheeler
+// transform groups bytes that occur in similar contexts, move-to-front turns those
+// groups into runs of small numbers, and runs of zeros are shortened before an ordinary
+// Huffman block codes the result.
+//
+// The block holds the type, the uvarint length of the original data, the uvarint
+// primary index of the transform, and a nested Huffman block holding the symbols.
+// Symbols 0 and 1 (RUNA and RUNB) spell out the length of a run of zeros in bijective
+// base 2, move-to-front values up to 253 are stored plus one, and larger values as
+// bwtEscape followed by the value minus 254.
+
+const (
+	bwtRunA   = 0
+	bwtRunB   = 1
+	bwtEscape = 255
+)
+
+// suffixArray returns the suffix array of text, whose last symbol must be a unique
+// smallest sentinel 0 and whose symbols are below k, using the SA-IS algorithm of
+// Nong, Zhang and Chan
+func suffixArray(text []int32, k int) []int32 {
+	n := len(text)
+	sa := make([]int32, n)
+	if n == 1 {
+		return sa
+	}
+
+	// sType[i] reports whether suffix i is smaller than suffix i+1
+	sType := make([]bool, n)
+	sType[n-1] = true
+	for i := n - 2; i >= 0; i-- {
+		sType[i] = text[i] < text[i+1] || text[i] == text[i+1] && sType[i+1]
+	}
+	isLMS := func(i int) bool {
+		return i > 0 && sType[i] && !sType[i-1]
+	}
+
+	counts := make([]int32, k)
+	for _, c := range text {
+		counts[c]++
+	}
+	buckets := make([]int32, k)
+	bucketStarts := func() {
+		sum := int32(0)
+		for c, count := range counts {
+			buckets[c] = sum
+			sum += count
+		}
+	}
+	bucketEnds := func() {
+		sum := int32(0)
+		for c, count := range counts {
+			sum += count
+			buckets[c] = sum
+		}
+	}
+	induce := func() {
+		bucketStarts()
+		for i := 0; i < n; i++ {
+			if j := sa[i] - 1; sa[i] > 0 && !sType[j] {
+				sa[buckets[text[j]]] = j
+				buckets[text[j]]++
+			}
+		}
+		bucketEnds()
+		for i := n - 1; i >= 0; i-- {
+			if j := sa[i] - 1; sa[i] > 0 && sType[j] {
+				buckets[text[j]]--
+				sa[buckets[text[j]]] = j
+			}
+		}
+	}
+
+	// Sort the LMS substrings by placing them at the ends of their buckets and inducing
+	for i := range sa {
+		sa[i] = -1
+	}
+	bucketEnds()
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			buckets[text[i]]--
+			sa[buckets[text[i]]] = int32(i)
+		}
+	}
+	induce()
+
+	// Name the sorted LMS substrings, giving equal substrings equal names
+	lmsCount := 0
+	for i := 0; i < n; i++ {
+		if isLMS(int(sa[i])) {
+			sa[lmsCount] = sa[i]
+			lmsCount++
+		}
+	}
+	for i := lmsCount; i < n; i++ {
+		sa[i] = -1
+	}
+	names, previous := 0, -1
+	for i := 0; i < lmsCount; i++ {
+		pos := int(sa[i])
+		differs := previous < 0
+		for d := 0; !differs; d++ {
+			if text[pos+d] != text[previous+d] || sType[pos+d] != sType[previous+d] {
+				differs = true
+			} else if d > 0 && (isLMS(pos+d) || isLMS(previous+d)) {
+				break
+			}
+		}
+		if differs {
+			names++
+			previous = pos
+		}
+		// LMS positions are at least two apart, so pos/2 gives every one its own slot
+		sa[lmsCount+pos/2] = int32(names - 1)
+	}
+	reduced := make([]int32, 0, lmsCount)
+	for i := lmsCount; i < n; i++ {
+		if sa[i] >= 0 {
+			reduced = append(reduced, sa[i])
+		}
+	}
+
+	// Sort the LMS suffixes, recursing when the names don't already order them
+	var reducedSA []int32
+	if names < lmsCount {
+		reducedSA = suffixArray(reduced, names)
+	} else {
+		reducedSA = make([]int32, lmsCount)
+		for i, name := range reduced {
+			reducedSA[name] = int32(i)
+		}
+	}
+
+	// Induce the full order from the sorted LMS suffixes
+	lms := reduced[:0]
+	for i := 1; i < n; i++ {
+		if isLMS(i) {
+			lms = append(lms, int32(i))
+		}
+	}
+	for i := range sa {
+		sa[i] = -1
+	}
+	bucketEnds()
+	for i := lmsCount - 1; i >= 0; i-- {
+		j := lms[reducedSA[i]]
+		buckets[text[j]]--
+		sa[buckets[text[j]]] = j
+	}
+	induce()
+	return sa
+}
+
+// bwtTransform returns the Burrows-Wheeler transform of data and its primary index,
+// the row the end of data would occupy
+func bwtTransform(data []byte) ([]byte, int) {
+	// Shift the bytes up by one to make room for the sentinel
+	text := make([]int32, len(data)+1)
+	for i, b := range data {
+		text[i] = int32(b) + 1
+	}
+	sa := suffixArray(text, 257)
+
+	transformed := make([]byte, 0, len(data))
+	primary := 0
+	for i, pos := range sa {
+		if pos == 0 {
+			primary = i
+			continue
+		}
+		transformed = append(transformed, data[pos-1])
+	}
+	return transformed, primary
+}
+
+// inverseBWT undoes bwtTransform
+func inverseBWT(transformed []byte, primary int) ([]byte, error) {
+	n := len(transformed)
+	if primary < 1 || primary > n {
+		return nil, fmt.Errorf("%w: BWT primary index %d out of range", ErrCorrupt, primary)
+	}
+
+	// Row i of the sorted rotations ends in transformed[i], skipping the primary row
+	// which ends in the sentinel. lf maps each row to the row starting one byte earlier.
+	var starts [256]int
+	for _, b := range transformed {
+		starts[b]++
+	}
+	sum := 1
+	for c, count := range starts {
+		starts[c] = sum
+		sum += count
+	}
+	lf := make([]int32, n)
+	for i, b := range transformed {
+		lf[i] = int32(starts[b])
+		starts[b]++
+	}
+
+	data := make([]byte, n)
+	row := 0
+	for k := n - 1; k >= 0; k-- {
+		if row == primary {
+			return nil, fmt.Errorf("%w: BWT cycle ends early", ErrCorrupt)
+		}
+		i := row
+		if row > primary {
+			i--
+		}
+		data[k] = transformed[i]
+		row = int(lf[i])
+	}
+	if row != primary {
+		return nil, fmt.Errorf("%w: BWT cycle doesn't end at the primary index", ErrCorrupt)
+	}
+	return data, nil
+}
+
+// moveToFront replaces every byte with its position in a list of recently used bytes,
+// moving it to the front of the list
+func moveToFront(data []byte) []byte {
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+
+	out := make([]byte, len(data))
+	for i, b := range data {
+		j := 0
+		for order[j] != b {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = b
+		out[i] = byte(j)
+	}
+	return out
+}
+
+// inverseMoveToFront undoes moveToFront
+func inverseMoveToFront(positions []byte) []byte {
+	var order [256]byte
+	for i := range order {
+		order[i] = byte(i)
+	}
+
+	out := make([]byte, len(positions))
+	for i, j := range positions {
+		b := order[j]
+		copy(order[1:int(j)+1], order[:j])
+		order[0] = b
+		out[i] = b
+	}
+	return out
+}
+
+// encodeZeroRuns turns move-to-front output into BWT block symbols
+func encodeZeroRuns(positions []byte) []byte {
+	symbols := make([]byte, 0, len(positions)/2)
+	for i := 0; i < len(positions); {
+		if positions[i] == 0 {
+			run := 0
+			for i < len(positions) && positions[i] == 0 {
+				run++
+				i++
+			}
+			for run > 0 {
+				if run&1 == 1 {
+					symbols = append(symbols, bwtRunA)
+					run = (run - 1) / 2
+				} else {
+					symbols = append(symbols, bwtRunB)
+					run = (run - 2) / 2
+				}
+			}
+			continue
+		}
+
+		if v := positions[i]; v < bwtEscape-1 {
+			symbols = append(symbols, v+1)
+		} else {
+			symbols = append(symbols, bwtEscape, v-(bwtEscape-1))
+		}
+		i++
+	}
+	return symbols
+}
+
+// decodeZeroRuns undoes encodeZeroRuns, failing if the result isn't n bytes long
+func decodeZeroRuns(symbols []byte, n int) ([]byte, error) {
+	// A few run symbols code a long run, so the output grows as it's decoded
+	positions := make([]byte, 0, decodeCapacity(uint64(n), len(symbols)))
+	run, weight := 0, 1
+	for i := 0; i < len(symbols); i++ {
+		s := symbols[i]
+		if s == bwtRunA || s == bwtRunB {
+			run += weight << s
+			weight <<= 1
+			if run > n-len(positions) {
+				return nil, fmt.Errorf("%w: BWT zero run overruns the block", ErrCorrupt)
+			}
+			continue
+		}
+
+		for ; run > 0; run-- {
+			positions = append(positions, 0)
+		}
+		weight = 1
+
+		if s == bwtEscape {
+			i++
+			if i == len(symbols) || symbols[i] > 1 {
+				return nil, fmt.Errorf("%w: invalid BWT escape", ErrCorrupt)
+			}
+			s = symbols[i] + bwtEscape
+		}
+		positions = append(positions, s-1)
+	}
+	for ; run > 0; run-- {
+		positions = append(positions, 0)
+	}
+
+	if len(positions) != n {
+		return nil, fmt.Errorf("%w: BWT block decodes to %d bytes instead of %d", ErrCorrupt, len(positions), n)
+	}
+	return positions, nil
+}
+
+// encodeBWTBlock writes data as a BWT block
+func encodeBWTBlock(w *bytes.Buffer, data []byte, opts WriterOptions) error {
+	transformed, primary := bwtTransform(data)
+	symbols := encodeZeroRuns(moveToFront(transformed))
+
+	w.WriteByte(blockBWT)
+	writeUvarint(w, uint64(len(data)))
+	writeUvarint(w, uint64(primary))
+	return encodeBlock(w, symbols, opts)
+}
+
+// readBWTBlock reads the rest of a BWT block once its type has been read
+func (zr *Reader) readBWTBlock() (func() ([]byte, error), error) {
+	length, err := binary.ReadUvarint(zr.r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	primary, err := binary.ReadUvarint(zr.r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if primary > length {
+		return nil, fmt.Errorf("%w: BWT primary index %d out of range", ErrCorrupt, primary)
+	}
+
+	inner, err := zr.r.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if inner != blockTable && inner != blockTree && inner != blockCanonical && inner != blockLimitedTable {
+		return nil, fmt.Errorf("%w: BWT block holds a block of type %d", ErrCorrupt, inner)
+	}
+	decodeSymbols, err := zr.readBlock(inner)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		symbols, err := decodeSymbols()
+		if err != nil {
+			return nil, err
+		}
+		positions, err := decodeZeroRuns(symbols, int(length))
+		if err != nil {
+			return nil, err
+		}
+		return inverseBWT(inverseMoveToFront(positions), int(primary))
+	}, nil
+}
@@ -0,0 +1,117 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSuffixArrayMatchesSort(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for trial := 0; trial < 200; trial++ {
+		// Small alphabets give the repeats that make SA-IS recurse
+		n, k := 1+rng.Intn(200), 2+rng.Intn(4)
+		text := make([]int32, n+1)
+		for i := 0; i < n; i++ {
+			text[i] = int32(1 + rng.Intn(k-1))
+		}
+
+		want := make([]int32, n+1)
+		for i := range want {
+			want[i] = int32(i)
+		}
+		sort.Slice(want, func(a, b int) bool {
+			x, y := text[want[a]:], text[want[b]:]
+			for i := 0; i < len(x) && i < len(y); i++ {
+				if x[i] != y[i] {
+					return x[i] < y[i]
+				}
+			}
+			return len(x) < len(y)
+		})
+
+		if got := suffixArray(text, k); !reflect.DeepEqual(got, want) {
+			t.Fatalf("Suffix array of %v: expected %v, got %v", text, want, got)
+		}
+	}
+}
+
+func TestBWTTransform(t *testing.T) {
+	transformed, primary := bwtTransform([]byte("banana"))
+	if string(transformed) != "annbaa" || primary != 4 {
+		t.Errorf("Expected %q with primary index 4, got %q with %d", "annbaa", transformed, primary)
+	}
+
+	data, err := inverseBWT(transformed, primary)
+	if err != nil || string(data) != "banana" {
+		t.Errorf("Expected %q, got %q (error %v)", "banana", data, err)
+	}
+}
+
+func TestMoveToFrontAndZeroRuns(t *testing.T) {
+	input := []byte("aaaabbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbabababab")
+	for c := 0; c < 256; c++ {
+		input = append(input, byte(255-c))
+	}
+	input = append(input, 0xff, 0xfe, 0xff)
+
+	positions := moveToFront(input)
+	if !bytes.Equal(inverseMoveToFront(positions), input) {
+		t.Fatalf("Move-to-front didn't round trip")
+	}
+
+	symbols := encodeZeroRuns(positions)
+	decoded, err := decodeZeroRuns(symbols, len(positions))
+	if err != nil {
+		t.Fatalf("decodeZeroRuns returned an error: %v", err)
+	}
+	if !bytes.Equal(decoded, positions) {
+		t.Errorf("Zero runs didn't round trip")
+	}
+}
+
+func TestBWTRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(5)).Read(random)
+
+	inputs := map[string][]byte{
+		"Empty":         {},
+		"Single byte":   []byte("x"),
+		"Single symbol": bytes.Repeat([]byte{'a'}, 5000),
+		"Banana":        []byte("banana"),
+		"Periodic":      bytes.Repeat([]byte("abcabcabd"), 3000),
+		"Random":        random,
+		"Corpus":        readCorpus(t),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := encodeCodec(t, input, CodecBWT)
+
+			zr, err := NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestBWTBeatsHuffmanOnText(t *testing.T) {
+	corpus := readCorpus(t)
+	huffman := encodeCodec(t, corpus, CodecHuffman)
+	bwt := encodeCodec(t, corpus, CodecBWT)
+
+	if len(bwt) > len(huffman)*55/100 {
+		t.Errorf("Expected the BWT pipeline to save at least 45%% over %d bytes, got %d", len(huffman), len(bwt))
+	}
+}
@@ -0,0 +1,202 @@
+package huffman
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxCanonicalLength is the longest code length a canonical code table may contain
+const maxCanonicalLength = 64
+
+// CodeLengths returns the depth of every leaf in the tree, indexed by symbol. A tree
+// made of a single leaf gets length 1 so that the symbol still shows up in the table.
+func CodeLengths(root *Node[byte]) [256]uint8 {
+	var lengths [256]uint8
+	if root == nil {
+		return lengths
+	}
+	if root.Left == nil && root.Right == nil {
+		lengths[root.Char] = 1
+		return lengths
+	}
+	codeLengthsRecursive(root, 0, &lengths)
+	return lengths
+}
+
+func codeLengthsRecursive(node *Node[byte], depth uint8, lengths *[256]uint8) {
+	if node == nil {
+		return
+	}
+	if node.Left == nil && node.Right == nil {
+		lengths[node.Char] = depth
+		return
+	}
+	codeLengthsRecursive(node.Left, depth+1, lengths)
+	codeLengthsRecursive(node.Right, depth+1, lengths)
+}
+
+// CanonicalCodes assigns canonical Huffman codes from code lengths. Shorter codes come
+// first and codes of the same length are assigned in symbol order, as in DEFLATE, so
+// the lengths alone are enough to rebuild the codes. A lone symbol gets the empty code,
+// matching what GenerateHuffmanCodes returns for a single-leaf tree.
+func CanonicalCodes(lengths [256]uint8) HuffmanCode {
+	table := CanonicalCodeTable(lengths)
+	codes := make(HuffmanCode)
+	for char, length := range lengths {
+		if length > 0 {
+			codes[byte(char)] = table[char].String()
+		}
+	}
+	return codes
+}
+
+// canonicalFirstCodes returns the first code of every length, following RFC 1951 3.2.2
+func canonicalFirstCodes(lengths []uint8) [maxCanonicalLength + 1]uint64 {
+	var count [maxCanonicalLength + 1]uint64
+	for _, length := range lengths {
+		if length > 0 {
+			count[length]++
+		}
+	}
+
+	var nextCode [maxCanonicalLength + 1]uint64
+	code := uint64(0)
+	for bits := 1; bits <= maxCanonicalLength; bits++ {
+		code = (code + count[bits-1]) << 1
+		nextCode[bits] = code
+	}
+	return nextCode
+}
+
+// validateCodeLengths checks that the lengths describe a complete prefix code, or a
+// single symbol
+func validateCodeLengths(lengths [256]uint8) error {
+	return validateLengths(lengths[:])
+}
+
+// validateLengths is validateCodeLengths for an alphabet of any size
+func validateLengths(lengths []uint8) error {
+	var count [maxCanonicalLength + 1]int
+	symbols := 0
+	for _, length := range lengths {
+		if length > maxCanonicalLength {
+			return fmt.Errorf("%w: code length %d exceeds %d", ErrCorrupt, length, maxCanonicalLength)
+		}
+		if length > 0 {
+			count[length]++
+			symbols++
+		}
+	}
+	if symbols <= 1 {
+		return nil
+	}
+
+	// left counts the unused codes at the current length. It only grows, so once it
+	// exceeds the number of remaining symbols the code can never become complete.
+	left := 1
+	for bits := 1; bits <= maxCanonicalLength; bits++ {
+		left = left*2 - count[bits]
+		symbols -= count[bits]
+		if left < 0 {
+			return fmt.Errorf("%w: code lengths are over-subscribed", ErrCorrupt)
+		}
+		if left > symbols {
+			return fmt.Errorf("%w: code lengths are incomplete", ErrCorrupt)
+		}
+	}
+	return nil
+}
+
+// BuildCanonicalTree rebuilds the Huffman tree whose codes are CanonicalCodes(lengths).
+// The returned nodes carry no frequencies.
+func BuildCanonicalTree(lengths [256]uint8) (*Node[byte], error) {
+	if err := validateCodeLengths(lengths); err != nil {
+		return nil, err
+	}
+
+	table := CanonicalCodeTable(lengths)
+	root := &Node[byte]{}
+	symbols := 0
+	for c := 0; c < 256; c++ {
+		if lengths[c] == 0 {
+			continue
+		}
+		symbols++
+
+		code := table[c]
+		if code.Len == 0 {
+			return &Node[byte]{Char: byte(c)}, nil
+		}
+
+		node := root
+		for i := int(code.Len) - 1; i >= 0; i-- {
+			next := &node.Left
+			if (code.Bits>>uint(i))&1 == 1 {
+				next = &node.Right
+			}
+			if *next == nil {
+				*next = &Node[byte]{}
+			}
+			node = *next
+		}
+		node.Char = byte(c)
+	}
+	if symbols == 0 {
+		return nil, fmt.Errorf("%w: empty code length table", ErrCorrupt)
+	}
+	return root, nil
+}
+
+// Code length tables are run-length compressed: a byte below 0x80 is the code length of
+// the next symbol, and a byte b of 0x80 or above stands for b-0x7f symbols that don't
+// occur. Sparse alphabets like text fit in about a hundred bytes.
+const zeroRunFlag = 0x80
+
+// WriteCodeLengths writes the run-length compressed code length table to the given writer
+func WriteCodeLengths(lengths [256]uint8, w io.Writer) error {
+	var out []byte
+	for i := 0; i < len(lengths); {
+		if lengths[i] > maxCanonicalLength {
+			return fmt.Errorf("huffman: code length %d exceeds %d", lengths[i], maxCanonicalLength)
+		}
+		if lengths[i] != 0 {
+			out = append(out, lengths[i])
+			i++
+			continue
+		}
+
+		run := 0
+		for i < len(lengths) && lengths[i] == 0 && run < zeroRunFlag {
+			run++
+			i++
+		}
+		out = append(out, byte(zeroRunFlag+run-1))
+	}
+
+	_, err := w.Write(out)
+	return err
+}
+
+// ReadCodeLengths reads a code length table written by WriteCodeLengths
+func ReadCodeLengths(r io.Reader) ([256]uint8, error) {
+	var lengths [256]uint8
+	var token [1]byte
+	for i := 0; i < len(lengths); {
+		if _, err := io.ReadFull(r, token[:]); err != nil {
+			return lengths, err
+		}
+
+		if token[0] < zeroRunFlag {
+			lengths[i] = token[0]
+			i++
+			continue
+		}
+
+		run := int(token[0]) - zeroRunFlag + 1
+		if i+run > len(lengths) {
+			return lengths, fmt.Errorf("%w: code length table overruns 256 symbols", ErrCorrupt)
+		}
+		i += run
+	}
+	return lengths, nil
+}
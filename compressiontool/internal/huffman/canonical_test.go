@@ -0,0 +1,122 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCodeLengths(t *testing.T) {
+	root := BuildHuffmanTree(map[byte]int{'a': 5, 'b': 2, 'c': 1, 'd': 3})
+	lengths := CodeLengths(root)
+
+	expected := map[byte]uint8{'a': 1, 'b': 3, 'c': 3, 'd': 2}
+	for char, length := range lengths {
+		if length != expected[byte(char)] {
+			t.Errorf("For character %q, expected length %d, got %d", char, expected[byte(char)], length)
+		}
+	}
+
+	single := CodeLengths(&Node[byte]{Char: 'x', Freq: 4})
+	if single['x'] != 1 {
+		t.Errorf("Expected a lone symbol to get length 1, got %d", single['x'])
+	}
+}
+
+func TestCanonicalCodes(t *testing.T) {
+	var lengths [256]uint8
+	lengths['a'] = 1
+	lengths['b'] = 3
+	lengths['c'] = 3
+	lengths['d'] = 2
+
+	codes := CanonicalCodes(lengths)
+	expected := HuffmanCode{'a': "0", 'd': "10", 'b': "110", 'c': "111"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Errorf("Canonical codes mismatch. Got %v, want %v", codes, expected)
+	}
+
+	// Walking the rebuilt tree must give exactly the same codes
+	root, err := BuildCanonicalTree(lengths)
+	if err != nil {
+		t.Fatalf("BuildCanonicalTree returned an error: %v", err)
+	}
+	if rebuilt := GenerateHuffmanCodes(root); !reflect.DeepEqual(rebuilt, codes) {
+		t.Errorf("Codes of the rebuilt tree mismatch. Got %v, want %v", rebuilt, codes)
+	}
+}
+
+func TestCanonicalCodesMatchTreeLengths(t *testing.T) {
+	frequencies, _ := CountFrequencies(bytes.NewReader([]byte("this is an example of a huffman tree")))
+	root := BuildHuffmanTree(frequencies)
+	treeCodes := GenerateHuffmanCodes(root)
+	canonical := CanonicalCodes(CodeLengths(root))
+
+	if len(canonical) != len(treeCodes) {
+		t.Fatalf("Expected %d codes, got %d", len(treeCodes), len(canonical))
+	}
+	for char, code := range treeCodes {
+		if len(canonical[char]) != len(code) {
+			t.Errorf("For character %q, expected a %d bit code, got %q", char, len(code), canonical[char])
+		}
+	}
+}
+
+func TestWriteAndReadCodeLengths(t *testing.T) {
+	var sparse, dense [256]uint8
+	sparse['a'] = 1
+	sparse['b'] = 3
+	sparse['c'] = 3
+	sparse['d'] = 2
+	for i := range dense {
+		dense[i] = 8
+	}
+
+	tests := []struct {
+		name    string
+		lengths [256]uint8
+		size    int
+	}{
+		{"Sparse", sparse, 7},
+		{"Dense", dense, 256},
+		{"Empty", [256]uint8{}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteCodeLengths(tt.lengths, &buf); err != nil {
+				t.Fatalf("WriteCodeLengths returned an error: %v", err)
+			}
+			if buf.Len() != tt.size {
+				t.Errorf("Expected a %d byte table, got %d bytes", tt.size, buf.Len())
+			}
+
+			lengths, err := ReadCodeLengths(&buf)
+			if err != nil {
+				t.Fatalf("ReadCodeLengths returned an error: %v", err)
+			}
+			if lengths != tt.lengths {
+				t.Errorf("Read lengths don't match written lengths")
+			}
+		})
+	}
+}
+
+func TestBuildCanonicalTreeRejectsInvalidLengths(t *testing.T) {
+	var oversubscribed, incomplete [256]uint8
+	oversubscribed['a'] = 1
+	oversubscribed['b'] = 1
+	oversubscribed['c'] = 1
+	incomplete['a'] = 1
+	incomplete['b'] = 2
+
+	for name, lengths := range map[string][256]uint8{"Over-subscribed": oversubscribed, "Incomplete": incomplete} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := BuildCanonicalTree(lengths); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+			}
+		})
+	}
+}
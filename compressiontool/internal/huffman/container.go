@@ -0,0 +1,206 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A container is laid out as
+//
+//	magic "HUFZ" | version (1 byte) | flags (1 byte) | codec (1 byte)
+//	model ID (uint64 LE, only with flagModel)
+//	blocks ... | end-of-stream block
+//	block index (only with flagIndex)
+//	original size (uint64 LE) | CRC-32 of the original data (uint32 LE)
+//
+// The original size and checksum live in a footer, the same way gzip does it, because
+// a streaming Writer only knows them once the input is exhausted. Version 1 containers
+// have no codec byte and always use CodecHuffman. Before version 3 the trees of
+// frequency table blocks broke frequency ties by heap order, see buildHeapOrderTree.
+// CodecAdaptive containers hold a single adaptive bitstream in place of the blocks, see
+// adaptive.go. Containers coded with a shared Model set flagModel and name the model
+// they need, see model.go. Seekable containers set flagIndex, see index.go. Encrypted
+// containers set flagEncrypted, see encrypt.go.
+
+var magic = [4]byte{'H', 'U', 'F', 'Z'}
+
+// FormatVersion is the container version written by Writer
+const FormatVersion = 3
+
+// footerSize is the size of the trailing original size and checksum
+const footerSize = 12
+
+// flagModel marks a container whose blocks are coded with a shared Model
+const flagModel byte = 1 << 0
+
+// knownFlags is the set of flag bits this version understands
+const knownFlags = flagModel | flagIndex | flagEncrypted
+
+var (
+	// ErrHeader is returned when the input is not a Huffman container
+	ErrHeader = errors.New("huffman: not a huffman-encoded stream")
+	// ErrChecksum is returned when the decoded data doesn't match the stored size or checksum
+	ErrChecksum = errors.New("huffman: checksum mismatch")
+	// ErrCorrupt is returned when a block can't be decoded
+	ErrCorrupt = errors.New("huffman: corrupt input")
+	// ErrLimit is returned when a stream exceeds the limits set in ReaderOptions
+	ErrLimit = errors.New("huffman: decode limit exceeded")
+)
+
+// VersionError is returned for containers written by an unsupported format version
+type VersionError struct {
+	Version byte
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("huffman: unsupported format version %d", e.Version)
+}
+
+// Codec identifies how the blocks of a container are compressed
+type Codec byte
+
+const (
+	// CodecHuffman codes every block with a single Huffman code
+	CodecHuffman Codec = iota
+	// CodecLZH finds repeated strings with LZ77 and Huffman codes literals, match
+	// lengths and distances with separate codes
+	CodecLZH
+	// CodecAdaptive codes the whole stream in a single pass with an adaptive Huffman
+	// code, storing no code description at all
+	CodecAdaptive
+	// CodecRange range codes every block with its symbol frequencies, getting closer to
+	// the entropy than a Huffman code
+	CodecRange
+	// CodecContext codes every byte with a Huffman code chosen by the byte before it
+	CodecContext
+	// CodecBWT codes every block with the Burrows-Wheeler transform, move-to-front and
+	// Huffman coding, like bzip2
+	CodecBWT
+)
+
+// ParseCodec returns the codec called name
+func ParseCodec(name string) (Codec, error) {
+	for c := CodecHuffman; c.valid(); c++ {
+		if c.String() == name {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown codec %q", name)
+}
+
+func (c Codec) String() string {
+	switch c {
+	case CodecHuffman:
+		return "huffman"
+	case CodecLZH:
+		return "lzh"
+	case CodecAdaptive:
+		return "adaptive"
+	case CodecRange:
+		return "range"
+	case CodecContext:
+		return "context"
+	case CodecBWT:
+		return "bwt"
+	}
+	return fmt.Sprintf("Codec(%d)", byte(c))
+}
+
+func (c Codec) valid() bool {
+	return c <= CodecBWT
+}
+
+// Header holds the fields of a container header. Version is 0 for legacy files,
+// which predate the container format. ModelID is only set when Flags has flagModel.
+type Header struct {
+	Version byte
+	Flags   byte
+	Codec   Codec
+	ModelID uint64
+}
+
+// Legacy reports whether the stream uses the original headerless format
+func (h Header) Legacy() bool {
+	return h.Version == 0
+}
+
+// Encrypted reports whether everything after the header is encrypted
+func (h Header) Encrypted() bool {
+	return h.Flags&flagEncrypted != 0
+}
+
+func writeHeader(w io.Writer, h Header) error {
+	buf := append(magic[:], h.Version, h.Flags, byte(h.Codec))
+	if h.Flags&flagModel != 0 {
+		buf = binary.LittleEndian.AppendUint64(buf, h.ModelID)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// readHeader detects the stream format. It consumes the container header, or leaves
+// the reader untouched for a legacy stream.
+func readHeader(r *bufio.Reader) (Header, error) {
+	head, _ := r.Peek(len(magic) + 3)
+	if len(head) < len(magic) || !bytes.Equal(head[:len(magic)], magic[:]) {
+		// Legacy files start with the use-tree flag, which is a bool
+		if len(head) > 0 && head[0] <= 1 {
+			return Header{}, nil
+		}
+		return Header{}, ErrHeader
+	}
+	if len(head) < len(magic)+2 {
+		return Header{}, io.ErrUnexpectedEOF
+	}
+
+	h := Header{Version: head[4], Flags: head[5]}
+	if h.Version == 0 || h.Version > FormatVersion {
+		return Header{}, &VersionError{Version: h.Version}
+	}
+	if h.Flags&^knownFlags != 0 {
+		return Header{}, fmt.Errorf("%w: unknown flags %#x", ErrHeader, h.Flags&^knownFlags)
+	}
+
+	size := len(magic) + 2
+	if h.Version >= 2 {
+		if len(head) < size+1 {
+			return Header{}, io.ErrUnexpectedEOF
+		}
+		h.Codec = Codec(head[size])
+		size++
+	}
+	if !h.Codec.valid() {
+		return Header{}, fmt.Errorf("%w: unknown codec %d", ErrHeader, h.Codec)
+	}
+	if h.Flags&flagModel != 0 {
+		head, _ = r.Peek(size + 8)
+		if len(head) < size+8 {
+			return Header{}, io.ErrUnexpectedEOF
+		}
+		h.ModelID = binary.LittleEndian.Uint64(head[size:])
+		size += 8
+	}
+
+	r.Discard(size)
+	return h, nil
+}
+
+func writeFooter(w io.Writer, size uint64, checksum uint32) error {
+	var buf [footerSize]byte
+	binary.LittleEndian.PutUint64(buf[:8], size)
+	binary.LittleEndian.PutUint32(buf[8:], checksum)
+	_, err := w.Write(buf[:])
+	return err
+}
+
+func readFooter(r io.Reader) (size uint64, checksum uint32, err error) {
+	var buf [footerSize]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return 0, 0, noEOF(err)
+	}
+	return binary.LittleEndian.Uint64(buf[:8]), binary.LittleEndian.Uint32(buf[8:]), nil
+}
@@ -0,0 +1,375 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func encodeString(t *testing.T, input string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	if _, err := zw.Write([]byte(input)); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestContainerHeader(t *testing.T) {
+	encoded := encodeString(t, "abracadabra")
+
+	if !bytes.HasPrefix(encoded, []byte("HUFZ")) {
+		t.Fatalf("Expected container to start with the magic bytes, got %q", encoded[:4])
+	}
+
+	zr, err := NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	if zr.Header.Version != FormatVersion || zr.Header.Legacy() {
+		t.Errorf("Unexpected header %+v", zr.Header)
+	}
+}
+
+func TestReaderRejectsInvalidContainers(t *testing.T) {
+	valid := encodeString(t, "abracadabra")
+
+	withVersion := append([]byte{}, valid...)
+	withVersion[4] = FormatVersion + 1
+
+	withFlags := append([]byte{}, valid...)
+	withFlags[5] = 0x80
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"Foreign file", []byte("PK\x03\x04 not a huffman file"), ErrHeader},
+		{"Empty file", []byte{}, ErrHeader},
+		{"Unknown flags", withFlags, ErrHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	_, err := NewReader(bytes.NewReader(withVersion))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Version != FormatVersion+1 {
+		t.Errorf("Expected a VersionError for version %d, got %v", FormatVersion+1, err)
+	}
+}
+
+func TestReaderDetectsCorruption(t *testing.T) {
+	valid := encodeString(t, "abracadabra")
+
+	tests := []struct {
+		name   string
+		mutate func([]byte)
+	}{
+		{"Checksum", func(b []byte) { b[len(b)-1] ^= 0xff }},
+		{"Size", func(b []byte) { b[len(b)-footerSize] ^= 0x01 }},
+		{"Payload", func(b []byte) { b[len(b)-footerSize-2] ^= 0x40 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corrupted := append([]byte{}, valid...)
+			tt.mutate(corrupted)
+
+			zr, err := NewReader(bytes.NewReader(corrupted))
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			_, err = io.ReadAll(zr)
+			if !errors.Is(err, ErrChecksum) && !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected a checksum or corruption error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderLegacyFormat(t *testing.T) {
+	input := []byte("abracadabra")
+
+	for _, useTree := range []bool{true, false} {
+		frequencies, _ := CountFrequencies(bytes.NewReader(input))
+		root := BuildHuffmanTree(frequencies)
+		codes := GenerateHuffmanCodes(root)
+
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, useTree)
+		if useTree {
+			WriteTree(root, &buf)
+		} else {
+			WriteFrequencyTable(frequencies, &buf)
+		}
+		binary.Write(&buf, binary.LittleEndian, uint32(root.Freq))
+		buf.Write(EncodeText(input, codes))
+
+		zr, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("NewReader returned an error: %v", err)
+		}
+		if !zr.Header.Legacy() {
+			t.Errorf("Expected a legacy header, got %+v", zr.Header)
+		}
+		decoded, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Reading the legacy stream returned an error: %v", err)
+		}
+		if !bytes.Equal(decoded, input) {
+			t.Errorf("Decoded output doesn't match input. Got %s, want %s", decoded, input)
+		}
+	}
+}
+
+func TestReaderBaselineLegacyFiles(t *testing.T) {
+	pangram := "The quick brown fox jumps over the lazy dog.\n"
+	// The files were written by the encoder before the container format. The ties ones
+	// hold a frequency table with tied frequencies, so their tree can't be rebuilt.
+	tests := []struct {
+		file    string
+		want    string
+		wantErr error
+	}{
+		{"legacy_table.huf", "aaaaaaaaaaaaaaaabbbbbbbbccccdde", nil},
+		{"legacy_tree.huf", pangram, nil},
+		{"legacy_table_ties.huf", "", ErrCorrupt},
+		{"legacy_table_ties_short.huf", "", ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			stream, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			zr, err := NewReader(bytes.NewReader(stream))
+			if err == nil {
+				var decoded []byte
+				decoded, err = io.ReadAll(zr)
+				if err == nil && string(decoded) != tt.want {
+					t.Errorf("Expected %q, got %q", tt.want, decoded)
+				}
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Decoding returned an error: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decoding returned %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReaderVersion1Container(t *testing.T) {
+	encoded := encodeString(t, "abracadabra")
+
+	// Version 1 headers had no codec byte
+	v1 := append([]byte{}, encoded[:6]...)
+	v1[4] = 1
+	v1 = append(v1, encoded[7:]...)
+
+	zr, err := NewReader(bytes.NewReader(v1))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	if zr.Header.Version != 1 || zr.Header.Codec != CodecHuffman {
+		t.Errorf("Unexpected header %+v", zr.Header)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Reading the stream returned an error: %v", err)
+	}
+	if string(decoded) != "abracadabra" {
+		t.Errorf("Expected %q, got %q", "abracadabra", decoded)
+	}
+}
+
+func TestReaderRejectsUnknownCodec(t *testing.T) {
+	encoded := encodeString(t, "abracadabra")
+	encoded[6] = 0xEE
+
+	if _, err := NewReader(bytes.NewReader(encoded)); !errors.Is(err, ErrHeader) {
+		t.Errorf("Expected %v, got %v", ErrHeader, err)
+	}
+}
+
+// craftStream returns a container header followed by block and nothing else
+func craftStream(block []byte) []byte {
+	stream := append([]byte("HUFZ"), FormatVersion, 0, byte(CodecHuffman))
+	return append(stream, block...)
+}
+
+func TestReaderRejectsCraftedBlocks(t *testing.T) {
+	tree := []byte{1, 2, 0, 0, 0, 0, 1, 1, 0, 0, 0, 1, 'a', 1, 1, 0, 0, 0, 1, 'b'}
+	huge := binary.AppendUvarint(nil, 1<<62)
+	large := binary.AppendUvarint(nil, 1<<29)
+
+	table := &bytes.Buffer{}
+	WriteFrequencyTable(map[byte]int{'a': 3, 'b': 4}, table)
+
+	tests := []struct {
+		name    string
+		block   []byte
+		wantErr error
+	}{
+		{"Huge block", append([]byte{blockTree}, huge...), ErrLimit},
+		{"Huge payload", append(append([]byte{blockTree, 2}, tree...), huge...), io.ErrUnexpectedEOF},
+		{"Huge alphabet symbol", append(append(append([]byte{blockSymbols}, large...), byte(WordSymbols), 1, 0), large...), io.ErrUnexpectedEOF},
+		{"Frequencies don't match the length", append([]byte{blockTable, 8}, table.Bytes()...), ErrCorrupt},
+		{"Deep tree", append([]byte{blockTree, 2}, bytes.Repeat([]byte{1, 2, 0, 0, 0, 0}, 1000)...), ErrCorrupt},
+		{"Code length limit too small", append([]byte{blockLimitedTable, 7, 0}, table.Bytes()...), ErrCorrupt},
+		{"Code length limit too large", append([]byte{blockLimitedTable, 7, maxCanonicalLength + 1}, table.Bytes()...), ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zr, err := NewReader(bytes.NewReader(craftStream(tt.block)))
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			if _, err := io.ReadAll(zr); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	input := bytes.Repeat([]byte("abracadabra"), 1000)
+	var buf bytes.Buffer
+	zw, _ := NewWriterOptions(&buf, WriterOptions{BlockSize: 4096})
+	zw.Write(input)
+	zw.Close()
+
+	tests := []struct {
+		name    string
+		opts    ReaderOptions
+		wantErr error
+	}{
+		{"Within limits", ReaderOptions{MaxBlockSize: 4096, MaxSize: int64(len(input))}, nil},
+		{"Block too large", ReaderOptions{MaxBlockSize: 4095}, ErrLimit},
+		{"Stream too large", ReaderOptions{MaxSize: int64(len(input)) - 1}, ErrLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zr, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), tt.opts)
+			if err != nil {
+				t.Fatalf("NewReaderOptions returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input")
+			}
+		})
+	}
+
+	for _, opts := range []ReaderOptions{{MaxBlockSize: -1}, {MaxBlockSize: MaxBlockSize + 1}, {MaxSize: -1}} {
+		if _, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), opts); err == nil {
+			t.Errorf("Expected an error for options %+v", opts)
+		}
+	}
+}
+
+func TestReaderBoundsClaimedLength(t *testing.T) {
+	input := []byte("abracadabra abracadabra")
+	model, _ := TrainModel(map[byte]int{'a': 10, 'b': 4, 'r': 4, 'c': 2, 'd': 2, ' ': 1})
+
+	// Every stream claims a block of 512 MiB, within the default MaxBlockSize, but
+	// holds only the few bytes coding the input
+	testCases := []struct {
+		name   string
+		opts   WriterOptions
+		header int
+	}{
+		{"LZH", WriterOptions{Codec: CodecLZH}, 7},
+		{"Range", WriterOptions{Codec: CodecRange}, 7},
+		{"Context", WriterOptions{Codec: CodecContext}, 7},
+		{"BWT", WriterOptions{Codec: CodecBWT}, 7},
+		{"Words", WriterOptions{Symbols: WordSymbols}, 7},
+		{"Model", WriterOptions{Model: model}, 15},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, _ := NewWriterOptions(&buf, tc.opts)
+			zw.Write(input)
+			zw.Close()
+
+			encoded := buf.Bytes()
+			stream := append([]byte{}, encoded[:tc.header+1]...)
+			stream = binary.AppendUvarint(stream, 1<<29)
+			stream = append(stream, encoded[tc.header+2:]...)
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			zr, err := NewReaderOptions(bytes.NewReader(stream), ReaderOptions{Model: tc.opts.Model})
+			if err != nil {
+				t.Fatalf("NewReaderOptions returned an error: %v", err)
+			}
+			if _, err := io.ReadAll(zr); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+			}
+			runtime.ReadMemStats(&after)
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+				t.Errorf("Decoding a %d byte stream allocated %d bytes", len(stream), allocated)
+			}
+		})
+	}
+}
+
+func TestReaderVersion2TableBlocks(t *testing.T) {
+	// Version 2 rebuilt frequency table trees with heap-order tie-breaking, which gives
+	// these frequencies different codes
+	input := []byte("aabcdd")
+	freqs := map[byte]int{'a': 2, 'b': 1, 'c': 1, 'd': 2}
+	root := buildHeapOrderTree(freqs)
+	if reflect.DeepEqual(GenerateHuffmanCodes(root), GenerateHuffmanCodes(BuildHuffmanTree(freqs))) {
+		t.Fatal("Expected the two tie-breaking rules to give different codes")
+	}
+
+	var buf bytes.Buffer
+	buf.Write(append([]byte("HUFZ"), 2, 0, byte(CodecHuffman)))
+	buf.WriteByte(blockTable)
+	writeUvarint(&buf, uint64(len(input)))
+	WriteFrequencyTable(freqs, &buf)
+	payload := NewCodeTable(root).Encode(input)
+	writeUvarint(&buf, uint64(len(payload)))
+	buf.Write(payload)
+	buf.WriteByte(blockEnd)
+	writeFooter(&buf, uint64(len(input)), crc32.ChecksumIEEE(input))
+
+	zr, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Reading the stream returned an error: %v", err)
+	}
+	if !bytes.Equal(decoded, input) {
+		t.Errorf("Expected %q, got %q", input, decoded)
+	}
+}
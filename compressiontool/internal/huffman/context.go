@@ -0,0 +1,261 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A context block codes every byte with a Huffman code chosen by the byte before it,
+// using the order-1 model of CountContextFrequencies. Contexts that occur too rarely to
+// pay for their own table fall back to the order-0 code of the whole block. The first
+// byte of a block is coded in context 0.
+//
+// The block holds the type, the uvarint length of the original data, the order-0 code
+// lengths, a 32 byte bitmap of the contexts with their own table, the context tables,
+// the uvarint payload length and the payload.
+//
+// The context tables are stored compactly: every table only lists lengths for the
+// symbols of the order-0 code, since no other symbol occurs in the block, and the
+// lengths of all tables are Huffman coded together as one sequence. Most contexts use
+// only a few symbols, so the zero lengths that dominate the sequence cost about a bit
+// each. The sequence is stored as its code lengths, the uvarint length of the coded
+// sequence and the coded sequence, and left out when no context has its own table.
+
+// contextMaxCodeLength is the code length limit of context blocks, which keeps every
+// length in the context tables below 16
+const contextMaxCodeLength = 15
+
+// contextTableCost estimates the bits a context table adds to the header: about a bit
+// for every symbol the context doesn't use and a few more for every one it does
+func contextTableCost(alphabet, used int) int {
+	return alphabet + 4*used
+}
+
+// encodeContextBlock writes data as a context block
+func encodeContextBlock(w *bytes.Buffer, data []byte, opts WriterOptions) error {
+	model, err := CountContextFrequencies(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	counts := new([256][256]int)
+	var order0 [256]int
+	for context, frequencies := range model {
+		for char, count := range frequencies {
+			counts[context][char] = count
+			order0[char] += count
+		}
+	}
+
+	maxLength := opts.MaxCodeLength
+	if maxLength > contextMaxCodeLength {
+		maxLength = contextMaxCodeLength
+	}
+	order0Lengths, err := lzhCodeLengths(&order0, maxLength)
+	if err != nil {
+		return err
+	}
+	order0Table := CanonicalCodeTable(order0Lengths)
+
+	var alphabet []byte
+	for char, length := range order0Lengths {
+		if length > 0 {
+			alphabet = append(alphabet, byte(char))
+		}
+	}
+
+	// Give a context its own table only when that saves more than the table costs
+	var tables [256]*CodeTable
+	var bitmap [32]byte
+	var tableLengths []byte
+	for context := range tables {
+		tables[context] = order0Table
+		if _, ok := model[byte(context)]; !ok {
+			continue
+		}
+
+		lengths, err := lzhCodeLengths(&counts[context], maxLength)
+		if err != nil {
+			return err
+		}
+		table := CanonicalCodeTable(lengths)
+
+		own, shared, used := 0, 0, 0
+		for _, char := range alphabet {
+			count := counts[context][char]
+			own += count * int(table[char].Len)
+			shared += count * int(order0Table[char].Len)
+			if count > 0 {
+				used++
+			}
+		}
+		if own+contextTableCost(len(alphabet), used) >= shared {
+			continue
+		}
+
+		tables[context] = table
+		bitmap[context/8] |= 1 << (context % 8)
+		for _, char := range alphabet {
+			tableLengths = append(tableLengths, lengths[char])
+		}
+	}
+
+	w.WriteByte(blockContext)
+	writeUvarint(w, uint64(len(data)))
+	if err := WriteCodeLengths(order0Lengths, w); err != nil {
+		return err
+	}
+	w.Write(bitmap[:])
+	if len(tableLengths) > 0 {
+		var lengthCounts [256]int
+		for _, length := range tableLengths {
+			lengthCounts[length]++
+		}
+		lengths, err := lzhCodeLengths(&lengthCounts, maxLength)
+		if err != nil {
+			return err
+		}
+		if err := WriteCodeLengths(lengths, w); err != nil {
+			return err
+		}
+		encoded := CanonicalCodeTable(lengths).Encode(tableLengths)
+		writeUvarint(w, uint64(len(encoded)))
+		w.Write(encoded)
+	}
+
+	bw := bitWriter{out: make([]byte, 0, len(data)/3+8)}
+	previous := byte(0)
+	for _, b := range data {
+		code := tables[previous][b]
+		bw.writeBits(code.Bits, uint(code.Len))
+		previous = b
+	}
+	encoded := bw.flush()
+
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+	return nil
+}
+
+// readContextBlock reads the rest of a context block once its type has been read
+func readContextBlock(r *bufio.Reader) (func() ([]byte, error), error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	order0Lengths, err := ReadCodeLengths(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	var bitmap [32]byte
+	if _, err := io.ReadFull(r, bitmap[:]); err != nil {
+		return nil, noEOF(err)
+	}
+
+	var tableLengthsLengths [256]uint8
+	var tablePayload []byte
+	if bitmap != ([32]byte{}) {
+		if tableLengthsLengths, err = ReadCodeLengths(r); err != nil {
+			return nil, noEOF(err)
+		}
+		if tablePayload, err = readPayload(r); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		order0, err := newLengthsDecoder(order0Lengths)
+		if err != nil {
+			return nil, err
+		}
+		var alphabet []byte
+		for char, length := range order0Lengths {
+			if length > 0 {
+				alphabet = append(alphabet, byte(char))
+			}
+		}
+
+		var decoders [256]*tableDecoder
+		contexts := 0
+		for context := range decoders {
+			decoders[context] = order0
+			if bitmap[context/8]&(1<<(context%8)) != 0 {
+				contexts++
+			}
+		}
+		if contexts > 0 {
+			tableLengths, err := decodeCanonical(tableLengthsLengths, tablePayload, contexts*len(alphabet))
+			if err != nil {
+				return nil, err
+			}
+			for context := range decoders {
+				if bitmap[context/8]&(1<<(context%8)) == 0 {
+					continue
+				}
+
+				var lengths [256]uint8
+				for i, char := range alphabet {
+					if tableLengths[i] > contextMaxCodeLength {
+						return nil, fmt.Errorf("%w: context code length %d exceeds %d", ErrCorrupt, tableLengths[i], contextMaxCodeLength)
+					}
+					lengths[char] = tableLengths[i]
+				}
+				tableLengths = tableLengths[len(alphabet):]
+				if decoders[context], err = newLengthsDecoder(lengths); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// A context with a single symbol codes it in no bits, so the output grows as
+		// it's decoded
+		decoded := make([]byte, 0, decodeCapacity(length, len(payload)))
+		br := newBitReader(payload)
+		previous := byte(0)
+		for uint64(len(decoded)) < length {
+			d := decoders[previous]
+			if d == nil {
+				return nil, fmt.Errorf("%w: context %d has no code", ErrCorrupt, previous)
+			}
+			b, err := br.readSymbol(d)
+			if err != nil {
+				return nil, err
+			}
+			if br.overrun() {
+				return nil, fmt.Errorf("%w: payload ends before %d bytes were decoded", ErrCorrupt, length)
+			}
+			decoded = append(decoded, b)
+			previous = b
+		}
+		return decoded, nil
+	}, nil
+}
+
+// readPayload reads a uvarint length and that many bytes
+func readPayload(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	return readBytes(r, n)
+}
+
+// decodeCanonical decodes n symbols coded with the canonical code given by lengths
+func decodeCanonical(lengths [256]uint8, payload []byte, n int) ([]byte, error) {
+	root, err := BuildCanonicalTree(lengths)
+	if err != nil {
+		return nil, err
+	}
+	if root.Left == nil && root.Right == nil {
+		return bytes.Repeat([]byte{root.Char}, n), nil
+	}
+	root.Freq = n
+	return DecodeText(payload, root)
+}
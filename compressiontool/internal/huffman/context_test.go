@@ -0,0 +1,91 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestContextRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(3)).Read(random)
+
+	inputs := map[string][]byte{
+		"Empty":         {},
+		"Single symbol": bytes.Repeat([]byte{'a'}, 5000),
+		"Abracadabra":   []byte("abracadabra"),
+		"Alternating":   bytes.Repeat([]byte("ab"), 5000),
+		"Random":        random,
+		"Corpus":        readCorpus(t),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := encodeCodec(t, input, CodecContext)
+
+			zr, err := NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestContextBeatsSingleTableOnText(t *testing.T) {
+	corpus := readCorpus(t)
+	single := encodeCodec(t, corpus, CodecHuffman)
+	context := encodeCodec(t, corpus, CodecContext)
+
+	if len(context) > len(single)*85/100 {
+		t.Errorf("Expected order-1 coding to save at least 15%% over %d bytes, got %d", len(single), len(context))
+	}
+}
+
+// contextBitmap encodes data as a context block and returns its bitmap of contexts
+// with their own table
+func contextBitmap(t *testing.T, data []byte) [32]byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := encodeContextBlock(&buf, data, WriterOptions{MaxCodeLength: DefaultMaxCodeLength}); err != nil {
+		t.Fatalf("encodeContextBlock returned an error: %v", err)
+	}
+
+	r := bufio.NewReader(&buf)
+	r.ReadByte()
+	binary.ReadUvarint(r)
+	if _, err := ReadCodeLengths(r); err != nil {
+		t.Fatalf("ReadCodeLengths returned an error: %v", err)
+	}
+	var bitmap [32]byte
+	io.ReadFull(r, bitmap[:])
+	return bitmap
+}
+
+func TestContextSparseContextsFallBack(t *testing.T) {
+	// 'a' and 'b' nearly always follow each other, so their contexts need next to no bits,
+	// while the lone 'x' and 'y' contexts aren't worth a table
+	data := append(bytes.Repeat([]byte("ab"), 1000), "xy"...)
+	data = append(data, bytes.Repeat([]byte("ab"), 1000)...)
+
+	bitmap := contextBitmap(t, data)
+	for _, context := range []byte{'a', 'b'} {
+		if bitmap[context/8]&(1<<(context%8)) == 0 {
+			t.Errorf("Expected context %q to have its own table", context)
+		}
+	}
+	for _, context := range []byte{'x', 'y'} {
+		if bitmap[context/8]&(1<<(context%8)) != 0 {
+			t.Errorf("Expected context %q to fall back to the order-0 code", context)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package huffman
+
+import (
+	"fmt"
+)
+
+// decodeTableBits is the number of bits resolved by a single table lookup. Codes longer
+// than this finish with a short tree walk from the node the table points at.
+const decodeTableBits = 10
+
+// decodeEntry is the result of looking up decodeTableBits bits. node is the leaf that
+// was reached after length bits, or the internal node reached after all of them. A nil
+// node means the bits don't lead anywhere in the tree. Leaves copy their symbol into
+// the entry so the common case needs no pointer chasing.
+type decodeEntry struct {
+	node   *Node[byte]
+	symbol byte
+	length uint8
+	leaf   bool
+}
+
+// tableDecoder decodes Huffman codes several bits at a time using a lookup table built
+// from the tree
+type tableDecoder struct {
+	table [1 << decodeTableBits]decodeEntry
+}
+
+func newTableDecoder(root *Node[byte]) *tableDecoder {
+	d := &tableDecoder{}
+	d.fill(root, 0, 0)
+	return d
+}
+
+// fill walks the tree down to decodeTableBits levels, filling every entry whose bits
+// start with the code of node
+func (d *tableDecoder) fill(node *Node[byte], code int, depth uint8) {
+	if node == nil {
+		return
+	}
+
+	if node.Left == nil && node.Right == nil || depth == decodeTableBits {
+		shift := decodeTableBits - depth
+		start := code << shift
+		entry := decodeEntry{node: node, length: depth}
+		if node.Left == nil && node.Right == nil {
+			entry.symbol = node.Char
+			entry.leaf = true
+		}
+		for i := start; i < start+1<<shift; i++ {
+			d.table[i] = entry
+		}
+		return
+	}
+
+	d.fill(node.Left, code<<1, depth+1)
+	d.fill(node.Right, code<<1|1, depth+1)
+}
+
+// decode decodes exactly n symbols from input
+func (d *tableDecoder) decode(input []byte, n int) ([]byte, error) {
+	decoded := make([]byte, n)
+	br := newBitReader(input)
+	for i := range decoded {
+		// readSymbol is too big to inline, so its fast path is repeated in this hot loop
+		if br.count < decodeTableBits {
+			br.refill()
+		}
+		entry := d.table[br.bits>>(64-decodeTableBits)]
+		br.bits <<= entry.length
+		br.count -= uint(entry.length)
+		br.used += int(entry.length)
+
+		symbol := entry.symbol
+		if !entry.leaf {
+			var err error
+			if symbol, err = walkTree(br, entry.node); err != nil {
+				return nil, err
+			}
+		}
+		if br.overrun() {
+			return nil, fmt.Errorf("%w: expected %d symbols, decoded %d", ErrCorrupt, n, i)
+		}
+		decoded[i] = symbol
+	}
+	return decoded, nil
+}
+
+// bitReader reads Huffman codes and raw bits from a byte slice, first bit most
+// significant. Once the input runs out it reads zeros; callers check overrun to tell
+// padding from real data.
+type bitReader struct {
+	input []byte
+	pos   int
+	bits  uint64
+	count uint
+	used  int
+}
+
+func newBitReader(input []byte) *bitReader {
+	return &bitReader{input: input}
+}
+
+// refill tops the buffer up to at least 57 bits
+func (br *bitReader) refill() {
+	for br.count <= 56 {
+		var b byte
+		if br.pos < len(br.input) {
+			b = br.input[br.pos]
+		}
+		br.pos++
+		br.bits |= uint64(b) << (56 - br.count)
+		br.count += 8
+	}
+}
+
+// readSymbol decodes one symbol with the table, finishing long codes with a tree walk
+func (br *bitReader) readSymbol(d *tableDecoder) (byte, error) {
+	if br.count < decodeTableBits {
+		br.refill()
+	}
+
+	entry := d.table[br.bits>>(64-decodeTableBits)]
+	br.bits <<= entry.length
+	br.count -= uint(entry.length)
+	br.used += int(entry.length)
+	if entry.leaf {
+		return entry.symbol, nil
+	}
+	return walkTree(br, entry.node)
+}
+
+// walkTree finishes decoding a code one bit at a time, from node down to a leaf. The
+// table decoders use it for codes longer than decodeTableBits.
+func walkTree[T comparable](br *bitReader, node *Node[T]) (T, error) {
+	for node != nil && (node.Left != nil || node.Right != nil) {
+		if br.count == 0 {
+			br.refill()
+		}
+		if br.bits>>63 == 0 {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+		br.bits <<= 1
+		br.count--
+		br.used++
+	}
+
+	if node == nil {
+		var zero T
+		return zero, fmt.Errorf("%w: invalid code at bit %d", ErrCorrupt, br.used)
+	}
+	return node.Char, nil
+}
+
+// readBits reads n raw bits, n at most 32
+func (br *bitReader) readBits(n uint) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if br.count < n {
+		br.refill()
+	}
+	v := br.bits >> (64 - n)
+	br.bits <<= n
+	br.count -= n
+	br.used += int(n)
+	return v
+}
+
+// overrun reports whether more bits were read than the input holds
+func (br *bitReader) overrun() bool {
+	return br.used > len(br.input)*8
+}
@@ -0,0 +1,64 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// corpusPath is the sample text shipped with the tool
+const corpusPath = "../../135-0.txt"
+
+func readCorpus(tb testing.TB) []byte {
+	tb.Helper()
+	data, err := os.ReadFile(corpusPath)
+	if err != nil {
+		tb.Skipf("Corpus not available: %v", err)
+	}
+	return data
+}
+
+func TestTableDecoderMatchesTreeWalk(t *testing.T) {
+	inputs := map[string][]byte{
+		"Corpus":      readCorpus(t),
+		"Abracadabra": []byte("abracadabra"),
+	}
+
+	// Fibonacci frequencies give codes far longer than one table lookup
+	var deep []byte
+	fibonacci := fibonacciFrequencies(20)
+	for c := byte('A'); c < 'A'+20; c++ {
+		deep = append(deep, bytes.Repeat([]byte{c}, fibonacci[c])...)
+	}
+	inputs["Deep tree"] = deep
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			frequencies, _ := CountFrequencies(bytes.NewReader(input))
+			root := BuildHuffmanTree(frequencies)
+			encoded := EncodeText(input, GenerateHuffmanCodes(root))
+
+			walked, err := decodeTreeWalk(encoded, root)
+			if err != nil {
+				t.Fatalf("decodeTreeWalk returned an error: %v", err)
+			}
+			decoded, err := DecodeText(encoded, root)
+			if err != nil {
+				t.Fatalf("DecodeText returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, walked) || !bytes.Equal(decoded, input) {
+				t.Errorf("Table decoder output differs from the tree walk")
+			}
+		})
+	}
+}
+
+func TestTableDecoderInvalidCode(t *testing.T) {
+	// The right child is missing, so any code starting with 1 is invalid
+	root := &Node[byte]{Freq: 2, Left: &Node[byte]{Char: 'a', Freq: 2}}
+
+	if _, err := DecodeText([]byte{0b10000000}, root); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+	}
+}
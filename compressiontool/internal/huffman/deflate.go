@@ -0,0 +1,375 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// DEFLATE (RFC 1951) codes the same literals and matches as CodecLZH, with a
+// literal/length alphabet of 286 symbols and a distance alphabet of 30. The code lengths
+// of both are themselves Huffman coded with a 19 symbol code length alphabet.
+
+const (
+	// deflateMaxCodeLength is the longest literal/length or distance code DEFLATE allows
+	deflateMaxCodeLength = 15
+	// deflateMaxCodeLengthCodeLength is the longest code in the code length alphabet
+	deflateMaxCodeLengthCodeLength = 7
+	// deflateEndOfBlock is the literal/length symbol ending a block
+	deflateEndOfBlock = 256
+	// deflateLiteralCodes is the number of literal/length symbols a block may use
+	deflateLiteralCodes = 286
+	// deflateDistanceCodes is the number of distance symbols a block may use
+	deflateDistanceCodes = 30
+	// deflateMaxStored is the most bytes a stored block holds
+	deflateMaxStored = 1<<16 - 1
+)
+
+// Block types, from the BTYPE field of the block header
+const (
+	deflateStored = iota
+	deflateFixed
+	deflateDynamic
+)
+
+// Code length symbols 16 to 18 repeat the previous length or runs of zeros
+const (
+	deflateRepeatPrevious = 16
+	deflateRepeatZero     = 17
+	deflateRepeatZeroLong = 18
+)
+
+// deflateCodeLengthOrder is the order code length code lengths are stored in
+var deflateCodeLengthOrder = [19]uint8{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// deflateLengthBase and deflateLengthExtra give the shortest match length and the
+// number of extra bits of length symbols 257 and up
+var (
+	deflateLengthBase = [29]uint16{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31,
+		35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258,
+	}
+	deflateLengthExtra = [29]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2,
+		3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+	}
+)
+
+// deflateDistanceBase and deflateDistanceExtra give the shortest distance and the
+// number of extra bits of every distance symbol
+var (
+	deflateDistanceBase = [30]uint16{
+		1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193,
+		257, 385, 513, 769, 1025, 1537, 2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577,
+	}
+	deflateDistanceExtra = [30]uint8{
+		0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6,
+		7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13,
+	}
+)
+
+// deflateLengthCode returns the length symbol for a match length of 3 to 258, and the
+// extra bits stored after it
+func deflateLengthCode(length int) (symbol int, extra uint64, extraBits uint) {
+	if length == 258 {
+		return 285, 0, 0
+	}
+	x := uint(length - 3)
+	if x < 8 {
+		return 257 + int(x), 0, 0
+	}
+	// Above the first eight, every group of four symbols doubles the range they cover
+	n := uint(bits.Len(x) - 1)
+	extraBits = n - 2
+	return 257 + int(4*(n-1)+(x>>extraBits)&3), uint64(x & (1<<extraBits - 1)), extraBits
+}
+
+// deflateDistanceCode returns the distance symbol for a distance of 1 to 32768, and the
+// extra bits stored after it
+func deflateDistanceCode(distance int) (symbol int, extra uint64, extraBits uint) {
+	x := uint(distance - 1)
+	if x < 4 {
+		return int(x), 0, 0
+	}
+	// Above the first four, every pair of symbols doubles the range they cover
+	n := uint(bits.Len(x) - 1)
+	extraBits = n - 1
+	return int(2*n + (x>>extraBits)&1), uint64(x & (1<<extraBits - 1)), extraBits
+}
+
+// deflateCodeLengths returns length-limited code lengths for counts. Alphabets with
+// fewer than two symbols get dummy ones, so that every code is complete, which keeps
+// strict decoders happy.
+func deflateCodeLengths(counts []int, maxLength int) []uint8 {
+	used := 0
+	for _, count := range counts {
+		if count > 0 {
+			used++
+		}
+	}
+	for s := 0; used < 2; s++ {
+		if counts[s] == 0 {
+			counts[s] = 1
+			used++
+		}
+	}
+
+	var leaves []pmItem
+	for s, count := range counts {
+		if count > 0 {
+			leaves = append(leaves, pmItem{weight: count, symbols: []uint16{uint16(s)}})
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	// The alphabets are small enough for maxLength that this can't fail
+	if err := packageMerge(leaves, maxLength, lengths); err != nil {
+		panic(err)
+	}
+	return lengths
+}
+
+// deflateCodes returns the canonical codes for lengths, bit reversed since DEFLATE
+// packs Huffman codes starting from their most significant bit into the least
+// significant end of each byte
+func deflateCodes(lengths []uint8) []Code {
+	nextCode := canonicalFirstCodes(lengths)
+	codes := make([]Code, len(lengths))
+	for s, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := nextCode[length]
+		nextCode[length]++
+		codes[s] = Code{Bits: uint64(bits.Reverse16(uint16(code)) >> (16 - length)), Len: length}
+	}
+	return codes
+}
+
+// deflateCodeLengthToken is a symbol of the code length alphabet with its extra bits
+type deflateCodeLengthToken struct {
+	symbol uint8
+	extra  uint8
+}
+
+// deflateCodeLengthTokens run-length codes the literal/length and distance code lengths
+func deflateCodeLengthTokens(lengths []uint8) []deflateCodeLengthToken {
+	var tokens []deflateCodeLengthToken
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+
+		if length == 0 {
+			for run >= 11 {
+				n := run
+				if n > 138 {
+					n = 138
+				}
+				tokens = append(tokens, deflateCodeLengthToken{deflateRepeatZeroLong, uint8(n - 11)})
+				run -= n
+			}
+			if run >= 3 {
+				tokens = append(tokens, deflateCodeLengthToken{deflateRepeatZero, uint8(run - 3)})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, deflateCodeLengthToken{symbol: length})
+			run--
+			for run >= 3 {
+				n := run
+				if n > 6 {
+					n = 6
+				}
+				tokens = append(tokens, deflateCodeLengthToken{deflateRepeatPrevious, uint8(n - 3)})
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, deflateCodeLengthToken{symbol: length})
+		}
+	}
+	return tokens
+}
+
+// deflateCodeLengthExtraBits is the number of extra bits after each code length symbol
+func deflateCodeLengthExtraBits(symbol uint8) uint {
+	switch symbol {
+	case deflateRepeatPrevious:
+		return 2
+	case deflateRepeatZero:
+		return 3
+	case deflateRepeatZeroLong:
+		return 7
+	}
+	return 0
+}
+
+// writeDeflateBlock writes data[start:] as one or more DEFLATE blocks, with matches
+// allowed to reach back into data[:start]. It picks a dynamic Huffman block, or stored
+// blocks when those come out smaller.
+func writeDeflateBlock(w *lsbWriter, data []byte, start int, final bool) {
+	if start == len(data) {
+		writeStoredBlocks(w, nil, final)
+		return
+	}
+
+	tokens := findMatchesFrom(data, start)
+
+	literalCounts := make([]int, deflateLiteralCodes)
+	distanceCounts := make([]int, deflateDistanceCodes)
+	for _, t := range tokens {
+		if t.length == 0 {
+			literalCounts[t.literal]++
+			continue
+		}
+		symbol, _, _ := deflateLengthCode(int(t.length))
+		literalCounts[symbol]++
+		symbol, _, _ = deflateDistanceCode(int(t.distance))
+		distanceCounts[symbol]++
+	}
+	literalCounts[deflateEndOfBlock]++
+
+	literalLengths := deflateCodeLengths(literalCounts, deflateMaxCodeLength)
+	distanceLengths := deflateCodeLengths(distanceCounts, deflateMaxCodeLength)
+
+	literalCount := deflateLiteralCodes
+	for literalCount > 257 && literalLengths[literalCount-1] == 0 {
+		literalCount--
+	}
+	distanceCount := deflateDistanceCodes
+	for distanceCount > 1 && distanceLengths[distanceCount-1] == 0 {
+		distanceCount--
+	}
+
+	lengthTokens := deflateCodeLengthTokens(append(literalLengths[:literalCount:literalCount], distanceLengths[:distanceCount]...))
+	codeLengthCounts := make([]int, len(deflateCodeLengthOrder))
+	for _, t := range lengthTokens {
+		codeLengthCounts[t.symbol]++
+	}
+	codeLengthLengths := deflateCodeLengths(codeLengthCounts, deflateMaxCodeLengthCodeLength)
+	codeLengthCount := len(deflateCodeLengthOrder)
+	for codeLengthCount > 4 && codeLengthLengths[deflateCodeLengthOrder[codeLengthCount-1]] == 0 {
+		codeLengthCount--
+	}
+
+	// Compare the size of the dynamic block with storing the data as it is
+	size := 3 + 5 + 5 + 4 + 3*codeLengthCount
+	for _, t := range lengthTokens {
+		size += int(codeLengthLengths[t.symbol]) + int(deflateCodeLengthExtraBits(t.symbol))
+	}
+	for s, count := range literalCounts {
+		size += count * int(literalLengths[s])
+		if s > deflateEndOfBlock {
+			size += count * int(deflateLengthExtra[s-257])
+		}
+	}
+	for s, count := range distanceCounts {
+		size += count * int(distanceLengths[s]+deflateDistanceExtra[s])
+	}
+	stored := len(data) - start
+	if size/8 >= stored+5*(stored/deflateMaxStored+1) {
+		writeStoredBlocks(w, data[start:], final)
+		return
+	}
+
+	w.writeBits(boolBit(final), 1)
+	w.writeBits(deflateDynamic, 2)
+	w.writeBits(uint64(literalCount-257), 5)
+	w.writeBits(uint64(distanceCount-1), 5)
+	w.writeBits(uint64(codeLengthCount-4), 4)
+	for _, symbol := range deflateCodeLengthOrder[:codeLengthCount] {
+		w.writeBits(uint64(codeLengthLengths[symbol]), 3)
+	}
+	codeLengthCodes := deflateCodes(codeLengthLengths)
+	for _, t := range lengthTokens {
+		code := codeLengthCodes[t.symbol]
+		w.writeBits(code.Bits, uint(code.Len))
+		w.writeBits(uint64(t.extra), deflateCodeLengthExtraBits(t.symbol))
+	}
+
+	literalCodes := deflateCodes(literalLengths)
+	distanceCodes := deflateCodes(distanceLengths)
+	for _, t := range tokens {
+		if t.length == 0 {
+			code := literalCodes[t.literal]
+			w.writeBits(code.Bits, uint(code.Len))
+			continue
+		}
+
+		symbol, extra, extraBits := deflateLengthCode(int(t.length))
+		code := literalCodes[symbol]
+		w.writeBits(code.Bits, uint(code.Len))
+		w.writeBits(extra, extraBits)
+		symbol, extra, extraBits = deflateDistanceCode(int(t.distance))
+		code = distanceCodes[symbol]
+		w.writeBits(code.Bits, uint(code.Len))
+		w.writeBits(extra, extraBits)
+	}
+	code := literalCodes[deflateEndOfBlock]
+	w.writeBits(code.Bits, uint(code.Len))
+}
+
+// writeStoredBlocks writes data uncompressed, in as many stored blocks as it takes
+func writeStoredBlocks(w *lsbWriter, data []byte, final bool) {
+	for {
+		n := len(data)
+		if n > deflateMaxStored {
+			n = deflateMaxStored
+		}
+		last := n == len(data)
+
+		w.writeBits(boolBit(final && last), 1)
+		w.writeBits(deflateStored, 2)
+		w.align()
+		w.out = binary.LittleEndian.AppendUint16(w.out, uint16(n))
+		w.out = binary.LittleEndian.AppendUint16(w.out, ^uint16(n))
+		w.out = append(w.out, data[:n]...)
+
+		data = data[n:]
+		if last {
+			return
+		}
+	}
+}
+
+func boolBit(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// lsbWriter is the DEFLATE counterpart of bitWriter: it packs bits starting from the
+// least significant bit of each byte
+type lsbWriter struct {
+	out   []byte
+	acc   uint64
+	count uint
+}
+
+// writeBits appends the low length bits of bits, least significant first. length is at
+// most 32.
+func (w *lsbWriter) writeBits(bits uint64, length uint) {
+	w.acc |= bits << w.count
+	w.count += length
+	if w.count >= 32 {
+		w.out = binary.LittleEndian.AppendUint32(w.out, uint32(w.acc))
+		w.acc >>= 32
+		w.count -= 32
+	}
+}
+
+// align writes out the pending bits, padded with zeros to a whole byte
+func (w *lsbWriter) align() {
+	for w.count > 0 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+		if w.count < 8 {
+			w.count = 0
+		} else {
+			w.count -= 8
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// Code is a Huffman code packed into the low Len bits of Bits, first bit most significant
+type Code struct {
+	Bits uint64
+	Len  uint8
+}
+
+func (c Code) String() string {
+	var b strings.Builder
+	for i := int(c.Len) - 1; i >= 0; i-- {
+		if (c.Bits>>uint(i))&1 == 1 {
+			b.WriteByte('1')
+		} else {
+			b.WriteByte('0')
+		}
+	}
+	return b.String()
+}
+
+// CodeTable holds the code of every byte value. Symbols that don't occur have Len 0.
+type CodeTable [256]Code
+
+// NewCodeTable returns the codes given by walking the tree, the packed form of
+// GenerateHuffmanCodes
+func NewCodeTable(root *Node[byte]) *CodeTable {
+	table := &CodeTable{}
+	table.fill(root, 0, 0)
+	return table
+}
+
+func (t *CodeTable) fill(node *Node[byte], bits uint64, length uint8) {
+	if node == nil {
+		return
+	}
+	if node.Left == nil && node.Right == nil {
+		t[node.Char] = Code{Bits: bits, Len: length}
+		return
+	}
+	t.fill(node.Left, bits<<1, length+1)
+	t.fill(node.Right, bits<<1|1, length+1)
+}
+
+// CanonicalCodeTable returns the packed form of CanonicalCodes(lengths)
+func CanonicalCodeTable(lengths [256]uint8) *CodeTable {
+	table := &CodeTable{}
+
+	symbols := 0
+	for _, length := range lengths {
+		if length > 0 {
+			symbols++
+		}
+	}
+	// A lone symbol gets the empty code
+	if symbols == 1 {
+		return table
+	}
+
+	nextCode := canonicalFirstCodes(lengths[:])
+	for char, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		table[char] = Code{Bits: nextCode[length], Len: length}
+		nextCode[length]++
+	}
+	return table
+}
+
+// Table packs the string codes into a CodeTable
+func (codes HuffmanCode) Table() *CodeTable {
+	table := &CodeTable{}
+	for char, code := range codes {
+		var bits uint64
+		for _, bit := range code {
+			bits <<= 1
+			if bit == '1' {
+				bits |= 1
+			}
+		}
+		table[char] = Code{Bits: bits, Len: uint8(len(code))}
+	}
+	return table
+}
+
+// Encode packs the codes of every input byte into bits, first code in the most
+// significant bits, padding the last byte with zeros
+func (t *CodeTable) Encode(input []byte) []byte {
+	w := bitWriter{out: make([]byte, 0, len(input)/2+8)}
+	for _, b := range input {
+		code := t[b]
+		w.writeBits(code.Bits, uint(code.Len))
+	}
+	return w.flush()
+}
+
+// bitWriter accumulates bits in a 64-bit buffer and writes them out 32 at a time
+type bitWriter struct {
+	out   []byte
+	acc   uint64
+	count uint
+}
+
+// writeBits appends the low length bits of bits, most significant first
+func (w *bitWriter) writeBits(bits uint64, length uint) {
+	if length > 32 {
+		w.writeBits(bits>>32, length-32)
+		bits &= 1<<32 - 1
+		length = 32
+	}
+
+	// count stays below 32 between calls, so the accumulator never overflows
+	w.acc = w.acc<<length | bits
+	w.count += length
+	if w.count >= 32 {
+		w.count -= 32
+		w.out = binary.BigEndian.AppendUint32(w.out, uint32(w.acc>>w.count))
+	}
+}
+
+// flush writes out the remaining bits, padded with zeros to a whole byte
+func (w *bitWriter) flush() []byte {
+	for w.count >= 8 {
+		w.count -= 8
+		w.out = append(w.out, byte(w.acc>>w.count))
+	}
+	if w.count > 0 {
+		w.out = append(w.out, byte(w.acc<<(8-w.count)))
+		w.count = 0
+	}
+	return w.out
+}
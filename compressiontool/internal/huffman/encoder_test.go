@@ -0,0 +1,74 @@
+package huffman
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCodeTableMatchesStringCodes(t *testing.T) {
+	frequencies, _ := CountFrequencies(bytes.NewReader([]byte("this is an example of a huffman tree")))
+	root := BuildHuffmanTree(frequencies)
+	codes := GenerateHuffmanCodes(root)
+	table := NewCodeTable(root)
+
+	for char, code := range codes {
+		if table[char].String() != code {
+			t.Errorf("For character %q, expected code %s, got %s", char, code, table[char])
+		}
+	}
+	if *codes.Table() != *table {
+		t.Errorf("Packing the string codes doesn't give the tree's code table")
+	}
+}
+
+func TestCanonicalCodeTable(t *testing.T) {
+	var lengths [256]uint8
+	lengths['a'] = 1
+	lengths['b'] = 3
+	lengths['c'] = 3
+	lengths['d'] = 2
+
+	table := CanonicalCodeTable(lengths)
+	expected := map[byte]Code{
+		'a': {Bits: 0b0, Len: 1},
+		'd': {Bits: 0b10, Len: 2},
+		'b': {Bits: 0b110, Len: 3},
+		'c': {Bits: 0b111, Len: 3},
+	}
+	for char, code := range expected {
+		if table[char] != code {
+			t.Errorf("For character %q, expected %+v, got %+v", char, code, table[char])
+		}
+	}
+}
+
+func TestBitWriter(t *testing.T) {
+	var w bitWriter
+	w.writeBits(0b101, 3)
+	w.writeBits(0xFFFFFFFFF, 36)
+	w.writeBits(0, 5)
+	w.writeBits(1, 1)
+
+	expected := []byte{0b10111111, 0xFF, 0xFF, 0xFF, 0b11111110, 0b00001000}
+	if got := w.flush(); !bytes.Equal(got, expected) {
+		t.Errorf("Expected %08b, got %08b", expected, got)
+	}
+}
+
+func TestEncodeMatchesStringEncoder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	input := make([]byte, 10000)
+	for i := range input {
+		// Skewed so codes have many different lengths
+		input[i] = byte(rng.ExpFloat64() * 20)
+	}
+
+	frequencies, _ := CountFrequencies(bytes.NewReader(input))
+	root := BuildHuffmanTree(frequencies)
+	codes := GenerateHuffmanCodes(root)
+
+	if !bytes.Equal(NewCodeTable(root).Encode(input), encodeStringCodes(input, codes)) {
+		t.Errorf("Packed encoder output differs from the string code encoder")
+	}
+}
@@ -0,0 +1,279 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// An encrypted container sets flagEncrypted and follows the container header with an
+// encryption header
+//
+//	cipher (1 byte) | KDF (1 byte) | KDF parameters | nonce prefix (8 bytes)
+//
+// Everything after it, from the first block to the footer, is split into records, each
+// the uvarint size of an AES-256-GCM sealed message followed by the message. Writer
+// seals every block as a record of its own, and the end of the stream as a last one.
+// The nonce of a record is the nonce prefix followed by the record number as a uint32
+// BE, so records can't be dropped or reordered, and both headers are the associated
+// data of every record, so changing either of them fails authentication like changing
+// a block does.
+//
+// With kdfScrypt the KDF parameters are log2 N, r and p as a byte each and a 16 byte
+// salt, and the key is derived from a passphrase. With kdfNone there are none and the
+// key is used as given.
+
+// flagEncrypted marks an encrypted container
+const flagEncrypted byte = 1 << 2
+
+// cipherAES256GCM is the only cipher
+const cipherAES256GCM byte = 1
+
+// Key derivation functions
+const (
+	kdfNone   byte = 0
+	kdfScrypt byte = 1
+)
+
+const (
+	// KeySize is the size of an AES-256 key
+	KeySize         = 32
+	saltSize        = 16
+	noncePrefixSize = 8
+	// scrypt parameters for new streams, the recommended ones for interactive use
+	scryptLogN = 15
+	scryptR    = 8
+	scryptP    = 1
+	// maxScryptMemory bounds the memory, 128 * r * N bytes, that a stream can make the
+	// reader spend deriving its key
+	maxScryptMemory = 256 << 20
+)
+
+var (
+	// ErrEncrypted is returned when a stream is encrypted and no key was given
+	ErrEncrypted = errors.New("huffman: stream is encrypted")
+	// ErrAuthentication is returned when an encrypted record fails authentication,
+	// because the key is wrong or the stream was tampered with
+	ErrAuthentication = errors.New("huffman: authentication failed: wrong key or modified stream")
+)
+
+// Encryption holds the secret of an encrypted stream: either a key or a passphrase
+type Encryption struct {
+	// Key is a KeySize byte AES-256 key, used as is
+	Key []byte
+	// Passphrase derives the key with scrypt and a random salt stored in the stream
+	Passphrase []byte
+}
+
+func (e *Encryption) check() error {
+	switch {
+	case e.Key != nil && e.Passphrase != nil:
+		return errors.New("huffman: encryption needs a key or a passphrase, not both")
+	case e.Key == nil && len(e.Passphrase) == 0:
+		return errors.New("huffman: encryption needs a key or a passphrase")
+	case e.Key != nil && len(e.Key) != KeySize:
+		return fmt.Errorf("huffman: encryption key of %d bytes, want %d", len(e.Key), KeySize)
+	}
+	return nil
+}
+
+// encryptionHeader holds the fields of the encryption header
+type encryptionHeader struct {
+	kdf   byte
+	logN  byte
+	r, p  byte
+	salt  [saltSize]byte
+	nonce [noncePrefixSize]byte
+}
+
+// newEncryptionHeader returns the encryption header of a new stream encrypted with e,
+// with a random nonce prefix and salt
+func newEncryptionHeader(e *Encryption) (*encryptionHeader, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	h := &encryptionHeader{kdf: kdfNone}
+	if _, err := rand.Read(h.nonce[:]); err != nil {
+		return nil, err
+	}
+	if e.Key == nil {
+		h.kdf, h.logN, h.r, h.p = kdfScrypt, scryptLogN, scryptR, scryptP
+		if _, err := rand.Read(h.salt[:]); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+func (h *encryptionHeader) marshal() []byte {
+	buf := []byte{cipherAES256GCM, h.kdf}
+	if h.kdf == kdfScrypt {
+		buf = append(buf, h.logN, h.r, h.p)
+		buf = append(buf, h.salt[:]...)
+	}
+	return append(buf, h.nonce[:]...)
+}
+
+func readEncryptionHeader(r io.Reader) (*encryptionHeader, error) {
+	var buf [2]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	if buf[0] != cipherAES256GCM {
+		return nil, fmt.Errorf("%w: unknown cipher %d", ErrHeader, buf[0])
+	}
+
+	h := &encryptionHeader{kdf: buf[1]}
+	switch h.kdf {
+	case kdfNone:
+	case kdfScrypt:
+		var params [3]byte
+		if _, err := io.ReadFull(r, params[:]); err != nil {
+			return nil, noEOF(err)
+		}
+		h.logN, h.r, h.p = params[0], params[1], params[2]
+		// scrypt needs N > 1 and r * p < 2^30, and the memory 128 * r * N is bounded
+		if h.logN < 1 || h.logN > 30 || h.r == 0 || h.p == 0 || 128*uint64(h.r)<<h.logN > maxScryptMemory {
+			return nil, fmt.Errorf("%w: scrypt parameters N=2^%d r=%d p=%d out of range", ErrHeader, h.logN, h.r, h.p)
+		}
+		if _, err := io.ReadFull(r, h.salt[:]); err != nil {
+			return nil, noEOF(err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown key derivation function %d", ErrHeader, h.kdf)
+	}
+
+	if _, err := io.ReadFull(r, h.nonce[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	return h, nil
+}
+
+// aead returns the cipher of the stream, deriving its key from e
+func (h *encryptionHeader) aead(e *Encryption) (cipher.AEAD, error) {
+	if err := e.check(); err != nil {
+		return nil, err
+	}
+	key := e.Key
+	switch {
+	case h.kdf == kdfNone && key == nil:
+		return nil, errors.New("huffman: stream is encrypted with a key, not a passphrase")
+	case h.kdf == kdfScrypt && key != nil:
+		return nil, errors.New("huffman: stream is encrypted with a passphrase, not a key")
+	case h.kdf == kdfScrypt:
+		var err error
+		key, err = scrypt.Key(e.Passphrase, h.salt[:], 1<<h.logN, int(h.r), int(h.p), KeySize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordNonce returns the nonce of record n
+func recordNonce(prefix [noncePrefixSize]byte, n uint32) []byte {
+	return binary.BigEndian.AppendUint32(prefix[:], n)
+}
+
+// sealWriter seals everything written to it, one record per call to Write
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  [noncePrefixSize]byte
+	records uint32
+	// ad is the associated data of every record
+	ad  []byte
+	buf []byte
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if s.records == math.MaxUint32 {
+		return 0, errors.New("huffman: too many encrypted records")
+	}
+	s.buf = binary.AppendUvarint(s.buf[:0], uint64(len(p)+s.aead.Overhead()))
+	s.buf = s.aead.Seal(s.buf, recordNonce(s.prefix, s.records), p, s.ad)
+	s.records++
+	if _, err := s.w.Write(s.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// openReader reads the records written by a sealWriter and returns their contents
+type openReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  [noncePrefixSize]byte
+	records uint32
+	ad      []byte
+	plain   []byte
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.plain) == 0 {
+		size, err := binary.ReadUvarint(o.r)
+		if err != nil {
+			// A stream cut between records ends early, which the blocks and footer
+			// report as a truncated stream
+			return 0, err
+		}
+		if size < uint64(o.aead.Overhead()) {
+			return 0, fmt.Errorf("%w: encrypted record of %d bytes", ErrCorrupt, size)
+		}
+		sealed, err := readBytes(o.r, size)
+		if err != nil {
+			return 0, err
+		}
+		if o.plain, err = o.aead.Open(sealed[:0], recordNonce(o.prefix, o.records), sealed, o.ad); err != nil {
+			return 0, ErrAuthentication
+		}
+		o.records++
+	}
+
+	n := copy(p, o.plain)
+	o.plain = o.plain[n:]
+	return n, nil
+}
+
+// newOpenReader reads the encryption header of a stream with the given container
+// header from r and returns a reader of the decrypted rest of the stream
+func newOpenReader(r *bufio.Reader, header Header, e *Encryption) (*bufio.Reader, error) {
+	if e == nil {
+		return nil, ErrEncrypted
+	}
+	h, err := readEncryptionHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(e)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(&openReader{r: r, aead: aead, prefix: h.nonce, ad: encryptionAD(header, h)}), nil
+}
+
+// encryptionAD returns the associated data of every record: the container header and
+// the encryption header as written
+func encryptionAD(header Header, h *encryptionHeader) []byte {
+	var buf bytes.Buffer
+	writeHeader(&buf, header)
+	buf.Write(h.marshal())
+	return buf.Bytes()
+}
@@ -0,0 +1,201 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+var testKey = bytes.Repeat([]byte{0x42}, KeySize)
+
+func encryptedStream(t *testing.T, data []byte, opts WriterOptions) []byte {
+	t.Helper()
+	var stream bytes.Buffer
+	zw, err := NewWriterOptions(&stream, opts)
+	if err != nil {
+		t.Fatalf("NewWriterOptions returned an error: %v", err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return stream.Bytes()
+}
+
+func decryptStream(stream []byte, e *Encryption) ([]byte, error) {
+	zr, err := NewReaderOptions(bytes.NewReader(stream), ReaderOptions{Encryption: e})
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("confidential artifact, confidential artifact\n"), 200)
+	withKey := &Encryption{Key: testKey}
+	withPassphrase := &Encryption{Passphrase: []byte("correct horse battery staple")}
+
+	testCases := []struct {
+		name string
+		opts WriterOptions
+	}{
+		{"Key", WriterOptions{BlockSize: 1000, Encryption: withKey}},
+		{"Passphrase", WriterOptions{BlockSize: 1000, Encryption: withPassphrase}},
+		{"Tree header", WriterOptions{Header: TreeHeader, Encryption: withKey}},
+		{"LZH", WriterOptions{Codec: CodecLZH, Encryption: withKey}},
+		{"Adaptive", WriterOptions{Codec: CodecAdaptive, Encryption: withKey}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stream := encryptedStream(t, data, tc.opts)
+			if bytes.Contains(stream, []byte("confidential")) {
+				t.Errorf("Encrypted stream holds the plain text")
+			}
+			decoded, err := decryptStream(stream, tc.opts.Encryption)
+			if err != nil {
+				t.Fatalf("Decoding returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("Decoded data doesn't match the original")
+			}
+		})
+	}
+
+	t.Run("Empty input", func(t *testing.T) {
+		decoded, err := decryptStream(encryptedStream(t, nil, WriterOptions{Encryption: withKey}), withKey)
+		if err != nil || len(decoded) != 0 {
+			t.Errorf("Decoding returned %q, %v, want no data and no error", decoded, err)
+		}
+	})
+
+	t.Run("Streams differ", func(t *testing.T) {
+		// The random nonce prefix makes every stream different, even with the same key
+		a := encryptedStream(t, data, WriterOptions{Encryption: withKey})
+		b := encryptedStream(t, data, WriterOptions{Encryption: withKey})
+		if bytes.Equal(a, b) {
+			t.Errorf("Two encryptions of the same data are identical")
+		}
+	})
+}
+
+func TestEncryptionRejectsWrongSecrets(t *testing.T) {
+	data := []byte("abracadabra")
+	keyStream := encryptedStream(t, data, WriterOptions{Encryption: &Encryption{Key: testKey}})
+	passphraseStream := encryptedStream(t, data, WriterOptions{Encryption: &Encryption{Passphrase: []byte("secret")}})
+
+	otherKey := bytes.Repeat([]byte{0x43}, KeySize)
+	tests := []struct {
+		name    string
+		stream  []byte
+		secret  *Encryption
+		wantErr error
+	}{
+		{"No key", keyStream, nil, ErrEncrypted},
+		{"Wrong key", keyStream, &Encryption{Key: otherKey}, ErrAuthentication},
+		{"Wrong passphrase", passphraseStream, &Encryption{Passphrase: []byte("Secret")}, ErrAuthentication},
+		{"Passphrase for a key", keyStream, &Encryption{Passphrase: []byte("secret")}, nil},
+		{"Key for a passphrase", passphraseStream, &Encryption{Key: testKey}, nil},
+		{"Short key", keyStream, &Encryption{Key: testKey[:16]}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptStream(tt.stream, tt.secret)
+			if err == nil {
+				t.Fatalf("Decoding should have returned an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decoding returned %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := decryptStream(keyStream, &Encryption{Key: testKey}); err != nil {
+		t.Errorf("Decoding with the right key returned an error: %v", err)
+	}
+}
+
+func TestEncryptionDetectsTampering(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra "), 20)
+	stream := encryptedStream(t, data, WriterOptions{BlockSize: 100, Encryption: &Encryption{Key: testKey}})
+	secret := &Encryption{Key: testKey}
+
+	t.Run("Flipped bits", func(t *testing.T) {
+		// Every byte is covered: the headers as associated data, the records by their tags
+		for i := range stream {
+			tampered := append([]byte(nil), stream...)
+			tampered[i] ^= 0x01
+			if _, err := decryptStream(tampered, secret); err == nil {
+				t.Fatalf("Flipping a bit of byte %d went undetected", i)
+			}
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		for n := 0; n < len(stream); n++ {
+			if _, err := decryptStream(stream[:n], secret); err == nil {
+				t.Fatalf("Truncating the stream to %d bytes went undetected", n)
+			}
+		}
+	})
+
+	t.Run("Reordered records", func(t *testing.T) {
+		// A key stream has a 7 byte container header and a 10 byte encryption header
+		var records [][]byte
+		for rest := stream[17:]; len(rest) > 0; {
+			size, n := binary.Uvarint(rest)
+			records = append(records, rest[:n+int(size)])
+			rest = rest[n+int(size):]
+		}
+		if len(records) < 3 {
+			t.Fatalf("Stream has %d records, want at least 3", len(records))
+		}
+		records[0], records[1] = records[1], records[0]
+		tampered := append([]byte(nil), stream[:17]...)
+		for _, record := range records {
+			tampered = append(tampered, record...)
+		}
+		if _, err := decryptStream(tampered, secret); !errors.Is(err, ErrAuthentication) {
+			t.Errorf("Decoding reordered records returned %v, want %v", err, ErrAuthentication)
+		}
+	})
+}
+
+func TestEncryptionOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts WriterOptions
+	}{
+		{"Index", WriterOptions{Index: true, Encryption: &Encryption{Key: testKey}}},
+		{"Short key", WriterOptions{Encryption: &Encryption{Key: testKey[:31]}}},
+		{"Key and passphrase", WriterOptions{Encryption: &Encryption{Key: testKey, Passphrase: []byte("secret")}}},
+		{"No secret", WriterOptions{Encryption: &Encryption{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWriterOptions(io.Discard, tt.opts); err == nil {
+				t.Errorf("NewWriterOptions should have returned an error")
+			}
+		})
+	}
+}
+
+func TestInspectEncrypted(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra "), 100)
+	secret := &Encryption{Key: testKey}
+	stream := encryptedStream(t, data, WriterOptions{BlockSize: 512, Encryption: secret})
+
+	if _, err := Inspect(bytes.NewReader(stream), ReaderOptions{}); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Inspect without a key returned %v, want %v", err, ErrEncrypted)
+	}
+	info, err := Inspect(bytes.NewReader(stream), ReaderOptions{Encryption: secret})
+	if err != nil {
+		t.Fatalf("Inspect returned an error: %v", err)
+	}
+	if !info.Header.Encrypted() || info.Size != int64(len(data)) || info.CompressedSize != int64(len(stream)) || info.Blocks["canonical"] != 3 {
+		t.Errorf("Inspect reported %+v", info)
+	}
+}
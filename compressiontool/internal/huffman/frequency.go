@@ -6,8 +6,46 @@ import (
 
 // CountFrequencies reads data from the given reader and returns a map of character frequencies
 func CountFrequencies(r io.Reader) (map[byte]int, error) {
+	// Counting into an array and converting once is much cheaper than a map update per byte
+	var counts [256]int
+	buffer := make([]byte, 32*1024)
+
+	for {
+		n, err := r.Read(buffer)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		for _, b := range buffer[:n] {
+			counts[b]++
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return frequencyMap(&counts), nil
+}
+
+// frequencyMap converts per-byte counts into the frequency map used by the tree builders
+func frequencyMap(counts *[256]int) map[byte]int {
 	frequencies := make(map[byte]int)
-	buffer := make([]byte, 1024)
+	for char, count := range counts {
+		if count > 0 {
+			frequencies[byte(char)] = count
+		}
+	}
+	return frequencies
+}
+
+// CountContextFrequencies reads data from the given reader and returns an order-1 model:
+// for every byte value, the frequencies of the bytes that follow it. The first byte is
+// counted as following a zero byte.
+func CountContextFrequencies(r io.Reader) (map[byte]map[byte]int, error) {
+	counts := new([256][256]int)
+	buffer := make([]byte, 32*1024)
+	previous := byte(0)
 
 	for {
 		n, err := r.Read(buffer)
@@ -15,8 +53,9 @@ func CountFrequencies(r io.Reader) (map[byte]int, error) {
 			return nil, err
 		}
 
-		for i := 0; i < n; i++ {
-			frequencies[buffer[i]]++
+		for _, b := range buffer[:n] {
+			counts[previous][b]++
+			previous = b
 		}
 
 		if err == io.EOF {
@@ -24,5 +63,11 @@ func CountFrequencies(r io.Reader) (map[byte]int, error) {
 		}
 	}
 
-	return frequencies, nil
+	model := make(map[byte]map[byte]int)
+	for context := range counts {
+		if frequencies := frequencyMap(&counts[context]); len(frequencies) > 0 {
+			model[byte(context)] = frequencies
+		}
+	}
+	return model, nil
 }
@@ -42,3 +42,22 @@ func TestCountFrequencies(t *testing.T) {
 		})
 	}
 }
+
+func TestCountContextFrequencies(t *testing.T) {
+	model, err := CountContextFrequencies(bytes.NewReader([]byte("abracadabra")))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[byte]map[byte]int{
+		0:   {'a': 1},
+		'a': {'b': 2, 'c': 1, 'd': 1},
+		'b': {'r': 2},
+		'r': {'a': 2},
+		'c': {'a': 1},
+		'd': {'a': 1},
+	}
+	if !reflect.DeepEqual(model, expected) {
+		t.Errorf("Expected %v, got %v", expected, model)
+	}
+}
@@ -0,0 +1,134 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func FuzzReadTree(f *testing.F) {
+	for _, input := range []string{"", "a", "abracadabra", "aaaaaaaaaaaaaaab"} {
+		var buf bytes.Buffer
+		frequencies, _ := CountFrequencies(bytes.NewReader([]byte(input)))
+		var root *Node[byte]
+		if len(frequencies) > 0 {
+			root = BuildHuffmanTree(frequencies)
+		}
+		WriteTree(root, &buf)
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		root, err := ReadTree(r)
+		if err != nil || root == nil {
+			return
+		}
+
+		// A tree that was accepted is written back exactly as it was read
+		var buf bytes.Buffer
+		if err := WriteTree(root, &buf); err != nil {
+			t.Fatalf("WriteTree returned an error: %v", err)
+		}
+		if read := data[:len(data)-r.Len()]; !bytes.Equal(buf.Bytes(), read) {
+			t.Fatalf("Tree written as %x was read from %x", buf.Bytes(), read)
+		}
+		if codes := GenerateHuffmanCodes(root); len(codes) > 256 {
+			t.Fatalf("Tree has %d leaves", len(codes))
+		}
+	})
+}
+
+func FuzzReadFrequencyTable(f *testing.F) {
+	for _, input := range []string{"", "a", "abracadabra"} {
+		var buf bytes.Buffer
+		frequencies, _ := CountFrequencies(bytes.NewReader([]byte(input)))
+		WriteFrequencyTable(frequencies, &buf)
+		f.Add(buf.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		freqs, err := ReadFrequencyTable(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := WriteFrequencyTable(freqs, &buf); err != nil {
+			t.Fatalf("WriteFrequencyTable returned an error: %v", err)
+		}
+		again, err := ReadFrequencyTable(&buf)
+		if err != nil {
+			t.Fatalf("Reading a written table returned an error: %v", err)
+		}
+		if !reflect.DeepEqual(freqs, again) {
+			t.Fatalf("Table %v was read back as %v", freqs, again)
+		}
+	})
+}
+
+func FuzzDecodeText(f *testing.F) {
+	for _, input := range []string{"a", "abracadabra", "aaaaaaaaaaaaaaab"} {
+		frequencies, _ := CountFrequencies(bytes.NewReader([]byte(input)))
+		root := BuildHuffmanTree(frequencies)
+		var tree bytes.Buffer
+		WriteTree(root, &tree)
+		f.Add(tree.Bytes(), EncodeText([]byte(input), GenerateHuffmanCodes(root)), len(input))
+	}
+
+	f.Fuzz(func(t *testing.T, tree, input []byte, n int) {
+		root, err := ReadTree(bytes.NewReader(tree))
+		if err != nil || root == nil {
+			return
+		}
+		// A single leaf decodes any number of symbols from nothing, so the count is kept
+		// small enough to allocate
+		if n > 1<<20 {
+			return
+		}
+
+		root.Freq = n
+		decoded, err := DecodeText(input, root)
+		if err == nil && len(decoded) != n {
+			t.Fatalf("Decoded %d symbols, want %d", len(decoded), n)
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	model, _ := TrainModel(map[byte]int{'a': 5, 'b': 2, 'r': 2, 'c': 1, 'd': 1, ' ': 1})
+	seeds := []WriterOptions{
+		{}, {Header: TreeHeader}, {Codec: CodecLZH}, {Codec: CodecRange}, {Codec: CodecContext}, {Codec: CodecBWT},
+		{Codec: CodecAdaptive}, {Symbols: WordSymbols}, {Index: true}, {Model: model},
+	}
+	for _, opts := range seeds {
+		var buf bytes.Buffer
+		zw, _ := NewWriterOptions(&buf, opts)
+		zw.Write([]byte("abracadabra abracadabra"))
+		zw.Close()
+		f.Add(buf.Bytes())
+	}
+	legacy, err := os.ReadFile(filepath.Join("testdata", "legacy_tree.huf"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(legacy)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		opts := ReaderOptions{Concurrency: 1, MaxBlockSize: 1 << 16, MaxSize: 1 << 20}
+		zr, err := NewReaderOptions(bytes.NewReader(data), opts)
+		if errors.Is(err, ErrModelMismatch) {
+			// Streams with a model are decoded with the one of the seed
+			opts.Model = model
+			zr, err = NewReaderOptions(bytes.NewReader(data), opts)
+		}
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, zr)
+	})
+}
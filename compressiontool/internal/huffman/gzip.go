@@ -0,0 +1,271 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// A gzip member (RFC 1952) is a ten byte header, optional fields the header flags
+// announce, a DEFLATE stream and a trailer holding the CRC-32 and the length modulo 2^32
+// of the original data. A gzip file may hold several members one after the other.
+
+// gzipBlockSize is how much input goes into each DEFLATE block
+const gzipBlockSize = 1 << 17
+
+const (
+	gzipID1     = 0x1f
+	gzipID2     = 0x8b
+	gzipDeflate = 8
+	// gzipUnknownOS is the OS header field for an unspecified file system
+	gzipUnknownOS = 255
+)
+
+// Header flags
+const (
+	gzipFlagHCRC    = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+// ErrGzipHeader is returned when the input is not a gzip stream
+var ErrGzipHeader = errors.New("huffman: not a gzip stream")
+
+// GzipWriter compresses data into a gzip stream that gunzip and other standard tools can
+// read, coding it with this package's match finder and length-limited Huffman codes
+type GzipWriter struct {
+	w           io.Writer
+	bw          lsbWriter
+	buf         []byte
+	history     int
+	wroteHeader bool
+	size        uint32
+	crc         uint32
+	err         error
+}
+
+// NewGzipWriter returns a GzipWriter writing a single gzip member to w
+func NewGzipWriter(w io.Writer) *GzipWriter {
+	return &GzipWriter{w: w}
+}
+
+// Write compresses p. Data is written out a DEFLATE block at a time.
+func (zw *GzipWriter) Write(p []byte) (int, error) {
+	if zw.err != nil {
+		return 0, zw.err
+	}
+
+	zw.buf = append(zw.buf, p...)
+	zw.size += uint32(len(p))
+	zw.crc = crc32.Update(zw.crc, crc32.IEEETable, p)
+
+	for len(zw.buf)-zw.history >= gzipBlockSize {
+		end := zw.history + gzipBlockSize
+		if err := zw.writeBlock(zw.buf[:end], false); err != nil {
+			return 0, err
+		}
+
+		// Keep the last window of coded data around for matches in the next block
+		keep := end - lzWindowSize
+		if keep < 0 {
+			keep = 0
+		}
+		zw.buf = zw.buf[:copy(zw.buf, zw.buf[keep:])]
+		zw.history = end - keep
+	}
+	return len(p), nil
+}
+
+// writeBlock codes data[zw.history:] and writes out every complete byte
+func (zw *GzipWriter) writeBlock(data []byte, final bool) error {
+	if !zw.wroteHeader {
+		header := [10]byte{gzipID1, gzipID2, gzipDeflate, 9: gzipUnknownOS}
+		if _, err := zw.w.Write(header[:]); err != nil {
+			zw.err = err
+			return err
+		}
+		zw.wroteHeader = true
+	}
+
+	writeDeflateBlock(&zw.bw, data, zw.history, final)
+	if final {
+		zw.bw.align()
+	}
+	if _, err := zw.w.Write(zw.bw.out); err != nil {
+		zw.err = err
+		return err
+	}
+	zw.bw.out = zw.bw.out[:0]
+	return nil
+}
+
+// Close writes the last DEFLATE block and the gzip trailer. It doesn't close the
+// underlying writer.
+func (zw *GzipWriter) Close() error {
+	if zw.err != nil {
+		return zw.err
+	}
+	if err := zw.writeBlock(zw.buf, true); err != nil {
+		return err
+	}
+
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], zw.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], zw.size)
+	if _, err := zw.w.Write(trailer[:]); err != nil {
+		zw.err = err
+		return err
+	}
+	zw.err = errors.New("huffman: write to closed GzipWriter")
+	return nil
+}
+
+// gzipChunk is how much output GzipReader decodes at a time
+const gzipChunk = 1 << 16
+
+// GzipReader decompresses a gzip stream, including one made of several members
+type GzipReader struct {
+	br       *lsbReader
+	inflater inflater
+	// out holds the decoded data still to be read, preceded by at least a window of
+	// earlier output for matches to refer to
+	out       []byte
+	pos       int
+	newMember bool
+	size      uint32
+	crc       uint32
+	err       error
+}
+
+// NewGzipReader returns a GzipReader reading from r. It reads the first member header
+// right away, so that input that isn't gzip is reported here.
+func NewGzipReader(r io.Reader) (*GzipReader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	zr := &GzipReader{br: &lsbReader{r: br}}
+	if err := zr.readMemberHeader(); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// Read reads decompressed data. It returns ErrChecksum if a member doesn't match its
+// trailer.
+func (zr *GzipReader) Read(p []byte) (int, error) {
+	for zr.pos == len(zr.out) {
+		if zr.err != nil {
+			return 0, zr.err
+		}
+
+		if zr.newMember {
+			zr.out, zr.pos = zr.out[:0], 0
+			zr.newMember = false
+		} else if len(zr.out) >= 2*lzWindowSize+gzipChunk {
+			zr.out = zr.out[:copy(zr.out, zr.out[len(zr.out)-lzWindowSize:])]
+			zr.pos = len(zr.out)
+		}
+
+		start := len(zr.out)
+		var ended bool
+		zr.out, ended, zr.err = zr.inflater.decode(zr.out, start+gzipChunk)
+		zr.size += uint32(len(zr.out) - start)
+		zr.crc = crc32.Update(zr.crc, crc32.IEEETable, zr.out[start:])
+		if ended {
+			zr.err = zr.endMember()
+		}
+	}
+
+	n := copy(p, zr.out[zr.pos:])
+	zr.pos += n
+	return n, nil
+}
+
+// endMember checks the trailer of the member just decoded and starts the next one,
+// or returns io.EOF if there is none
+func (zr *GzipReader) endMember() error {
+	var trailer [8]byte
+	for i := range trailer {
+		b, err := zr.br.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		trailer[i] = b
+	}
+	if binary.LittleEndian.Uint32(trailer[:4]) != zr.crc || binary.LittleEndian.Uint32(trailer[4:]) != zr.size {
+		return ErrChecksum
+	}
+
+	if _, err := zr.br.r.Peek(1); err == io.EOF {
+		return io.EOF
+	}
+	zr.newMember = true
+	return zr.readMemberHeader()
+}
+
+// readMemberHeader reads a member header, skipping the optional fields
+func (zr *GzipReader) readMemberHeader() error {
+	var header [10]byte
+	for i := range header {
+		b, err := zr.br.ReadByte()
+		if err != nil {
+			if i == 0 && err == io.EOF {
+				return ErrGzipHeader
+			}
+			return noEOF(err)
+		}
+		header[i] = b
+	}
+	if header[0] != gzipID1 || header[1] != gzipID2 {
+		return ErrGzipHeader
+	}
+	if header[2] != gzipDeflate {
+		return fmt.Errorf("%w: unknown compression method %d", ErrGzipHeader, header[2])
+	}
+
+	// The header is read a byte at a time, so no bits are left buffered and the optional
+	// fields can be skipped on the underlying reader
+	flags := header[3]
+	if flags&gzipFlagExtra != 0 {
+		lo, err := zr.br.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		hi, err := zr.br.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if _, err := zr.br.r.Discard(int(lo) | int(hi)<<8); err != nil {
+			return noEOF(err)
+		}
+	}
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag == 0 {
+			continue
+		}
+		for {
+			_, err := zr.br.r.ReadSlice(0)
+			if err == nil {
+				break
+			}
+			if err != bufio.ErrBufferFull {
+				return noEOF(err)
+			}
+		}
+	}
+	if flags&gzipFlagHCRC != 0 {
+		if _, err := zr.br.r.Discard(2); err != nil {
+			return noEOF(err)
+		}
+	}
+
+	zr.inflater = inflater{br: zr.br}
+	zr.size, zr.crc = 0, 0
+	return nil
+}
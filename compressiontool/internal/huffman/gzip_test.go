@@ -0,0 +1,161 @@
+package huffman
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func gzipInputs(t *testing.T) map[string][]byte {
+	t.Helper()
+	random := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	return map[string][]byte{
+		"Empty":       {},
+		"Single byte": []byte("a"),
+		"Abracadabra": []byte("abracadabra"),
+		"Long run":    bytes.Repeat([]byte{'x'}, 300000),
+		"Random":      random,
+		"Corpus":      readCorpus(t),
+	}
+}
+
+func gzipString(t *testing.T, input []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := NewGzipWriter(&buf)
+	// Write in pieces so that blocks straddle writes
+	for len(input) > 0 {
+		n := len(input)
+		if n > 50000 {
+			n = 50000
+		}
+		if _, err := zw.Write(input[:n]); err != nil {
+			t.Fatalf("Write returned an error: %v", err)
+		}
+		input = input[n:]
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGzipWriterReadableByCompressGzip(t *testing.T) {
+	for name, input := range gzipInputs(t) {
+		t.Run(name, func(t *testing.T) {
+			encoded := gzipString(t, input)
+
+			zr, err := gzip.NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("gzip.NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("compress/gzip failed to decode our output: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("compress/gzip decoded %d bytes that don't match the %d byte input", len(decoded), len(input))
+			}
+
+			// Incompressible data must not grow by more than the stored block overhead
+			if limit := len(input) + len(input)/1000 + 64; len(encoded) > limit {
+				t.Errorf("Expected at most %d bytes, got %d", limit, len(encoded))
+			}
+		})
+	}
+}
+
+func TestGzipReaderReadsCompressGzip(t *testing.T) {
+	levels := []int{gzip.NoCompression, gzip.BestSpeed, gzip.DefaultCompression, gzip.BestCompression, gzip.HuffmanOnly}
+	for name, input := range gzipInputs(t) {
+		for _, level := range levels {
+			var buf bytes.Buffer
+			zw, _ := gzip.NewWriterLevel(&buf, level)
+			zw.Name = "input.txt"
+			zw.Comment = "written by compress/gzip"
+			zw.Extra = []byte("extra")
+			zw.Write(input)
+			zw.Close()
+
+			zr, err := NewGzipReader(&buf)
+			if err != nil {
+				t.Fatalf("%s at level %d: NewGzipReader returned an error: %v", name, level, err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s at level %d: Read returned an error: %v", name, level, err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Fatalf("%s at level %d: decoded output doesn't match the input", name, level)
+			}
+		}
+	}
+}
+
+func TestGzipReaderMultipleMembers(t *testing.T) {
+	encoded := append(gzipString(t, []byte("first member, ")), gzipString(t, []byte("second member"))...)
+
+	zr, err := NewGzipReader(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewGzipReader returned an error: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Read returned an error: %v", err)
+	}
+	if string(decoded) != "first member, second member" {
+		t.Errorf("Expected both members, got %q", decoded)
+	}
+}
+
+func TestGzipReaderRejectsBadInput(t *testing.T) {
+	valid := gzipString(t, []byte("abracadabra abracadabra"))
+
+	badChecksum := append([]byte{}, valid...)
+	badChecksum[len(badChecksum)-8] ^= 0xff
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr error
+	}{
+		{"Not gzip", encodeString(t, "abracadabra"), ErrGzipHeader},
+		{"Empty", []byte{}, ErrGzipHeader},
+		{"Bad checksum", badChecksum, ErrChecksum},
+		{"Truncated", valid[:len(valid)-4], io.ErrUnexpectedEOF},
+		{"Invalid block type", append(append([]byte{}, valid[:10]...), 0x07), ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zr, err := NewGzipReader(bytes.NewReader(tt.input))
+			if err == nil {
+				_, err = io.ReadAll(zr)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDeflateLengthAndDistanceCodes(t *testing.T) {
+	for length := 3; length <= 258; length++ {
+		symbol, extra, extraBits := deflateLengthCode(length)
+		i := symbol - 257
+		if uint(deflateLengthExtra[i]) != extraBits || int(deflateLengthBase[i])+int(extra) != length {
+			t.Fatalf("Length %d coded as symbol %d with %d extra bits %d", length, symbol, extraBits, extra)
+		}
+	}
+	for distance := 1; distance <= lzWindowSize; distance++ {
+		symbol, extra, extraBits := deflateDistanceCode(distance)
+		if uint(deflateDistanceExtra[symbol]) != extraBits || int(deflateDistanceBase[symbol])+int(extra) != distance {
+			t.Fatalf("Distance %d coded as symbol %d with %d extra bits %d", distance, symbol, extraBits, extra)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+)
+
+// A container with flagIndex is seekable: between the end-of-stream block and the
+// footer it holds a block index, followed by the size of the index as a uint32 LE so
+// that it can be found from the end of the file. The index is the uvarint number of
+// blocks followed, for every block in order, by the uvarint size of the encoded block,
+// the uvarint size of its original data and the CRC-32 of its original data as a
+// uint32 LE. Blocks start right after the header, so their offsets, both compressed and
+// uncompressed, are the sums of the sizes before them.
+
+// flagIndex marks a container with a block index
+const flagIndex byte = 1 << 1
+
+// indexTrailerSize is the size of the index size stored before the footer
+const indexTrailerSize = 4
+
+// ErrNoIndex is returned by NewReaderAt for a stream written without a block index
+var ErrNoIndex = errors.New("huffman: stream has no block index")
+
+// indexEntry describes one block of a seekable container
+type indexEntry struct {
+	encodedSize uint64
+	size        uint64
+	crc         uint32
+}
+
+// writeIndex writes the block index and its size
+func writeIndex(w io.Writer, entries []indexEntry) error {
+	index := encodeIndex(entries)
+	index = binary.LittleEndian.AppendUint32(index, uint32(len(index)))
+	_, err := w.Write(index)
+	return err
+}
+
+func encodeIndex(entries []indexEntry) []byte {
+	index := binary.AppendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		index = binary.AppendUvarint(index, e.encodedSize)
+		index = binary.AppendUvarint(index, e.size)
+		index = binary.LittleEndian.AppendUint32(index, e.crc)
+	}
+	return index
+}
+
+// readIndex reads the block index and its size
+func readIndex(r *bufio.Reader) ([]indexEntry, error) {
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	var entries []indexEntry
+	for i := uint64(0); i < count; i++ {
+		var e indexEntry
+		if e.encodedSize, err = binary.ReadUvarint(r); err != nil {
+			return nil, noEOF(err)
+		}
+		if e.size, err = binary.ReadUvarint(r); err != nil {
+			return nil, noEOF(err)
+		}
+		var crc [4]byte
+		if _, err := io.ReadFull(r, crc[:]); err != nil {
+			return nil, noEOF(err)
+		}
+		e.crc = binary.LittleEndian.Uint32(crc[:])
+		entries = append(entries, e)
+	}
+
+	var size [indexTrailerSize]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	if int(binary.LittleEndian.Uint32(size[:])) != len(encodeIndex(entries)) {
+		return nil, fmt.Errorf("%w: block index size doesn't match", ErrCorrupt)
+	}
+	return entries, nil
+}
+
+// ReaderAt decompresses byte ranges of a seekable container, decoding only the blocks
+// that hold them. It is safe for concurrent use.
+type ReaderAt struct {
+	Header Header
+
+	r    io.ReaderAt
+	opts ReaderOptions
+	// offsets holds the uncompressed offset of every block and the size of the data
+	// after the last one; encodedOffsets holds the offset of every block in r
+	offsets        []int64
+	encodedOffsets []int64
+	entries        []indexEntry
+
+	mu          sync.Mutex
+	cachedBlock int
+	cached      []byte
+}
+
+// NewReaderAt reads the header and the block index of the seekable container of the
+// given size in r. Concurrency and MaxSize are not used.
+func NewReaderAt(r io.ReaderAt, size int64, opts ReaderOptions) (*ReaderAt, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	header, err := readHeader(bufio.NewReader(io.NewSectionReader(r, 0, size)))
+	if err != nil {
+		return nil, err
+	}
+	if header.Legacy() || header.Flags&flagIndex == 0 {
+		return nil, ErrNoIndex
+	}
+	if err := checkModel(header, opts.Model); err != nil {
+		return nil, err
+	}
+	headerSize := int64(len(magic) + 3)
+	if header.Flags&flagModel != 0 {
+		headerSize += 8
+	}
+
+	// The index ends with its own size, just before the footer
+	tail := int64(indexTrailerSize + footerSize)
+	if size < headerSize+1+tail {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var trailer [indexTrailerSize + footerSize]byte
+	if _, err := r.ReadAt(trailer[:], size-tail); err != nil {
+		return nil, err
+	}
+	indexSize := int64(binary.LittleEndian.Uint32(trailer[:indexTrailerSize]))
+	indexStart := size - tail - indexSize
+	if indexStart < headerSize+1 {
+		return nil, fmt.Errorf("%w: block index size %d out of range", ErrCorrupt, indexSize)
+	}
+	entries, err := readIndex(bufio.NewReader(io.NewSectionReader(r, indexStart, indexSize+indexTrailerSize)))
+	if err != nil {
+		return nil, err
+	}
+
+	zr := &ReaderAt{Header: header, r: r, opts: opts, entries: entries, cachedBlock: -1}
+	offset, encodedOffset := int64(0), headerSize
+	for _, e := range entries {
+		if e.encodedSize > uint64(indexStart) || e.size > MaxBlockSize {
+			return nil, fmt.Errorf("%w: block index entry out of range", ErrCorrupt)
+		}
+		if e.size > uint64(opts.MaxBlockSize) {
+			return nil, fmt.Errorf("%w: block of %d bytes exceeds %d", ErrLimit, e.size, opts.MaxBlockSize)
+		}
+		zr.offsets = append(zr.offsets, offset)
+		zr.encodedOffsets = append(zr.encodedOffsets, encodedOffset)
+		offset += int64(e.size)
+		encodedOffset += int64(e.encodedSize)
+	}
+	zr.offsets = append(zr.offsets, offset)
+
+	// The blocks fill everything up to the end-of-stream block
+	if encodedOffset != indexStart-1 || uint64(offset) != binary.LittleEndian.Uint64(trailer[indexTrailerSize:]) {
+		return nil, fmt.Errorf("%w: block index doesn't match the stream", ErrCorrupt)
+	}
+	return zr, nil
+}
+
+// Size returns the size of the original data
+func (zr *ReaderAt) Size() int64 {
+	return zr.offsets[len(zr.offsets)-1]
+}
+
+// ReadAt decompresses len(p) bytes starting at offset off of the original data
+func (zr *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("huffman: negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= zr.Size() {
+			return n, io.EOF
+		}
+		// The last block starting at or before pos holds it
+		i := sort.Search(len(zr.entries), func(i int) bool { return zr.offsets[i+1] > pos })
+		block, err := zr.block(i)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], block[pos-zr.offsets[i]:])
+	}
+	return n, nil
+}
+
+// block returns the decoded block i, keeping the last one decoded for the next read
+func (zr *ReaderAt) block(i int) ([]byte, error) {
+	zr.mu.Lock()
+	defer zr.mu.Unlock()
+	if zr.cachedBlock == i {
+		return zr.cached, nil
+	}
+
+	e := zr.entries[i]
+	section := io.NewSectionReader(zr.r, zr.encodedOffsets[i], int64(e.encodedSize))
+	br := &Reader{Header: zr.Header, r: bufio.NewReader(section), opts: zr.opts}
+	blockType, err := br.r.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	decode, err := br.readBlock(blockType)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decode()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(decoded)) != e.size || crc32.ChecksumIEEE(decoded) != e.crc {
+		return nil, ErrChecksum
+	}
+	if _, err := br.r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("%w: block %d is longer than its index entry", ErrCorrupt, i)
+	}
+
+	zr.cachedBlock, zr.cached = i, decoded
+	return decoded, nil
+}
+
+// indexBlocks returns the index entries of blocks encoded from data
+func indexBlocks(blocks []bytes.Buffer, data []byte, blockSize int) []indexEntry {
+	entries := make([]indexEntry, len(blocks))
+	for i := range blocks {
+		chunk := data[i*blockSize:]
+		if len(chunk) > blockSize {
+			chunk = chunk[:blockSize]
+		}
+		entries[i] = indexEntry{encodedSize: uint64(blocks[i].Len()), size: uint64(len(chunk)), crc: crc32.ChecksumIEEE(chunk)}
+	}
+	return entries
+}
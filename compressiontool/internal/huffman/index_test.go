@@ -0,0 +1,115 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func encodeIndexed(t *testing.T, input []byte, opts WriterOptions) []byte {
+	t.Helper()
+	opts.Index = true
+	var buf bytes.Buffer
+	zw, err := NewWriterOptions(&buf, opts)
+	if err != nil {
+		t.Fatalf("NewWriterOptions returned an error: %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReaderAtRandomRanges(t *testing.T) {
+	corpus := readCorpus(t)
+	encoded := encodeIndexed(t, corpus, WriterOptions{BlockSize: 64 << 10, Concurrency: 3})
+
+	zr, err := NewReaderAt(bytes.NewReader(encoded), int64(len(encoded)), ReaderOptions{})
+	if err != nil {
+		t.Fatalf("NewReaderAt returned an error: %v", err)
+	}
+	if zr.Size() != int64(len(corpus)) {
+		t.Fatalf("Expected size %d, got %d", len(corpus), zr.Size())
+	}
+
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 50; i++ {
+		off := rng.Intn(len(corpus))
+		p := make([]byte, rng.Intn(200<<10))
+		n, err := zr.ReadAt(p, int64(off))
+
+		want := corpus[off:]
+		if len(want) > len(p) {
+			want = want[:len(p)]
+		}
+		if !bytes.Equal(p[:n], want) {
+			t.Fatalf("ReadAt(%d bytes, %d) returned the wrong data", len(p), off)
+		}
+		if n < len(p) && err != io.EOF || n == len(p) && err != nil {
+			t.Fatalf("ReadAt(%d bytes, %d) returned %d bytes and error %v", len(p), off, n, err)
+		}
+	}
+
+	// The index doesn't get in the way of reading the whole stream
+	full, err := NewReader(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	decoded, err := io.ReadAll(full)
+	if err != nil || !bytes.Equal(decoded, corpus) {
+		t.Errorf("Reading the whole stream failed: %v", err)
+	}
+}
+
+func TestReaderAtCodecs(t *testing.T) {
+	input := bytes.Repeat([]byte("seekable streams of abracadabra, "), 3000)
+	for _, codec := range []Codec{CodecHuffman, CodecLZH, CodecRange, CodecContext, CodecBWT} {
+		t.Run(codec.String(), func(t *testing.T) {
+			encoded := encodeIndexed(t, input, WriterOptions{Codec: codec, BlockSize: 10000})
+			zr, err := NewReaderAt(bytes.NewReader(encoded), int64(len(encoded)), ReaderOptions{})
+			if err != nil {
+				t.Fatalf("NewReaderAt returned an error: %v", err)
+			}
+			p := make([]byte, 25000)
+			if _, err := zr.ReadAt(p, 42000); err != nil {
+				t.Fatalf("ReadAt returned an error: %v", err)
+			}
+			if !bytes.Equal(p, input[42000:67000]) {
+				t.Errorf("ReadAt returned the wrong data")
+			}
+		})
+	}
+}
+
+func TestReaderAtErrors(t *testing.T) {
+	plain := encodeString(t, "no index here")
+	if _, err := NewReaderAt(bytes.NewReader(plain), int64(len(plain)), ReaderOptions{}); !errors.Is(err, ErrNoIndex) {
+		t.Errorf("Expected %v, got %v", ErrNoIndex, err)
+	}
+
+	if _, err := NewWriterOptions(io.Discard, WriterOptions{Codec: CodecAdaptive, Index: true}); err == nil {
+		t.Errorf("Expected an error indexing an adaptive stream")
+	}
+
+	input := bytes.Repeat([]byte("abracadabra "), 1000)
+	encoded := encodeIndexed(t, input, WriterOptions{BlockSize: 1000})
+	// Damage the payload of the first block
+	encoded[len(magic)+3+20] ^= 0x55
+	zr, err := NewReaderAt(bytes.NewReader(encoded), int64(len(encoded)), ReaderOptions{})
+	if err != nil {
+		t.Fatalf("NewReaderAt returned an error: %v", err)
+	}
+	if _, err := zr.ReadAt(make([]byte, 10), 0); !errors.Is(err, ErrChecksum) && !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected %v or %v, got %v", ErrChecksum, ErrCorrupt, err)
+	}
+	// Blocks after the damaged one still read fine
+	p := make([]byte, 10)
+	if _, err := zr.ReadAt(p, 5000); err != nil || !bytes.Equal(p, input[5000:5010]) {
+		t.Errorf("Reading an intact block failed: %v", err)
+	}
+}
@@ -0,0 +1,370 @@
+package huffman
+
+import (
+	"bufio"
+	"fmt"
+	"math/bits"
+)
+
+// inflateFastBits is how many bits the first lookup of an inflate code resolves
+const inflateFastBits = 9
+
+// inflateCode decodes one DEFLATE Huffman code. Codes of up to inflateFastBits bits are
+// looked up directly; longer ones are decoded a bit at a time from the canonical code
+// counts, the way zlib's puff does.
+type inflateCode struct {
+	// fast holds symbol<<4 | length for every inflateFastBits-bit prefix of a short
+	// code, or 0
+	fast    [1 << inflateFastBits]uint16
+	count   [deflateMaxCodeLength + 1]uint16
+	symbols []uint16
+}
+
+// newInflateCode builds the decoder for a canonical code given its lengths. Codes that
+// are incomplete are allowed, as long as the input never uses the missing codes.
+func newInflateCode(lengths []uint8) (*inflateCode, error) {
+	h := &inflateCode{}
+	for _, length := range lengths {
+		h.count[length]++
+	}
+	h.count[0] = 0
+
+	left := 1
+	for length := 1; length <= deflateMaxCodeLength; length++ {
+		left = left*2 - int(h.count[length])
+		if left < 0 {
+			return nil, fmt.Errorf("%w: deflate code lengths are over-subscribed", ErrCorrupt)
+		}
+	}
+
+	var offsets [deflateMaxCodeLength + 1]uint16
+	for length := 1; length < deflateMaxCodeLength; length++ {
+		offsets[length+1] = offsets[length] + h.count[length]
+	}
+	h.symbols = make([]uint16, offsets[deflateMaxCodeLength]+h.count[deflateMaxCodeLength])
+	for s, length := range lengths {
+		if length != 0 {
+			h.symbols[offsets[length]] = uint16(s)
+			offsets[length]++
+		}
+	}
+
+	nextCode := canonicalFirstCodes(lengths)
+	for s, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := nextCode[length]
+		nextCode[length]++
+		if length > inflateFastBits {
+			continue
+		}
+		reversed := uint(bits.Reverse16(uint16(code)) >> (16 - length))
+		for i := reversed; i < 1<<inflateFastBits; i += 1 << length {
+			h.fast[i] = uint16(s)<<4 | uint16(length)
+		}
+	}
+	return h, nil
+}
+
+// lsbReader reads bits starting from the least significant bit of each byte. It only
+// reads bytes from r as the bits are needed, give or take the two bytes a fast code
+// lookup may look ahead, and hands those back through ReadByte.
+type lsbReader struct {
+	r     *bufio.Reader
+	acc   uint64
+	count uint
+}
+
+// fill makes at least n bits available, failing at the end of the input
+func (br *lsbReader) fill(n uint) error {
+	for br.count < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		br.acc |= uint64(b) << br.count
+		br.count += 8
+	}
+	return nil
+}
+
+// readBits reads an n-bit number, least significant bit first
+func (br *lsbReader) readBits(n uint) (uint32, error) {
+	if err := br.fill(n); err != nil {
+		return 0, err
+	}
+	v := uint32(br.acc & (1<<n - 1))
+	br.acc >>= n
+	br.count -= n
+	return v, nil
+}
+
+// align skips to the next byte boundary
+func (br *lsbReader) align() {
+	skip := br.count % 8
+	br.acc >>= skip
+	br.count -= skip
+}
+
+// ReadByte skips to the next byte boundary and reads the byte there
+func (br *lsbReader) ReadByte() (byte, error) {
+	br.align()
+	if br.count == 0 {
+		return br.r.ReadByte()
+	}
+	b := byte(br.acc)
+	br.acc >>= 8
+	br.count -= 8
+	return b, nil
+}
+
+// readSymbol decodes one symbol of h
+func (br *lsbReader) readSymbol(h *inflateCode) (int, error) {
+	// Near the end of the input there may be fewer than inflateFastBits bits left,
+	// which is fine as long as the code is shorter
+	br.fill(inflateFastBits)
+	if entry := h.fast[br.acc&(1<<inflateFastBits-1)]; entry != 0 {
+		if length := uint(entry & 15); length <= br.count {
+			br.acc >>= length
+			br.count -= length
+			return int(entry >> 4), nil
+		}
+	}
+
+	code, first, index := 0, 0, 0
+	for length := 1; length <= deflateMaxCodeLength; length++ {
+		bit, err := br.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		code |= int(bit)
+		count := int(h.count[length])
+		if code-first < count {
+			return int(h.symbols[index+code-first]), nil
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return 0, fmt.Errorf("%w: invalid deflate code", ErrCorrupt)
+}
+
+// fixedLiteralCode and fixedDistanceCode are the codes of fixed Huffman blocks
+var fixedLiteralCode, fixedDistanceCode = newFixedCodes()
+
+func newFixedCodes() (*inflateCode, *inflateCode) {
+	var literal [288]uint8
+	for s := range literal {
+		switch {
+		case s < 144:
+			literal[s] = 8
+		case s < 256:
+			literal[s] = 9
+		case s < 280:
+			literal[s] = 7
+		default:
+			literal[s] = 8
+		}
+	}
+	var distance [32]uint8
+	for s := range distance {
+		distance[s] = 5
+	}
+
+	literalCode, _ := newInflateCode(literal[:])
+	distanceCode, _ := newInflateCode(distance[:])
+	return literalCode, distanceCode
+}
+
+// inflater decodes a DEFLATE stream a piece at a time. It keeps the state of the
+// current block between calls to decode.
+type inflater struct {
+	br       *lsbReader
+	final    bool
+	inBlock  bool
+	stored   int
+	literal  *inflateCode
+	distance *inflateCode
+}
+
+// decode appends decoded bytes to out until it is at least limit bytes long or the
+// stream ends, and reports whether it ended. out must hold the preceding output that
+// matches may refer to.
+func (f *inflater) decode(out []byte, limit int) ([]byte, bool, error) {
+	for len(out) < limit {
+		if !f.inBlock {
+			if f.final {
+				return out, true, nil
+			}
+			if err := f.readBlockHeader(); err != nil {
+				return out, false, err
+			}
+			continue
+		}
+
+		if f.literal == nil {
+			if f.stored == 0 {
+				f.inBlock = false
+				continue
+			}
+			b, err := f.br.ReadByte()
+			if err != nil {
+				return out, false, noEOF(err)
+			}
+			out = append(out, b)
+			f.stored--
+			continue
+		}
+
+		symbol, err := f.br.readSymbol(f.literal)
+		if err != nil {
+			return out, false, err
+		}
+		switch {
+		case symbol < deflateEndOfBlock:
+			out = append(out, byte(symbol))
+			continue
+		case symbol == deflateEndOfBlock:
+			f.inBlock = false
+			continue
+		case symbol >= deflateEndOfBlock+1+len(deflateLengthBase):
+			return out, false, fmt.Errorf("%w: invalid deflate length symbol %d", ErrCorrupt, symbol)
+		}
+
+		symbol -= deflateEndOfBlock + 1
+		extra, err := f.br.readBits(uint(deflateLengthExtra[symbol]))
+		if err != nil {
+			return out, false, err
+		}
+		length := int(deflateLengthBase[symbol]) + int(extra)
+
+		symbol, err = f.br.readSymbol(f.distance)
+		if err != nil {
+			return out, false, err
+		}
+		if symbol >= len(deflateDistanceBase) {
+			return out, false, fmt.Errorf("%w: invalid deflate distance symbol %d", ErrCorrupt, symbol)
+		}
+		extra, err = f.br.readBits(uint(deflateDistanceExtra[symbol]))
+		if err != nil {
+			return out, false, err
+		}
+		distance := int(deflateDistanceBase[symbol]) + int(extra)
+		if distance > len(out) {
+			return out, false, fmt.Errorf("%w: deflate match reaches before the start of the stream", ErrCorrupt)
+		}
+
+		// Copy byte by byte, since a match may overlap the bytes it produces
+		start := len(out) - distance
+		for i := 0; i < length; i++ {
+			out = append(out, out[start+i])
+		}
+	}
+	return out, false, nil
+}
+
+func (f *inflater) readBlockHeader() error {
+	header, err := f.br.readBits(3)
+	if err != nil {
+		return err
+	}
+	f.final = header&1 == 1
+	f.inBlock = true
+
+	switch header >> 1 {
+	case deflateStored:
+		f.literal, f.distance = nil, nil
+		f.br.align()
+		lengths, err := f.br.readBits(32)
+		if err != nil {
+			return err
+		}
+		if uint16(lengths) != ^uint16(lengths>>16) {
+			return fmt.Errorf("%w: stored block length check failed", ErrCorrupt)
+		}
+		f.stored = int(uint16(lengths))
+	case deflateFixed:
+		f.literal, f.distance = fixedLiteralCode, fixedDistanceCode
+	case deflateDynamic:
+		return f.readDynamicCodes()
+	default:
+		return fmt.Errorf("%w: invalid deflate block type", ErrCorrupt)
+	}
+	return nil
+}
+
+// readDynamicCodes reads the code length tables of a dynamic Huffman block
+func (f *inflater) readDynamicCodes() error {
+	counts, err := f.br.readBits(14)
+	if err != nil {
+		return err
+	}
+	literalCount := int(counts&31) + 257
+	distanceCount := int(counts>>5&31) + 1
+	codeLengthCount := int(counts>>10) + 4
+	if literalCount > deflateLiteralCodes || distanceCount > deflateDistanceCodes {
+		return fmt.Errorf("%w: too many deflate codes", ErrCorrupt)
+	}
+
+	var codeLengthLengths [19]uint8
+	for _, symbol := range deflateCodeLengthOrder[:codeLengthCount] {
+		length, err := f.br.readBits(3)
+		if err != nil {
+			return err
+		}
+		codeLengthLengths[symbol] = uint8(length)
+	}
+	codeLengthCode, err := newInflateCode(codeLengthLengths[:])
+	if err != nil {
+		return err
+	}
+
+	lengths := make([]uint8, literalCount+distanceCount)
+	for i := 0; i < len(lengths); {
+		symbol, err := f.br.readSymbol(codeLengthCode)
+		if err != nil {
+			return err
+		}
+		if symbol < deflateRepeatPrevious {
+			lengths[i] = uint8(symbol)
+			i++
+			continue
+		}
+
+		var length uint8
+		var base int
+		switch symbol {
+		case deflateRepeatPrevious:
+			if i == 0 {
+				return fmt.Errorf("%w: deflate code length repeat with no previous length", ErrCorrupt)
+			}
+			length, base = lengths[i-1], 3
+		case deflateRepeatZero:
+			base = 3
+		default:
+			base = 11
+		}
+		extra, err := f.br.readBits(deflateCodeLengthExtraBits(uint8(symbol)))
+		if err != nil {
+			return err
+		}
+		run := base + int(extra)
+		if i+run > len(lengths) {
+			return fmt.Errorf("%w: deflate code lengths overrun the alphabet", ErrCorrupt)
+		}
+		for ; run > 0; run-- {
+			lengths[i] = length
+			i++
+		}
+	}
+	if lengths[deflateEndOfBlock] == 0 {
+		return fmt.Errorf("%w: deflate block has no end of block code", ErrCorrupt)
+	}
+
+	if f.literal, err = newInflateCode(lengths[:literalCount]); err != nil {
+		return err
+	}
+	f.distance, err = newInflateCode(lengths[literalCount:])
+	return err
+}
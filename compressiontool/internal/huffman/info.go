@@ -0,0 +1,212 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// StreamInfo describes an encoded stream, see Inspect
+type StreamInfo struct {
+	Header Header
+	// Size is the size of the original data
+	Size int64
+	// CompressedSize is the size of the stream
+	CompressedSize int64
+	// Blocks counts the blocks of every kind: canonical, table or tree for the header
+	// mode of Huffman blocks, model for blocks coded with a model, or the codec or
+	// symbol mode of other blocks
+	Blocks map[string]int
+	// LegacyHeader is the header mode of a legacy stream, TreeHeader or
+	// FrequencyTableHeader
+	LegacyHeader HeaderMode
+	// Symbols is the number of distinct bytes with a code in any block, or in the code
+	// of a legacy stream. It is -1 for adaptive streams, which store no code, and when
+	// the blocks don't code bytes with a single Huffman code.
+	Symbols int
+	// Payload is the size of the coded data of every block, or -1 when it can't be told
+	// apart from the code description in the blocks of the codec
+	Payload int64
+}
+
+// Overhead returns the size of everything in the stream but the coded data: the
+// container header, index and footer, and the framing and code description of every
+// block. It returns -1 when Payload is unknown.
+func (s *StreamInfo) Overhead() int64 {
+	if s.Payload < 0 {
+		return -1
+	}
+	return s.CompressedSize - s.Payload
+}
+
+// Inspect reads the stream from r and describes it. It reads the code descriptions of
+// every block but decodes no data, except for legacy and adaptive streams, which have
+// no blocks and are decoded in full to find their compressed size. Checksums aren't
+// verified.
+// Encrypted streams are decrypted, which authenticates them, so Payload leaves out
+// the encryption overhead along with the rest of the container.
+func Inspect(r io.Reader, opts ReaderOptions) (*StreamInfo, error) {
+	counter := &countingReader{r: r}
+	br := bufio.NewReader(counter)
+
+	zr, err := NewReaderOptions(br, opts)
+	if err != nil {
+		return nil, err
+	}
+	info := &StreamInfo{Header: zr.Header, Blocks: map[string]int{}, Symbols: -1, Payload: -1}
+	if zr.Header.Legacy() {
+		// A legacy stream is coded with the single code its header describes
+		info.LegacyHeader, info.Symbols = FrequencyTableHeader, 0
+		if zr.legacyTree {
+			info.LegacyHeader = TreeHeader
+		}
+		if zr.legacy.root != nil {
+			var symbols [256]bool
+			markLeaves(zr.legacy.root, &symbols)
+			info.Symbols = countSymbols(&symbols)
+		}
+	}
+	if zr.Header.Legacy() || zr.Header.Codec == CodecAdaptive {
+		if info.Size, err = io.Copy(io.Discard, zr); err != nil {
+			return nil, err
+		}
+		info.CompressedSize = counter.n - int64(br.Buffered())
+		return info, nil
+	}
+
+	var symbols [256]bool
+	coded := map[byte]bool{blockTable: true, blockTree: true, blockCanonical: true, blockLimitedTable: true, blockModel: true}
+	info.Symbols, info.Payload = 0, 0
+	for {
+		blockType, err := zr.r.ReadByte()
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if blockType == blockEnd {
+			break
+		}
+		if err := zr.checkBlockLength(); err != nil {
+			return nil, err
+		}
+		if !coded[blockType] {
+			info.Symbols = -1
+		}
+
+		var root *Node[byte]
+		var length uint64
+		var payload []byte
+		switch blockType {
+		case blockTable, blockLimitedTable:
+			info.Blocks[FrequencyTableHeader.String()]++
+			root, length, payload, err = zr.readHuffmanBlock(blockType)
+		case blockTree:
+			info.Blocks[TreeHeader.String()]++
+			root, length, payload, err = zr.readHuffmanBlock(blockType)
+		case blockCanonical:
+			info.Blocks[CanonicalHeader.String()]++
+			root, length, payload, err = zr.readHuffmanBlock(blockType)
+		case blockModel:
+			info.Blocks["model"]++
+			if opts.Model == nil {
+				return nil, fmt.Errorf("%w: model block in a stream without a model", ErrCorrupt)
+			}
+			root = opts.Model.root
+			if length, err = binary.ReadUvarint(zr.r); err != nil {
+				return nil, noEOF(err)
+			}
+			payload, err = readPayload(zr.r)
+		case blockBWT:
+			// The symbols of the inner block are move-to-front positions, not bytes
+			info.Blocks[CodecBWT.String()]++
+			length, payload, err = zr.readInnerBWTBlock()
+		default:
+			name := map[byte]string{blockLZH: CodecLZH.String(), blockRange: CodecRange.String(), blockContext: CodecContext.String(), blockSymbols: "symbols"}[blockType]
+			if name == "" {
+				return nil, fmt.Errorf("%w: unknown block type %d", ErrCorrupt, blockType)
+			}
+			info.Blocks[name]++
+			// Peek fails near the end of the stream, where fewer bytes than the longest
+			// uvarint remain, so only a length that doesn't decode is an error
+			buf, _ := zr.r.Peek(binary.MaxVarintLen64)
+			var n int
+			if length, n = binary.Uvarint(buf); n <= 0 {
+				return nil, fmt.Errorf("%w: invalid length of a %s block", ErrCorrupt, name)
+			}
+			info.Payload = -1
+			_, err = zr.readBlock(blockType)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info.Size += int64(length)
+		if info.Payload >= 0 {
+			info.Payload += int64(len(payload))
+		}
+		if root != nil {
+			markLeaves(root, &symbols)
+		}
+	}
+
+	if zr.Header.Flags&flagIndex != 0 {
+		if _, err := readIndex(zr.r); err != nil {
+			return nil, err
+		}
+	}
+	size, _, err := readFooter(zr.r)
+	if err != nil {
+		return nil, err
+	}
+	if size != uint64(info.Size) {
+		return nil, fmt.Errorf("%w: blocks hold %d bytes, footer records %d", ErrCorrupt, info.Size, size)
+	}
+	info.CompressedSize = counter.n - int64(br.Buffered())
+
+	if info.Symbols == 0 {
+		info.Symbols = countSymbols(&symbols)
+	}
+	return info, nil
+}
+
+// readInnerBWTBlock reads a BWT block, returning the length of its original data and the
+// payload of the Huffman block it holds
+func (zr *Reader) readInnerBWTBlock() (uint64, []byte, error) {
+	length, err := binary.ReadUvarint(zr.r)
+	if err != nil {
+		return 0, nil, noEOF(err)
+	}
+	if _, err := binary.ReadUvarint(zr.r); err != nil {
+		return 0, nil, noEOF(err)
+	}
+	inner, err := zr.r.ReadByte()
+	if err != nil {
+		return 0, nil, noEOF(err)
+	}
+	if inner != blockTable && inner != blockTree && inner != blockCanonical && inner != blockLimitedTable {
+		return 0, nil, fmt.Errorf("%w: BWT block holds a block of type %d", ErrCorrupt, inner)
+	}
+	_, _, payload, err := zr.readHuffmanBlock(inner)
+	return length, payload, err
+}
+
+// markLeaves marks the symbol of every leaf below node
+func markLeaves(node *Node[byte], seen *[256]bool) {
+	if node.Left == nil && node.Right == nil {
+		seen[node.Char] = true
+		return
+	}
+	markLeaves(node.Left, seen)
+	markLeaves(node.Right, seen)
+}
+
+// countSymbols returns the number of marked symbols
+func countSymbols(seen *[256]bool) int {
+	n := 0
+	for _, marked := range seen {
+		if marked {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,141 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra, the quick brown fox. "), 100)
+	analysis, err := Analyze(data, 1024, 0)
+	if err != nil {
+		t.Fatalf("Analyze returned an error: %v", err)
+	}
+
+	for _, size := range analysis.Modes {
+		t.Run(size.Mode.String(), func(t *testing.T) {
+			var stream bytes.Buffer
+			zw, _ := NewWriterOptions(&stream, WriterOptions{Header: size.Mode, BlockSize: 1024})
+			zw.Write(data)
+			zw.Close()
+
+			info, err := Inspect(bytes.NewReader(stream.Bytes()), ReaderOptions{})
+			if err != nil {
+				t.Fatalf("Inspect returned an error: %v", err)
+			}
+			blocks := map[string]int{size.Mode.String(): (len(data) + 1023) / 1024}
+			if info.Size != int64(len(data)) || info.CompressedSize != int64(stream.Len()) || !reflect.DeepEqual(info.Blocks, blocks) {
+				t.Errorf("Inspect reported %d bytes in %d with blocks %v, want %d in %d with %v", info.Size, info.CompressedSize, info.Blocks, len(data), stream.Len(), blocks)
+			}
+			if info.Symbols != len(analysis.Symbols) {
+				t.Errorf("Inspect reported %d symbols, want %d", info.Symbols, len(analysis.Symbols))
+			}
+			if info.Payload != size.Payload || info.Overhead() != size.Header {
+				t.Errorf("Inspect reported a payload of %d and an overhead of %d, want %d and %d", info.Payload, info.Overhead(), size.Payload, size.Header)
+			}
+		})
+	}
+}
+
+func TestInspectCodecs(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra "), 100)
+	frequencies, _ := CountFrequencies(bytes.NewReader(data))
+	model, _ := TrainModel(frequencies)
+
+	testCases := []struct {
+		name     string
+		opts     WriterOptions
+		blocks   map[string]int
+		symbols  int
+		payload  bool
+		readOpts ReaderOptions
+	}{
+		{"Model", WriterOptions{Model: model}, map[string]int{"model": 1}, 256, true, ReaderOptions{Model: model}},
+		{"BWT", WriterOptions{Codec: CodecBWT}, map[string]int{"bwt": 1}, -1, true, ReaderOptions{}},
+		{"LZH", WriterOptions{Codec: CodecLZH}, map[string]int{"lzh": 1}, -1, false, ReaderOptions{}},
+		{"Words", WriterOptions{Symbols: WordSymbols}, map[string]int{"symbols": 1}, -1, false, ReaderOptions{}},
+		{"Index", WriterOptions{Index: true, BlockSize: 512}, map[string]int{"canonical": 3}, 6, true, ReaderOptions{}},
+		{"Adaptive", WriterOptions{Codec: CodecAdaptive}, map[string]int{}, -1, false, ReaderOptions{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stream bytes.Buffer
+			zw, _ := NewWriterOptions(&stream, tc.opts)
+			zw.Write(data)
+			zw.Close()
+
+			info, err := Inspect(bytes.NewReader(stream.Bytes()), tc.readOpts)
+			if err != nil {
+				t.Fatalf("Inspect returned an error: %v", err)
+			}
+			if info.Size != int64(len(data)) || info.CompressedSize != int64(stream.Len()) {
+				t.Errorf("Inspect reported %d bytes in %d, want %d in %d", info.Size, info.CompressedSize, len(data), stream.Len())
+			}
+			if !reflect.DeepEqual(info.Blocks, tc.blocks) || info.Symbols != tc.symbols {
+				t.Errorf("Inspect reported blocks %v and %d symbols, want %v and %d", info.Blocks, info.Symbols, tc.blocks, tc.symbols)
+			}
+			if (info.Payload >= 0) != tc.payload || tc.payload && (info.Payload == 0 || info.Overhead() <= 0) {
+				t.Errorf("Inspect reported a payload of %d and an overhead of %d", info.Payload, info.Overhead())
+			}
+		})
+	}
+}
+
+func TestInspectLegacy(t *testing.T) {
+	tests := []struct {
+		file    string
+		size    int64
+		mode    HeaderMode
+		symbols int
+	}{
+		{"legacy_table.huf", 31, FrequencyTableHeader, 5},
+		{"legacy_tree.huf", 45, TreeHeader, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			stream, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := Inspect(bytes.NewReader(stream), ReaderOptions{})
+			if err != nil {
+				t.Fatalf("Inspect returned an error: %v", err)
+			}
+			if !info.Header.Legacy() || info.Size != tt.size || info.CompressedSize != int64(len(stream)) {
+				t.Errorf("Inspect reported %d bytes in %d, want a legacy stream of %d in %d", info.Size, info.CompressedSize, tt.size, len(stream))
+			}
+			if info.LegacyHeader != tt.mode || info.Symbols != tt.symbols {
+				t.Errorf("Inspect reported a %s header and %d symbols, want %s and %d", info.LegacyHeader, info.Symbols, tt.mode, tt.symbols)
+			}
+		})
+	}
+}
+
+func TestInspectChecksFooterSize(t *testing.T) {
+	var stream bytes.Buffer
+	zw := NewWriter(&stream)
+	zw.Write([]byte("abracadabra"))
+	zw.Close()
+
+	encoded := stream.Bytes()
+	binary.LittleEndian.PutUint64(encoded[len(encoded)-footerSize:], 12)
+	if _, err := Inspect(bytes.NewReader(encoded), ReaderOptions{}); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Inspect returned %v, want %v", err, ErrCorrupt)
+	}
+}
+
+func TestInspectRejectsInvalidBlockLength(t *testing.T) {
+	overlong := append([]byte{blockLZH}, bytes.Repeat([]byte{0xff}, binary.MaxVarintLen64)...)
+	for name, block := range map[string][]byte{"Overlong": append(overlong, 1), "Truncated": {blockRange, 0x80}} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Inspect(bytes.NewReader(craftStream(block)), ReaderOptions{}); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Inspect returned %v, want %v", err, ErrCorrupt)
+			}
+		})
+	}
+}
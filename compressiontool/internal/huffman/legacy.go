@@ -0,0 +1,145 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// legacyChunkSize bounds how much output a legacyDecoder produces per call
+const legacyChunkSize = 64 << 10
+
+// legacyDecoder decodes files written before the container format existed: a use-tree
+// bool, a tree or frequency table, the uint32 original length and the payload.
+//
+// Legacy frequency table files were encoded with a tree built in map iteration order,
+// so they only decode correctly when that tree happens to match the one rebuilt here.
+// A mismatch is detected when the bits run out, or when the decoded bytes don't add up
+// to the frequencies of the table, and reported as ErrCorrupt. Tree files always decode
+// correctly.
+type legacyDecoder struct {
+	r    *bufio.Reader
+	root *Node[byte]
+	node *Node[byte]
+	// frequencies is the table of a frequency table file, and counts what was decoded
+	// against it. It is nil for tree files.
+	frequencies map[byte]int
+	counts      [256]int
+	remaining   uint32
+	current     byte
+	bitsLeft    int
+}
+
+// errLegacyTable reports a legacy frequency table file whose tree can't be rebuilt
+func errLegacyTable(reason string) error {
+	return fmt.Errorf("%w: legacy frequency table file can't be reliably rebuilt: %s", ErrCorrupt, reason)
+}
+
+// newLegacyDecoder reads the header of a legacy file from r, reporting whether it holds
+// a tree rather than a frequency table
+func newLegacyDecoder(r *bufio.Reader) (*legacyDecoder, bool, error) {
+	var useTree bool
+	if err := binary.Read(r, binary.LittleEndian, &useTree); err != nil {
+		return nil, false, noEOF(err)
+	}
+
+	var root *Node[byte]
+	var frequencies map[byte]int
+	var err error
+	if useTree {
+		root, err = ReadTree(r)
+	} else {
+		frequencies, err = ReadFrequencyTable(r)
+		if err == nil && len(frequencies) > 0 {
+			root = BuildHuffmanTree(frequencies)
+		}
+	}
+	if err != nil {
+		return nil, false, noEOF(err)
+	}
+
+	var total uint32
+	if err := binary.Read(r, binary.LittleEndian, &total); err != nil {
+		return nil, false, noEOF(err)
+	}
+	if root == nil && total > 0 {
+		return nil, false, ErrCorrupt
+	}
+	if frequencies != nil {
+		sum := uint64(0)
+		for _, freq := range frequencies {
+			sum += uint64(freq)
+		}
+		if sum != uint64(total) {
+			return nil, false, errLegacyTable(fmt.Sprintf("frequencies add up to %d, length is %d", sum, total))
+		}
+	}
+
+	return &legacyDecoder{r: r, root: root, node: root, frequencies: frequencies, remaining: total}, useTree, nil
+}
+
+// next decodes up to legacyChunkSize symbols
+func (d *legacyDecoder) next() ([]byte, error) {
+	if d.remaining == 0 {
+		return nil, io.EOF
+	}
+
+	n := d.remaining
+	if n > legacyChunkSize {
+		n = legacyChunkSize
+	}
+	out := make([]byte, 0, n)
+
+	if d.root.Left == nil && d.root.Right == nil {
+		for len(out) < int(n) {
+			out = append(out, d.root.Char)
+		}
+		d.remaining -= n
+		return out, nil
+	}
+
+	for len(out) < int(n) {
+		if d.bitsLeft == 0 {
+			b, err := d.r.ReadByte()
+			if err == io.EOF && d.frequencies != nil {
+				return nil, errLegacyTable(fmt.Sprintf("the bits ran out with %d bytes left to decode", d.remaining-uint32(len(out))))
+			}
+			if err != nil {
+				return nil, noEOF(err)
+			}
+			d.current = b
+			d.bitsLeft = 8
+		}
+
+		d.bitsLeft--
+		if (d.current>>d.bitsLeft)&1 == 0 {
+			d.node = d.node.Left
+		} else {
+			d.node = d.node.Right
+		}
+		if d.node == nil {
+			return nil, ErrCorrupt
+		}
+
+		if d.node.Left == nil && d.node.Right == nil {
+			out = append(out, d.node.Char)
+			d.node = d.root
+		}
+	}
+
+	d.remaining -= n
+	if d.frequencies != nil {
+		for _, c := range out {
+			d.counts[c]++
+		}
+		if d.remaining == 0 {
+			for c, count := range d.counts {
+				if count != d.frequencies[byte(c)] {
+					return nil, errLegacyTable(fmt.Sprintf("decoded %q %d times, the table counts it %d times", byte(c), count, d.frequencies[byte(c)]))
+				}
+			}
+		}
+	}
+	return out, nil
+}
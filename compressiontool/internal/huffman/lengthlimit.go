@@ -0,0 +1,144 @@
+package huffman
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultMaxCodeLength is the code length limit used unless another one is chosen,
+// the same limit DEFLATE uses
+const DefaultMaxCodeLength = 15
+
+// pmItem is a coin in the package-merge algorithm: either a single symbol or a package
+// of the cheapest pair of items from the previous level
+type pmItem struct {
+	weight  int
+	symbols []uint16
+}
+
+// LimitedCodeLengths returns optimal code lengths for freqs such that no code is longer
+// than maxLength bits, using the package-merge algorithm of Larmore and Hirschberg.
+// A lone symbol gets length 1.
+func LimitedCodeLengths(freqs map[byte]int, maxLength int) ([256]uint8, error) {
+	var lengths [256]uint8
+
+	var leaves []pmItem
+	for c := 0; c < 256; c++ {
+		if freq, ok := freqs[byte(c)]; ok {
+			leaves = append(leaves, pmItem{weight: freq, symbols: []uint16{uint16(c)}})
+		}
+	}
+
+	if maxLength < 1 || maxLength > maxCanonicalLength {
+		return lengths, fmt.Errorf("huffman: code length limit %d out of range 1-%d", maxLength, maxCanonicalLength)
+	}
+	err := packageMerge(leaves, maxLength, lengths[:])
+	return lengths, err
+}
+
+// packageMerge sets lengths[s] for the symbol s of every leaf. The leaves must be in
+// symbol order, each holding a single symbol.
+func packageMerge(leaves []pmItem, maxLength int, lengths []uint8) error {
+	n := len(leaves)
+	if maxLength < 64 && n > 1<<uint(maxLength) {
+		return fmt.Errorf("huffman: %d symbols don't fit in codes of at most %d bits", n, maxLength)
+	}
+	if n == 0 {
+		return nil
+	}
+	if n == 1 {
+		lengths[leaves[0].symbols[0]] = 1
+		return nil
+	}
+
+	// Leaves are already in symbol order, so a stable sort breaks weight ties by symbol
+	sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].weight < leaves[j].weight })
+
+	list := leaves
+	for level := 1; level < maxLength; level++ {
+		packages := make([]pmItem, 0, len(list)/2)
+		for i := 0; i+1 < len(list); i += 2 {
+			symbols := make([]uint16, 0, len(list[i].symbols)+len(list[i+1].symbols))
+			symbols = append(symbols, list[i].symbols...)
+			symbols = append(symbols, list[i+1].symbols...)
+			packages = append(packages, pmItem{weight: list[i].weight + list[i+1].weight, symbols: symbols})
+		}
+		list = mergeItems(leaves, packages)
+	}
+
+	// Every appearance of a symbol among the 2n-2 cheapest items adds one to its length
+	for _, item := range list[:2*n-2] {
+		for _, char := range item.symbols {
+			lengths[char]++
+		}
+	}
+	return nil
+}
+
+// mergeItems merges two lists sorted by weight, taking leaves first on ties
+func mergeItems(leaves, packages []pmItem) []pmItem {
+	merged := make([]pmItem, 0, len(leaves)+len(packages))
+	i, j := 0, 0
+	for i < len(leaves) && j < len(packages) {
+		if packages[j].weight < leaves[i].weight {
+			merged = append(merged, packages[j])
+			j++
+		} else {
+			merged = append(merged, leaves[i])
+			i++
+		}
+	}
+	merged = append(merged, leaves[i:]...)
+	return append(merged, packages[j:]...)
+}
+
+// BuildLimitedHuffmanTree builds a Huffman tree whose codes are at most maxLength bits
+// long. When the ordinary Huffman tree already fits it is returned unchanged; otherwise
+// the tree is the canonical tree for the package-merge code lengths.
+func BuildLimitedHuffmanTree(freqs map[byte]int, maxLength int) (*Node[byte], error) {
+	root, _, err := limitTree(BuildHuffmanTree(freqs), freqs, maxLength)
+	return root, err
+}
+
+// limitTree replaces root with a length-limited tree if it is deeper than maxLength,
+// and reports whether it did
+func limitTree(root *Node[byte], freqs map[byte]int, maxLength int) (*Node[byte], bool, error) {
+	if treeDepth(root) <= maxLength {
+		return root, false, nil
+	}
+
+	lengths, err := LimitedCodeLengths(freqs, maxLength)
+	if err != nil {
+		return nil, false, err
+	}
+	limited, err := BuildCanonicalTree(lengths)
+	if err != nil {
+		return nil, false, err
+	}
+	fillFrequencies(limited, freqs)
+	return limited, true, nil
+}
+
+// treeDepth returns the length of the longest code in the tree
+func treeDepth(root *Node[byte]) int {
+	depth := 0
+	for _, length := range CodeLengths(root) {
+		if int(length) > depth {
+			depth = int(length)
+		}
+	}
+	return depth
+}
+
+// fillFrequencies sets the frequency of every node from the frequencies of its leaves
+func fillFrequencies(node *Node[byte], freqs map[byte]int) int {
+	if node == nil {
+		return 0
+	}
+	if node.Left == nil && node.Right == nil {
+		node.Freq = freqs[node.Char]
+		return node.Freq
+	}
+	node.Freq = fillFrequencies(node.Left, freqs) + fillFrequencies(node.Right, freqs)
+	return node.Freq
+}
@@ -0,0 +1,194 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// fibonacciFrequencies returns n symbols with Fibonacci frequencies, the distribution
+// that gives the deepest possible Huffman tree
+func fibonacciFrequencies(n int) map[byte]int {
+	freqs := make(map[byte]int)
+	a, b := 1, 1
+	for i := 0; i < n; i++ {
+		freqs[byte('A'+i)] = a
+		a, b = b, a+b
+	}
+	return freqs
+}
+
+func codeCost(freqs map[byte]int, lengths [256]uint8) int {
+	cost := 0
+	for char, freq := range freqs {
+		cost += freq * int(lengths[char])
+	}
+	return cost
+}
+
+// bruteForceCost returns the cheapest cost of any prefix code over weights whose codes
+// are at most maxLength bits, by trying every combination of lengths
+func bruteForceCost(weights []int, maxLength int) int {
+	best := -1
+	lengths := make([]int, len(weights))
+
+	var try func(i int, kraft int)
+	try = func(i int, kraft int) {
+		// kraft is the Kraft sum scaled by 2^maxLength
+		if kraft > 1<<uint(maxLength) {
+			return
+		}
+		if i == len(weights) {
+			cost := 0
+			for j, w := range weights {
+				cost += w * lengths[j]
+			}
+			if best < 0 || cost < best {
+				best = cost
+			}
+			return
+		}
+		for length := 1; length <= maxLength; length++ {
+			lengths[i] = length
+			try(i+1, kraft+1<<uint(maxLength-length))
+		}
+	}
+	try(0, 0)
+	return best
+}
+
+func TestLimitedCodeLengthsRespectsLimit(t *testing.T) {
+	freqs := fibonacciFrequencies(30)
+	if depth := treeDepth(BuildHuffmanTree(freqs)); depth <= DefaultMaxCodeLength {
+		t.Fatalf("Expected the unlimited tree to be deeper than %d, got %d", DefaultMaxCodeLength, depth)
+	}
+
+	lengths, err := LimitedCodeLengths(freqs, DefaultMaxCodeLength)
+	if err != nil {
+		t.Fatalf("LimitedCodeLengths returned an error: %v", err)
+	}
+	for char, length := range lengths {
+		if int(length) > DefaultMaxCodeLength {
+			t.Errorf("Code for %q is %d bits, longer than the limit", char, length)
+		}
+	}
+	if err := validateCodeLengths(lengths); err != nil {
+		t.Errorf("Limited lengths don't form a complete prefix code: %v", err)
+	}
+}
+
+func TestLimitedCodeLengthsIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for trial := 0; trial < 200; trial++ {
+		n := 2 + rng.Intn(5)
+		maxLength := 1
+		for 1<<uint(maxLength) < n {
+			maxLength++
+		}
+		maxLength += rng.Intn(3)
+
+		freqs := make(map[byte]int)
+		weights := make([]int, n)
+		for i := range weights {
+			// Skewed weights so that the limit actually bites
+			weights[i] = 1 + rng.Intn(1<<uint(rng.Intn(10)))
+			freqs[byte(i)] = weights[i]
+		}
+
+		lengths, err := LimitedCodeLengths(freqs, maxLength)
+		if err != nil {
+			t.Fatalf("LimitedCodeLengths returned an error: %v", err)
+		}
+		if err := validateCodeLengths(lengths); err != nil {
+			t.Fatalf("Limited lengths %v don't form a complete prefix code: %v", lengths[:n], err)
+		}
+
+		got, want := codeCost(freqs, lengths), bruteForceCost(weights, maxLength)
+		if got != want {
+			t.Errorf("Weights %v, limit %d: package-merge cost %d, optimal cost %d", weights, maxLength, got, want)
+		}
+	}
+}
+
+func TestLimitedCodeLengthsMatchesHuffmanWithoutPressure(t *testing.T) {
+	freqs := map[byte]int{'a': 5, 'b': 2, 'c': 1, 'd': 3}
+
+	lengths, err := LimitedCodeLengths(freqs, DefaultMaxCodeLength)
+	if err != nil {
+		t.Fatalf("LimitedCodeLengths returned an error: %v", err)
+	}
+
+	huffmanCost := codeCost(freqs, CodeLengths(BuildHuffmanTree(freqs)))
+	if cost := codeCost(freqs, lengths); cost != huffmanCost {
+		t.Errorf("Expected cost %d of the Huffman code, got %d", huffmanCost, cost)
+	}
+}
+
+func TestLimitedCodeLengthsErrors(t *testing.T) {
+	freqs := make(map[byte]int)
+	for c := 0; c < 256; c++ {
+		freqs[byte(c)] = c + 1
+	}
+
+	if _, err := LimitedCodeLengths(freqs, 7); err == nil {
+		t.Errorf("Expected an error for 256 symbols limited to 7 bits")
+	}
+	if _, err := LimitedCodeLengths(freqs, 0); err == nil {
+		t.Errorf("Expected an error for a zero length limit")
+	}
+}
+
+func TestBuildLimitedHuffmanTree(t *testing.T) {
+	freqs := fibonacciFrequencies(25)
+
+	root, err := BuildLimitedHuffmanTree(freqs, 10)
+	if err != nil {
+		t.Fatalf("BuildLimitedHuffmanTree returned an error: %v", err)
+	}
+	if depth := treeDepth(root); depth > 10 {
+		t.Errorf("Expected depth at most 10, got %d", depth)
+	}
+
+	total := 0
+	for _, freq := range freqs {
+		total += freq
+	}
+	if root.Freq != total {
+		t.Errorf("Expected root frequency %d, got %d", total, root.Freq)
+	}
+}
+
+func TestWriterLimitsCodeLength(t *testing.T) {
+	var input []byte
+	for char, freq := range fibonacciFrequencies(22) {
+		input = append(input, bytes.Repeat([]byte{char}, freq)...)
+	}
+
+	for _, mode := range []HeaderMode{CanonicalHeader, FrequencyTableHeader, TreeHeader} {
+		t.Run(mode.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := NewWriterOptions(&buf, WriterOptions{Header: mode, MaxCodeLength: 12})
+			if err != nil {
+				t.Fatalf("NewWriterOptions returned an error: %v", err)
+			}
+			zw.Write(input)
+			if err := zw.Close(); err != nil {
+				t.Fatalf("Close returned an error: %v", err)
+			}
+
+			zr, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input")
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package huffman
+
+const (
+	// lzWindowSize is how far back a match may start
+	lzWindowSize = 1 << 15
+	// lzMinMatch is the shortest match worth emitting instead of literals
+	lzMinMatch = 3
+	// lzMaxMatch is the longest match, so that match lengths fit in a byte alphabet
+	lzMaxMatch = lzMinMatch + 254
+	// lzHashBits sizes the table of hash chain heads
+	lzHashBits = 15
+	// lzMaxChain bounds how many earlier positions are tried for each match
+	lzMaxChain = 64
+)
+
+// lzToken is either a literal byte (length 0) or a match of length bytes starting
+// distance bytes back
+type lzToken struct {
+	literal  byte
+	length   uint16
+	distance uint16
+}
+
+// matchFinder finds earlier occurrences of the data at a position using hash chains
+// over the last lzWindowSize bytes
+type matchFinder struct {
+	data []byte
+	head []int32
+	prev []int32
+}
+
+func newMatchFinder(data []byte) *matchFinder {
+	mf := &matchFinder{
+		data: data,
+		head: make([]int32, 1<<lzHashBits),
+		prev: make([]int32, lzWindowSize),
+	}
+	for i := range mf.head {
+		mf.head[i] = -1
+	}
+	return mf
+}
+
+func (mf *matchFinder) hash(i int) uint32 {
+	v := uint32(mf.data[i])<<16 | uint32(mf.data[i+1])<<8 | uint32(mf.data[i+2])
+	return (v * 2654435761) >> (32 - lzHashBits)
+}
+
+// insert adds position i to its hash chain
+func (mf *matchFinder) insert(i int) {
+	if i+lzMinMatch > len(mf.data) {
+		return
+	}
+	h := mf.hash(i)
+	mf.prev[i%lzWindowSize] = mf.head[h]
+	mf.head[h] = int32(i)
+}
+
+// longestMatch returns the longest match for position i among the positions already
+// inserted, preferring the closest one on ties
+func (mf *matchFinder) longestMatch(i int) (length, distance int) {
+	if i+lzMinMatch > len(mf.data) {
+		return 0, 0
+	}
+
+	maxLength := len(mf.data) - i
+	if maxLength > lzMaxMatch {
+		maxLength = lzMaxMatch
+	}
+
+	candidate := int(mf.head[mf.hash(i)])
+	for chain := 0; candidate >= 0 && i-candidate <= lzWindowSize && chain < lzMaxChain; chain++ {
+		// Checking the byte just past the current best first rejects most candidates cheaply
+		if mf.data[candidate+length] == mf.data[i+length] {
+			n := 0
+			for n < maxLength && mf.data[candidate+n] == mf.data[i+n] {
+				n++
+			}
+			if n > length {
+				length, distance = n, i-candidate
+				if n == maxLength {
+					break
+				}
+			}
+		}
+
+		next := int(mf.prev[candidate%lzWindowSize])
+		if next >= candidate {
+			// The slot was reused by a newer position, so the chain ends here
+			break
+		}
+		candidate = next
+	}
+
+	if length < lzMinMatch {
+		return 0, 0
+	}
+	return length, distance
+}
+
+// findMatches turns data into literals and matches. It uses one step of lazy matching:
+// a match is deferred by a literal when the next position has a longer one.
+func findMatches(data []byte) []lzToken {
+	return findMatchesFrom(data, 0)
+}
+
+// findMatchesFrom is findMatches for data[start:], with matches allowed to reach back
+// into the data before start
+func findMatchesFrom(data []byte, start int) []lzToken {
+	mf := newMatchFinder(data)
+	history := start - lzWindowSize
+	if history < 0 {
+		history = 0
+	}
+	for i := history; i < start; i++ {
+		mf.insert(i)
+	}
+
+	var tokens []lzToken
+	for i := start; i < len(data); {
+		length, distance := mf.longestMatch(i)
+		mf.insert(i)
+
+		if length > 0 && length < lzMaxMatch {
+			if nextLength, _ := mf.longestMatch(i + 1); nextLength > length {
+				tokens = append(tokens, lzToken{literal: data[i]})
+				i++
+				continue
+			}
+		}
+
+		if length == 0 {
+			tokens = append(tokens, lzToken{literal: data[i]})
+			i++
+			continue
+		}
+
+		tokens = append(tokens, lzToken{length: uint16(length), distance: uint16(distance)})
+		for j := i + 1; j < i+length; j++ {
+			mf.insert(j)
+		}
+		i += length
+	}
+
+	return tokens
+}
@@ -0,0 +1,206 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// An LZH block codes the literals and matches found by findMatches with three canonical
+// Huffman codes, each stored as a code length table:
+//
+//   - the token alphabet: 0 for a literal, n for a match of length n+lzMinMatch-1
+//   - the literal alphabet, the bytes themselves
+//   - the distance slot alphabet: the bit length of distance-1, followed by slot-1
+//     raw extra bits for slots 2 and up
+//
+// Coding "literal" as a token symbol instead of a separate flag bit lets the Huffman
+// code make literals nearly free to signal in text that is mostly matches, and the
+// other way round.
+
+// lzLiteralToken is the token symbol announcing a literal
+const lzLiteralToken = 0
+
+// distanceSlot splits distance into its slot and the extra bits stored after it
+func distanceSlot(distance int) (slot byte, extra uint64, extraBits uint) {
+	d := uint(distance - 1)
+	n := bits.Len(d)
+	if n < 2 {
+		return byte(d), 0, 0
+	}
+	return byte(n), uint64(d - 1<<(n-1)), uint(n - 1)
+}
+
+// lzhCodeLengths returns length-limited code lengths for the symbols counted in counts
+func lzhCodeLengths(counts *[256]int, maxLength int) ([256]uint8, error) {
+	freqs := frequencyMap(counts)
+	if len(freqs) == 0 {
+		return [256]uint8{}, nil
+	}
+	root, err := BuildLimitedHuffmanTree(freqs, maxLength)
+	if err != nil {
+		return [256]uint8{}, err
+	}
+	return CodeLengths(root), nil
+}
+
+// encodeLZHBlock writes data as an LZH block: the block type, the uvarint length of the
+// original data, the token, literal and distance slot code lengths, the uvarint payload
+// length and the payload
+func encodeLZHBlock(w *bytes.Buffer, data []byte, opts WriterOptions) error {
+	tokens := findMatches(data)
+
+	var tokenCounts, literalCounts, slotCounts [256]int
+	for _, t := range tokens {
+		if t.length == 0 {
+			tokenCounts[lzLiteralToken]++
+			literalCounts[t.literal]++
+			continue
+		}
+		tokenCounts[t.length-lzMinMatch+1]++
+		slot, _, _ := distanceSlot(int(t.distance))
+		slotCounts[slot]++
+	}
+
+	var tables [3]*CodeTable
+	w.WriteByte(blockLZH)
+	writeUvarint(w, uint64(len(data)))
+	for i, counts := range []*[256]int{&tokenCounts, &literalCounts, &slotCounts} {
+		lengths, err := lzhCodeLengths(counts, opts.MaxCodeLength)
+		if err != nil {
+			return err
+		}
+		if err := WriteCodeLengths(lengths, w); err != nil {
+			return err
+		}
+		tables[i] = CanonicalCodeTable(lengths)
+	}
+	tokenTable, literalTable, slotTable := tables[0], tables[1], tables[2]
+
+	bw := bitWriter{out: make([]byte, 0, len(data)/3+8)}
+	for _, t := range tokens {
+		if t.length == 0 {
+			code := tokenTable[lzLiteralToken]
+			bw.writeBits(code.Bits, uint(code.Len))
+			code = literalTable[t.literal]
+			bw.writeBits(code.Bits, uint(code.Len))
+			continue
+		}
+
+		code := tokenTable[t.length-lzMinMatch+1]
+		bw.writeBits(code.Bits, uint(code.Len))
+		slot, extra, extraBits := distanceSlot(int(t.distance))
+		code = slotTable[slot]
+		bw.writeBits(code.Bits, uint(code.Len))
+		bw.writeBits(extra, extraBits)
+	}
+	encoded := bw.flush()
+
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+	return nil
+}
+
+// readLZHBlock reads the rest of an LZH block once its type has been read
+func readLZHBlock(r *bufio.Reader) (func() ([]byte, error), error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+
+	var decoders [3]*tableDecoder
+	for i := range decoders {
+		lengths, err := ReadCodeLengths(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		decoders[i], err = newLengthsDecoder(lengths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		return decodeLZH(payload, int(length), decoders[0], decoders[1], decoders[2])
+	}, nil
+}
+
+// newLengthsDecoder returns a table decoder for the canonical code with the given
+// lengths, or nil when no symbol has a code
+func newLengthsDecoder(lengths [256]uint8) (*tableDecoder, error) {
+	if lengths == ([256]uint8{}) {
+		return nil, nil
+	}
+	root, err := BuildCanonicalTree(lengths)
+	if err != nil {
+		return nil, err
+	}
+	return newTableDecoder(root), nil
+}
+
+func decodeLZH(payload []byte, length int, tokens, literals, slots *tableDecoder) ([]byte, error) {
+	if length > 0 && tokens == nil {
+		return nil, fmt.Errorf("%w: block has no token code", ErrCorrupt)
+	}
+
+	// A match codes many bytes in a few bits, so the output grows as it's decoded
+	decoded := make([]byte, 0, decodeCapacity(uint64(length), len(payload)))
+	br := newBitReader(payload)
+	for len(decoded) < length {
+		token, err := br.readSymbol(tokens)
+		if err != nil {
+			return nil, err
+		}
+
+		if token == lzLiteralToken {
+			if literals == nil {
+				return nil, fmt.Errorf("%w: literal without a literal code", ErrCorrupt)
+			}
+			literal, err := br.readSymbol(literals)
+			if err != nil {
+				return nil, err
+			}
+			decoded = append(decoded, literal)
+		} else {
+			if slots == nil {
+				return nil, fmt.Errorf("%w: match without a distance code", ErrCorrupt)
+			}
+			slot, err := br.readSymbol(slots)
+			if err != nil {
+				return nil, err
+			}
+			if slot > 15 {
+				return nil, fmt.Errorf("%w: invalid distance slot %d", ErrCorrupt, slot)
+			}
+
+			distance := int(slot) + 1
+			if slot >= 2 {
+				extraBits := uint(slot - 1)
+				distance = 1<<extraBits + int(br.readBits(extraBits)) + 1
+			}
+			matchLength := int(token) + lzMinMatch - 1
+			if distance > len(decoded) || len(decoded)+matchLength > length {
+				return nil, fmt.Errorf("%w: match out of range at output byte %d", ErrCorrupt, len(decoded))
+			}
+
+			// Copy byte by byte, since a match may overlap the bytes it produces
+			start := len(decoded) - distance
+			for i := 0; i < matchLength; i++ {
+				decoded = append(decoded, decoded[start+i])
+			}
+		}
+
+		if br.overrun() {
+			return nil, fmt.Errorf("%w: payload ends after %d of %d bytes", ErrCorrupt, len(decoded), length)
+		}
+	}
+
+	return decoded, nil
+}
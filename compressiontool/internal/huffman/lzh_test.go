@@ -0,0 +1,117 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// replayTokens rebuilds the data described by tokens
+func replayTokens(tokens []lzToken) []byte {
+	var out []byte
+	for _, t := range tokens {
+		if t.length == 0 {
+			out = append(out, t.literal)
+			continue
+		}
+		start := len(out) - int(t.distance)
+		for i := 0; i < int(t.length); i++ {
+			out = append(out, out[start+i])
+		}
+	}
+	return out
+}
+
+func TestFindMatches(t *testing.T) {
+	input := []byte("abcabcabcabcXabcabc")
+	tokens := findMatches(input)
+
+	if !bytes.Equal(replayTokens(tokens), input) {
+		t.Fatalf("Tokens don't rebuild the input")
+	}
+	expected := []lzToken{
+		{literal: 'a'}, {literal: 'b'}, {literal: 'c'},
+		{length: 9, distance: 3},
+		{literal: 'X'},
+		{length: 6, distance: 7},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Unexpected tokens. Got %+v, want %+v", tokens, expected)
+	}
+}
+
+func TestDistanceSlot(t *testing.T) {
+	for distance := 1; distance <= lzWindowSize; distance++ {
+		slot, extra, extraBits := distanceSlot(distance)
+		got := int(slot) + 1
+		if slot >= 2 {
+			got = 1<<extraBits + int(extra) + 1
+		}
+		if got != distance || extra >= 1<<extraBits && extraBits > 0 {
+			t.Fatalf("Distance %d: slot %d with %d extra bits %d decodes to %d", distance, slot, extraBits, extra, got)
+		}
+	}
+}
+
+func TestLZHRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rng.Read(random)
+
+	inputs := map[string][]byte{
+		"Empty":       {},
+		"Single byte": []byte("a"),
+		"Run":         bytes.Repeat([]byte{'z'}, 100000),
+		"Repetitive":  bytes.Repeat([]byte("to be or not to be, "), 5000),
+		"Random":      random,
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := NewWriterOptions(&buf, WriterOptions{Codec: CodecLZH, BlockSize: 1 << 16})
+			if err != nil {
+				t.Fatalf("NewWriterOptions returned an error: %v", err)
+			}
+			zw.Write(input)
+			if err := zw.Close(); err != nil {
+				t.Fatalf("Close returned an error: %v", err)
+			}
+
+			zr, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			if zr.Header.Codec != CodecLZH {
+				t.Errorf("Expected the container to record codec %v, got %v", CodecLZH, zr.Header.Codec)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input")
+			}
+		})
+	}
+}
+
+func TestLZHBeatsHuffmanOnText(t *testing.T) {
+	input := readCorpus(t)
+
+	sizes := make(map[Codec]int)
+	for _, codec := range []Codec{CodecHuffman, CodecLZH} {
+		var buf bytes.Buffer
+		zw, _ := NewWriterOptions(&buf, WriterOptions{Codec: codec})
+		zw.Write(input)
+		zw.Close()
+		sizes[codec] = buf.Len()
+	}
+
+	t.Logf("huffman: %d bytes, lzh: %d bytes", sizes[CodecHuffman], sizes[CodecLZH])
+	if sizes[CodecLZH] >= sizes[CodecHuffman]*9/10 {
+		t.Errorf("Expected lzh to be at least 10%% smaller than huffman, got %d vs %d", sizes[CodecLZH], sizes[CodecHuffman])
+	}
+}
@@ -0,0 +1,181 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A Model is a Huffman code trained on a corpus and shared by the encoder and the
+// decoder, so that the blocks of a container coded with it store no code description at
+// all. For many small messages of the same kind the code description is a large part of
+// every message, and a model removes it.
+//
+// A model file is laid out as
+//
+//	magic "HUFM" | version (1 byte) | 256 uvarint symbol counts
+//
+// Every count is the corpus count plus one, so that every byte has a code even if the
+// corpus never contained it. The model ID is the first 8 bytes of the SHA-256 of the
+// model file, which containers store in place of the code to name the model they need.
+
+var modelMagic = [4]byte{'H', 'U', 'F', 'M'}
+
+// modelVersion is the model file version written by WriteTo
+const modelVersion = 1
+
+var (
+	// ErrModelFile is returned when the input is not a model file
+	ErrModelFile = errors.New("huffman: not a model file")
+	// ErrModelMismatch is returned when a stream needs a different model than the one given
+	ErrModelMismatch = errors.New("huffman: model mismatch")
+)
+
+// Model is a Huffman code shared by many containers
+type Model struct {
+	// ID identifies the model in the containers coded with it
+	ID uint64
+
+	counts  [256]int
+	table   *CodeTable
+	root    *Node[byte]
+	decoder *tableDecoder
+}
+
+// TrainModel returns a model for data with the given byte frequencies, as returned by
+// CountFrequencies for a corpus
+func TrainModel(frequencies map[byte]int) (*Model, error) {
+	var counts [256]int
+	for c := range counts {
+		counts[c] = frequencies[byte(c)] + 1
+	}
+	return newModel(counts)
+}
+
+func newModel(counts [256]int) (*Model, error) {
+	// The code is derived from the counts alone, so streams coded with a model file only
+	// decode as long as it is built exactly as when they were written
+	freqs := frequencyMap(&counts)
+	tree, _, err := limitTree(buildHeapOrderTree(freqs), freqs, DefaultMaxCodeLength)
+	if err != nil {
+		return nil, err
+	}
+	lengths := CodeLengths(tree)
+	root, err := BuildCanonicalTree(lengths)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Model{counts: counts, table: CanonicalCodeTable(lengths), root: root, decoder: newTableDecoder(root)}
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	sum := sha256.Sum256(buf.Bytes())
+	m.ID = binary.BigEndian.Uint64(sum[:8])
+	return m, nil
+}
+
+// CodeLength returns the length of the code of c in bits
+func (m *Model) CodeLength(c byte) int {
+	return int(m.table[c].Len)
+}
+
+// WriteTo writes the model file to w
+func (m *Model) WriteTo(w io.Writer) (int64, error) {
+	buf := append(modelMagic[:], modelVersion)
+	for _, count := range m.counts {
+		buf = binary.AppendUvarint(buf, uint64(count))
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadModel reads a model file written by WriteTo
+func ReadModel(r io.Reader) (*Model, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	var head [len(modelMagic) + 1]byte
+	for i := range head {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, ErrModelFile
+		}
+		head[i] = b
+	}
+	if !bytes.Equal(head[:len(modelMagic)], modelMagic[:]) {
+		return nil, ErrModelFile
+	}
+	if head[len(modelMagic)] != modelVersion {
+		return nil, fmt.Errorf("huffman: unsupported model version %d", head[len(modelMagic)])
+	}
+
+	var counts [256]int
+	for c := range counts {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		// Keep the sum of all counts within an int
+		if count == 0 || count > math.MaxInt64/256 {
+			return nil, fmt.Errorf("%w: model count %d for symbol %d", ErrCorrupt, count, c)
+		}
+		counts[c] = int(count)
+	}
+	return newModel(counts)
+}
+
+// checkModel fails unless m is the model the stream with header h was coded with
+func checkModel(h Header, m *Model) error {
+	switch {
+	case h.Flags&flagModel == 0 && m != nil:
+		return fmt.Errorf("%w: the stream doesn't use a model", ErrModelMismatch)
+	case h.Flags&flagModel == 0:
+		return nil
+	case m == nil:
+		return fmt.Errorf("%w: the stream needs model %016x", ErrModelMismatch, h.ModelID)
+	case m.ID != h.ModelID:
+		return fmt.Errorf("%w: the stream needs model %016x, not %016x", ErrModelMismatch, h.ModelID, m.ID)
+	}
+	return nil
+}
+
+// encodeModelBlock writes data as a model block: the block type, the uvarint length of
+// the original data, the uvarint payload length and the payload
+func encodeModelBlock(w *bytes.Buffer, data []byte, m *Model) {
+	w.WriteByte(blockModel)
+	writeUvarint(w, uint64(len(data)))
+	encoded := m.table.Encode(data)
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+}
+
+// readModelBlock reads the rest of a model block once its type has been read
+func readModelBlock(r *bufio.Reader, m *Model) (func() ([]byte, error), error) {
+	if m == nil {
+		return nil, fmt.Errorf("%w: model block in a stream without a model", ErrCorrupt)
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	payload, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	// Every byte has a code of at least one bit, so the payload bounds the length
+	// before anything is allocated for the output
+	if length > uint64(len(payload))*8 {
+		return nil, fmt.Errorf("%w: %d bytes can't hold %d symbols", ErrCorrupt, len(payload), length)
+	}
+
+	return func() ([]byte, error) {
+		return m.decoder.decode(payload, int(length))
+	}, nil
+}
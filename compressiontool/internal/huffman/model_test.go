@@ -0,0 +1,144 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func trainCorpusModel(t *testing.T) *Model {
+	t.Helper()
+	frequencies, err := CountFrequencies(bytes.NewReader(readCorpus(t)))
+	if err != nil {
+		t.Fatalf("CountFrequencies returned an error: %v", err)
+	}
+	m, err := TrainModel(frequencies)
+	if err != nil {
+		t.Fatalf("TrainModel returned an error: %v", err)
+	}
+	return m
+}
+
+func encodeWithModel(t *testing.T, input []byte, m *Model) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := NewWriterOptions(&buf, WriterOptions{Model: m})
+	if err != nil {
+		t.Fatalf("NewWriterOptions returned an error: %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestModelFileRoundTrip(t *testing.T) {
+	m := trainCorpusModel(t)
+
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo returned an error: %v", err)
+	}
+	read, err := ReadModel(&buf)
+	if err != nil {
+		t.Fatalf("ReadModel returned an error: %v", err)
+	}
+	if read.ID != m.ID || *read.table != *m.table {
+		t.Errorf("Model read back with ID %016x, want %016x", read.ID, m.ID)
+	}
+
+	if _, err := ReadModel(bytes.NewReader([]byte("HUFZ\x02\x00\x00"))); !errors.Is(err, ErrModelFile) {
+		t.Errorf("Expected %v for a container, got %v", ErrModelFile, err)
+	}
+}
+
+func TestModelRoundTrip(t *testing.T) {
+	m := trainCorpusModel(t)
+
+	inputs := map[string][]byte{
+		"Empty":          {},
+		"Message":        []byte("The quick brown fox jumps over the lazy dog."),
+		"Unseen symbols": {0x00, 0xff, 0x80, 0x01},
+		"Corpus":         readCorpus(t),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := encodeWithModel(t, input, m)
+
+			zr, err := NewReaderOptions(bytes.NewReader(encoded), ReaderOptions{Model: m})
+			if err != nil {
+				t.Fatalf("NewReaderOptions returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestModelRejectsOverlongBlock(t *testing.T) {
+	m := trainCorpusModel(t)
+	// A block claiming far more bytes than its one byte payload can code
+	header := encodeWithModel(t, nil, m)[:15]
+	block := append(append([]byte{blockModel}, binary.AppendUvarint(nil, 1<<29)...), 1, 0xff)
+
+	zr, err := NewReaderOptions(bytes.NewReader(append(header, block...)), ReaderOptions{Model: m})
+	if err != nil {
+		t.Fatalf("NewReaderOptions returned an error: %v", err)
+	}
+	if _, err := io.ReadAll(zr); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+	}
+}
+
+func TestModelShrinksSmallMessages(t *testing.T) {
+	m := trainCorpusModel(t)
+	message := []byte("It was the best of times, it was the worst of times.")
+
+	withModel := encodeWithModel(t, message, m)
+	without := encodeString(t, string(message))
+	// The container overhead stays, but the code description is gone
+	if len(withModel) > len(without)*85/100 {
+		t.Errorf("Expected the model to save at least 15%% over %d bytes, got %d", len(without), len(withModel))
+	}
+}
+
+func TestModelMismatch(t *testing.T) {
+	m := trainCorpusModel(t)
+	other, err := TrainModel(map[byte]int{'a': 100, 'b': 1})
+	if err != nil {
+		t.Fatalf("TrainModel returned an error: %v", err)
+	}
+
+	withModel := encodeWithModel(t, []byte("abracadabra"), m)
+	without := encodeString(t, "abracadabra")
+
+	tests := []struct {
+		name  string
+		input []byte
+		model *Model
+	}{
+		{"Other model", withModel, other},
+		{"Missing model", withModel, nil},
+		{"Stream without model", without, m},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReaderOptions(bytes.NewReader(tt.input), ReaderOptions{Model: tt.model})
+			if !errors.Is(err, ErrModelMismatch) {
+				t.Errorf("Expected %v, got %v", ErrModelMismatch, err)
+			}
+		})
+	}
+}
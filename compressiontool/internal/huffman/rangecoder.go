@@ -0,0 +1,300 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// A range block codes its data with a range coder driven by the same symbol counts
+// CountFrequencies returns, scaled to add up to rangeTotal. Unlike a Huffman code, which
+// spends a whole number of bits on every symbol, a range coder gets within a fraction of
+// a percent of the entropy, which matters most for skewed data where one symbol is far
+// more likely than the rest.
+//
+// The block holds the type, the uvarint length of the original data, the model, the
+// uvarint payload length and the payload. The model is the uvarint number of symbols
+// followed, for every symbol in order, by the uvarint gap since the previous symbol and
+// the uvarint scaled frequency minus one.
+
+const (
+	// rangeTotalBits is the precision of the scaled frequencies
+	rangeTotalBits = 16
+	rangeTotal     = 1 << rangeTotalBits
+	// rangeTop is the smallest range kept between symbols; below it a byte is shifted out
+	rangeTop = 1 << 24
+)
+
+// scaleFrequencies scales counts to add up to rangeTotal, keeping every symbol that
+// occurs at a frequency of at least one
+func scaleFrequencies(counts *[256]int) [256]uint32 {
+	var scaled [256]uint32
+	total, largest := 0, 0
+	for c, count := range counts {
+		total += count
+		if count > counts[largest] {
+			largest = c
+		}
+	}
+	if total == 0 {
+		return scaled
+	}
+
+	sum := uint32(0)
+	for c, count := range counts {
+		if count == 0 {
+			continue
+		}
+		scaled[c] = uint32(uint64(count) * rangeTotal / uint64(total))
+		if scaled[c] == 0 {
+			scaled[c] = 1
+		}
+		sum += scaled[c]
+	}
+	// Rounding leaves the sum off by less than one per symbol, which the most frequent
+	// symbol can always absorb
+	scaled[largest] += rangeTotal
+	scaled[largest] -= sum
+	return scaled
+}
+
+func writeRangeModel(w *bytes.Buffer, freqs *[256]uint32) {
+	symbols := 0
+	for _, freq := range freqs {
+		if freq > 0 {
+			symbols++
+		}
+	}
+	writeUvarint(w, uint64(symbols))
+
+	previous := -1
+	for c, freq := range freqs {
+		if freq == 0 {
+			continue
+		}
+		writeUvarint(w, uint64(c-previous-1))
+		writeUvarint(w, uint64(freq-1))
+		previous = c
+	}
+}
+
+func readRangeModel(r *bufio.Reader) ([256]uint32, error) {
+	var freqs [256]uint32
+	symbols, err := binary.ReadUvarint(r)
+	if err != nil {
+		return freqs, err
+	}
+	if symbols > 256 {
+		return freqs, fmt.Errorf("%w: range model with %d symbols", ErrCorrupt, symbols)
+	}
+
+	c, total := -1, uint64(0)
+	for i := uint64(0); i < symbols; i++ {
+		gap, err := binary.ReadUvarint(r)
+		if err != nil {
+			return freqs, err
+		}
+		freq, err := binary.ReadUvarint(r)
+		if err != nil {
+			return freqs, err
+		}
+		if gap >= uint64(255-c) {
+			return freqs, fmt.Errorf("%w: range model symbol out of range", ErrCorrupt)
+		}
+		c += int(gap) + 1
+		total += freq + 1
+		if total > rangeTotal {
+			return freqs, fmt.Errorf("%w: range model frequencies exceed %d", ErrCorrupt, rangeTotal)
+		}
+		freqs[c] = uint32(freq + 1)
+	}
+	if symbols > 0 && total != rangeTotal {
+		return freqs, fmt.Errorf("%w: range model frequencies add up to %d, not %d", ErrCorrupt, total, rangeTotal)
+	}
+	return freqs, nil
+}
+
+// rangeEncoder is the range coder of LZMA: low is kept to 33 bits so that a carry out of
+// the bytes already produced can be propagated through cache and the run of 0xFF bytes
+// after it
+type rangeEncoder struct {
+	out       []byte
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+}
+
+func newRangeEncoder(capacity int) *rangeEncoder {
+	return &rangeEncoder{out: make([]byte, 0, capacity), rng: 0xFFFFFFFF, cacheSize: 1}
+}
+
+// encode narrows the range to the symbol with cumulative frequency start and
+// frequency size
+func (e *rangeEncoder) encode(start, size uint32) {
+	e.rng >>= rangeTotalBits
+	e.low += uint64(start) * uint64(e.rng)
+	e.rng *= size
+	for e.rng < rangeTop {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		b := e.cache
+		for ; e.cacheSize > 0; e.cacheSize-- {
+			e.out = append(e.out, b+carry)
+			b = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = uint64(uint32(e.low) << 8)
+}
+
+// flush writes out enough of low to pin down the final range. The first byte is always
+// zero, so it is left out.
+func (e *rangeEncoder) flush() []byte {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out[1:]
+}
+
+// rangeDecoder mirrors rangeEncoder. Reading past the payload yields zeros; overrun
+// reports whether more was read than the one zero byte the encoder never writes out.
+type rangeDecoder struct {
+	input []byte
+	pos   int
+	code  uint32
+	rng   uint32
+}
+
+func newRangeDecoder(input []byte) *rangeDecoder {
+	d := &rangeDecoder{input: input, rng: 0xFFFFFFFF}
+	for i := 0; i < 4; i++ {
+		d.code = d.code<<8 | uint32(d.next())
+	}
+	return d
+}
+
+func (d *rangeDecoder) next() byte {
+	d.pos++
+	if d.pos > len(d.input) {
+		return 0
+	}
+	return d.input[d.pos-1]
+}
+
+// decode returns the symbol of the current range, using symbols to look up the symbol
+// for a cumulative frequency
+func (d *rangeDecoder) decode(symbols []byte, starts, freqs *[256]uint32) (byte, error) {
+	d.rng >>= rangeTotalBits
+	value := d.code / d.rng
+	if value >= rangeTotal {
+		return 0, fmt.Errorf("%w: range coder value out of range", ErrCorrupt)
+	}
+
+	c := symbols[value]
+	d.code -= starts[c] * d.rng
+	d.rng *= freqs[c]
+	for d.rng < rangeTop {
+		d.code = d.code<<8 | uint32(d.next())
+		d.rng <<= 8
+	}
+	return c, nil
+}
+
+func (d *rangeDecoder) overrun() bool {
+	return d.pos > len(d.input)+1
+}
+
+// cumulativeFrequencies returns the cumulative frequency before every symbol
+func cumulativeFrequencies(freqs *[256]uint32) *[256]uint32 {
+	var starts [256]uint32
+	sum := uint32(0)
+	for c, freq := range freqs {
+		starts[c] = sum
+		sum += freq
+	}
+	return &starts
+}
+
+// encodeRangeBlock writes data as a range coded block
+func encodeRangeBlock(w *bytes.Buffer, data []byte) error {
+	frequencies, err := CountFrequencies(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	var counts [256]int
+	for c, count := range frequencies {
+		counts[c] = count
+	}
+	freqs := scaleFrequencies(&counts)
+	starts := cumulativeFrequencies(&freqs)
+
+	w.WriteByte(blockRange)
+	writeUvarint(w, uint64(len(data)))
+	writeRangeModel(w, &freqs)
+
+	e := newRangeEncoder(len(data)/2 + 8)
+	for _, b := range data {
+		e.encode(starts[b], freqs[b])
+	}
+	encoded := e.flush()
+
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+	return nil
+}
+
+// readRangeBlock reads the rest of a range coded block once its type has been read
+func readRangeBlock(r *bufio.Reader) (func() ([]byte, error), error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	freqs, err := readRangeModel(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if length > 0 && freqs == ([256]uint32{}) {
+		return nil, fmt.Errorf("%w: block has no range model", ErrCorrupt)
+	}
+
+	payload, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		starts := cumulativeFrequencies(&freqs)
+		symbols := make([]byte, rangeTotal)
+		for c, freq := range freqs {
+			start := starts[c]
+			for i := start; i < start+freq; i++ {
+				symbols[i] = byte(c)
+			}
+		}
+
+		decoded := make([]byte, 0, decodeCapacity(length, len(payload)))
+		d := newRangeDecoder(payload)
+		for uint64(len(decoded)) < length {
+			c, err := d.decode(symbols, starts, &freqs)
+			if err != nil {
+				return nil, err
+			}
+			// A symbol can take less than a bit, so the payload only runs out while
+			// decoding, which stops before the output grows to a length it can't hold
+			if d.overrun() {
+				return nil, fmt.Errorf("%w: range coded payload is truncated", ErrCorrupt)
+			}
+			decoded = append(decoded, c)
+		}
+		return decoded, nil
+	}, nil
+}
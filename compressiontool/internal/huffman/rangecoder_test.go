@@ -0,0 +1,117 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func encodeCodec(t *testing.T, input []byte, codec Codec) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := NewWriterOptions(&buf, WriterOptions{Codec: codec})
+	if err != nil {
+		t.Fatalf("NewWriterOptions returned an error: %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// skewedInput returns n bytes that are zero with probability 0.99, like sparse telemetry
+func skewedInput(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	data := make([]byte, n)
+	for i := range data {
+		if rng.Intn(100) == 0 {
+			data[i] = byte(1 + rng.Intn(255))
+		}
+	}
+	return data
+}
+
+func TestScaleFrequencies(t *testing.T) {
+	var counts [256]int
+	counts['a'] = 1000000
+	counts['b'] = 1
+	counts['c'] = 3
+	counts['d'] = 70000
+
+	scaled := scaleFrequencies(&counts)
+	total := uint32(0)
+	for c, freq := range scaled {
+		if (freq == 0) != (counts[c] == 0) {
+			t.Errorf("Symbol %d with count %d got scaled frequency %d", c, counts[c], freq)
+		}
+		total += freq
+	}
+	if total != rangeTotal {
+		t.Errorf("Expected scaled frequencies to add up to %d, got %d", rangeTotal, total)
+	}
+}
+
+func TestRangeRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(2)).Read(random)
+
+	inputs := map[string][]byte{
+		"Empty":         {},
+		"Single symbol": bytes.Repeat([]byte{'a'}, 5000),
+		"Abracadabra":   []byte("abracadabra"),
+		"Skewed":        skewedInput(300000),
+		"Random":        random,
+		"Corpus":        readCorpus(t),
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			encoded := encodeCodec(t, input, CodecRange)
+
+			zr, err := NewReader(bytes.NewReader(encoded))
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+			}
+		})
+	}
+}
+
+func TestRangeBeatsHuffmanOnSkewedData(t *testing.T) {
+	input := skewedInput(1 << 20)
+	huffman := encodeCodec(t, input, CodecHuffman)
+	rangeCoded := encodeCodec(t, input, CodecRange)
+
+	// Huffman spends at least a bit on every zero; the range coder about a seventh of that
+	if len(rangeCoded) > len(huffman)*3/4 {
+		t.Errorf("Expected range coding to save at least a quarter over Huffman's %d bytes, got %d", len(huffman), len(rangeCoded))
+	}
+}
+
+func TestRangeCorruptPayload(t *testing.T) {
+	encoded := encodeCodec(t, []byte("abracadabra abracadabra abracadabra"), CodecRange)
+
+	// Flip the last payload byte, just before the end block and the footer
+	corrupted := append([]byte{}, encoded...)
+	corrupted[len(corrupted)-footerSize-2] ^= 0xff
+
+	zr, err := NewReader(bytes.NewReader(corrupted))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	_, err = io.ReadAll(zr)
+	if !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected %v or %v, got %v", ErrCorrupt, ErrChecksum, err)
+	}
+}
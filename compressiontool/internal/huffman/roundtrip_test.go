@@ -0,0 +1,197 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// randomInput is an input for property tests. Empty input, single symbols, tiny
+// alphabets, long runs and line endings break codecs more often than uniformly random
+// bytes do, so those shapes are generated as often as random bytes.
+type randomInput []byte
+
+func (randomInput) Generate(rng *rand.Rand, size int) reflect.Value {
+	n := rng.Intn(8 << 10)
+	if rng.Intn(8) == 0 {
+		n = rng.Intn(3)
+	}
+	data := make([]byte, n)
+
+	switch rng.Intn(5) {
+	case 0:
+		rng.Read(data)
+	case 1:
+		c := byte(rng.Intn(256))
+		for i := range data {
+			data[i] = c
+		}
+	case 2:
+		alphabet := make([]byte, 1+rng.Intn(4))
+		rng.Read(alphabet)
+		for i := range data {
+			data[i] = alphabet[rng.Intn(len(alphabet))]
+		}
+	case 3:
+		for i := 0; i < n; {
+			c := byte(rng.Intn(256))
+			for run := 1 + rng.Intn(300); run > 0 && i < n; run-- {
+				data[i] = c
+				i++
+			}
+		}
+	case 4:
+		words := []string{"the ", "Grüße ", "\r\n", "\x00\xff", "東京", ", ", "abracadabra"}
+		data = data[:0]
+		for len(data) < n {
+			data = append(data, words[rng.Intn(len(words))]...)
+		}
+	}
+	return reflect.ValueOf(randomInput(data))
+}
+
+// roundTripConfigs returns writer options covering every codec, header mode and
+// stream option
+func roundTripConfigs(t *testing.T) map[string]WriterOptions {
+	model, err := TrainModel(map[byte]int{'a': 10, 'b': 5, ' ': 8})
+	if err != nil {
+		t.Fatalf("TrainModel returned an error: %v", err)
+	}
+	return map[string]WriterOptions{
+		"huffman/canonical": {},
+		"huffman/table":     {Header: FrequencyTableHeader},
+		"huffman/tree":      {Header: TreeHeader},
+		"huffman/limited":   {Header: FrequencyTableHeader, MaxCodeLength: 8},
+		"lzh":               {Codec: CodecLZH},
+		"adaptive":          {Codec: CodecAdaptive},
+		"range":             {Codec: CodecRange},
+		"context":           {Codec: CodecContext},
+		"bwt":               {Codec: CodecBWT},
+		"rune symbols":      {Symbols: RuneSymbols},
+		"word symbols":      {Symbols: WordSymbols},
+		"model":             {Model: model},
+		"index":             {Index: true},
+	}
+}
+
+// roundTrip encodes input with opts and decodes it again
+func roundTrip(input []byte, opts WriterOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := NewWriterOptions(&buf, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(input); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	zr, err := NewReaderOptions(&buf, ReaderOptions{Model: opts.Model})
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
+
+func TestRoundTripEdgeCases(t *testing.T) {
+	var everyByte []byte
+	for c := 0; c < 256; c++ {
+		everyByte = append(everyByte, byte(c))
+	}
+
+	inputs := map[string][]byte{
+		"Empty":                 {},
+		"Zero byte":             {0},
+		"Single byte":           {0xff},
+		"Single symbol":         bytes.Repeat([]byte{'a'}, 1<<17),
+		"Zero bytes":            make([]byte, 5000),
+		"Every byte":            everyByte,
+		"Windows line endings":  []byte("line one\r\nline two\r\n\r\n\n\r"),
+		"Exactly one block":     bytes.Repeat([]byte("ab"), 512),
+		"One byte over a block": append(bytes.Repeat([]byte("ab"), 512), 'c'),
+	}
+
+	for name, opts := range roundTripConfigs(t) {
+		opts.BlockSize = 1024
+		for inputName, input := range inputs {
+			t.Run(name+"/"+inputName, func(t *testing.T) {
+				decoded, err := roundTrip(input, opts)
+				if err != nil {
+					t.Fatalf("Round trip returned an error: %v", err)
+				}
+				if !bytes.Equal(decoded, input) {
+					t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+				}
+			})
+		}
+	}
+}
+
+func TestRoundTripProperty(t *testing.T) {
+	for name, opts := range roundTripConfigs(t) {
+		t.Run(name, func(t *testing.T) {
+			property := func(input randomInput, blockSize uint16) bool {
+				opts := opts
+				opts.BlockSize = 1 + int(blockSize)%4096
+				decoded, err := roundTrip(input, opts)
+				if err != nil {
+					t.Logf("Round trip of %d bytes in blocks of %d returned an error: %v", len(input), opts.BlockSize, err)
+					return false
+				}
+				return bytes.Equal(decoded, input)
+			}
+			config := &quick.Config{MaxCount: 40, Rand: rand.New(rand.NewSource(8))}
+			if err := quick.Check(property, config); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestTextRoundTripProperty(t *testing.T) {
+	property := func(input randomInput) bool {
+		if len(input) == 0 {
+			return true
+		}
+		frequencies, err := CountFrequencies(bytes.NewReader(input))
+		if err != nil {
+			return false
+		}
+		root := BuildHuffmanTree(frequencies)
+		encoded := EncodeText(input, GenerateHuffmanCodes(root))
+		decoded, err := DecodeText(encoded, root)
+		return err == nil && bytes.Equal(decoded, input)
+	}
+	config := &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(9))}
+	if err := quick.Check(property, config); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGzipRoundTripProperty(t *testing.T) {
+	property := func(input randomInput) bool {
+		var buf bytes.Buffer
+		zw := NewGzipWriter(&buf)
+		if _, err := zw.Write(input); err != nil {
+			return false
+		}
+		if err := zw.Close(); err != nil {
+			return false
+		}
+		zr, err := NewGzipReader(&buf)
+		if err != nil {
+			return false
+		}
+		decoded, err := io.ReadAll(zr)
+		return err == nil && bytes.Equal(decoded, input)
+	}
+	config := &quick.Config{MaxCount: 100, Rand: rand.New(rand.NewSource(10))}
+	if err := quick.Check(property, config); err != nil {
+		t.Error(err)
+	}
+}
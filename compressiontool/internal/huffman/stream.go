@@ -0,0 +1,846 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+const (
+	// DefaultBlockSize is the amount of input coded as one block unless configured otherwise
+	DefaultBlockSize = 1 << 20
+	// MaxBlockSize is the largest block size, keeping frequencies within the 32 bits
+	// that frequency tables and trees store
+	MaxBlockSize = 1 << 30
+)
+
+// Block types written at the start of every block in a stream
+const (
+	blockEnd       byte = 0
+	blockTable     byte = 1
+	blockTree      byte = 2
+	blockCanonical byte = 3
+	// blockLimitedTable is a frequency table block whose tree was length limited. It
+	// records the limit so the decoder can rebuild the same tree.
+	blockLimitedTable byte = 4
+	// blockLZH holds LZ77 tokens coded with three Huffman codes, see lzh.go
+	blockLZH byte = 5
+	// blockRange is range coded with a frequency model, see rangecoder.go
+	blockRange byte = 6
+	// blockContext codes every byte with a code chosen by the previous byte, see context.go
+	blockContext byte = 7
+	// blockBWT holds a Burrows-Wheeler transformed Huffman block, see bwt.go
+	blockBWT byte = 8
+	// blockModel is coded with the code of a shared Model, see model.go
+	blockModel byte = 9
+	// blockSymbols codes runes or words instead of bytes, see symbols.go
+	blockSymbols byte = 10
+)
+
+// HeaderMode selects how each block describes its Huffman code
+type HeaderMode int
+
+const (
+	// CanonicalHeader stores only the code lengths and assigns canonical codes. It is
+	// the smallest header and the default.
+	CanonicalHeader HeaderMode = iota
+	// FrequencyTableHeader stores the symbol frequencies and rebuilds the tree on decode
+	FrequencyTableHeader
+	// TreeHeader stores the serialized Huffman tree
+	TreeHeader
+)
+
+// ParseHeaderMode returns the header mode called name: canonical, table or tree
+func ParseHeaderMode(name string) (HeaderMode, error) {
+	switch name {
+	case "canonical":
+		return CanonicalHeader, nil
+	case "table":
+		return FrequencyTableHeader, nil
+	case "tree":
+		return TreeHeader, nil
+	}
+	return 0, fmt.Errorf("huffman: unknown header mode %q", name)
+}
+
+func (m HeaderMode) String() string {
+	switch m {
+	case CanonicalHeader:
+		return "canonical"
+	case FrequencyTableHeader:
+		return "table"
+	case TreeHeader:
+		return "tree"
+	}
+	return fmt.Sprintf("HeaderMode(%d)", int(m))
+}
+
+// WriterOptions configures a Writer
+type WriterOptions struct {
+	Codec  Codec
+	Header HeaderMode
+	// MaxCodeLength limits the length of every code. Zero means DefaultMaxCodeLength.
+	MaxCodeLength int
+	// BlockSize is the amount of input coded as one block with its own Huffman table.
+	// Zero means DefaultBlockSize.
+	BlockSize int
+	// Concurrency is the number of blocks encoded at the same time. Zero means
+	// runtime.GOMAXPROCS(0).
+	Concurrency int
+	// Model is a shared code to use in place of a code per block, which leaves the
+	// code description out of the stream. It requires CodecHuffman.
+	Model *Model
+	// Symbols is the alphabet blocks are coded in. Anything but ByteSymbols requires
+	// CodecHuffman and no Model.
+	Symbols SymbolMode
+	// Index writes a block index at the end of the stream, which lets ReaderAt
+	// decompress any byte range without decoding the blocks before it. It can't be used
+	// with CodecAdaptive, which has no blocks.
+	Index bool
+	// Encryption encrypts and authenticates everything after the header with its key or
+	// passphrase, see encrypt.go. It can't be used with Index.
+	Encryption *Encryption
+}
+
+// Writer compresses everything written to it into a container of Huffman coded
+// blocks. Each block carries its own code description, so memory use is bounded by
+// the block size times the concurrency rather than by the input size. Blocks are
+// encoded in parallel and written in input order. With CodecAdaptive there are no
+// blocks: input is coded as it is written.
+type Writer struct {
+	w           io.Writer
+	opts        WriterOptions
+	buf         []byte
+	adaptive    *adaptiveTree
+	bits        bitWriter
+	index       []indexEntry
+	encryption  *encryptionHeader
+	seal        *sealWriter
+	wroteHeader bool
+	size        uint64
+	crc         uint32
+	err         error
+}
+
+// NewWriter returns a Writer that compresses to w using the default options
+func NewWriter(w io.Writer) *Writer {
+	zw, _ := NewWriterOptions(w, WriterOptions{})
+	return zw
+}
+
+// NewWriterOptions returns a Writer that compresses to w using opts
+func NewWriterOptions(w io.Writer, opts WriterOptions) (*Writer, error) {
+	if !opts.Codec.valid() {
+		return nil, fmt.Errorf("huffman: invalid codec %d", opts.Codec)
+	}
+	if opts.Header != CanonicalHeader && opts.Header != FrequencyTableHeader && opts.Header != TreeHeader {
+		return nil, fmt.Errorf("huffman: invalid header mode %d", opts.Header)
+	}
+	if opts.MaxCodeLength == 0 {
+		opts.MaxCodeLength = DefaultMaxCodeLength
+	}
+	// Eight bits are enough to give every byte value a code
+	if opts.MaxCodeLength < 8 || opts.MaxCodeLength > maxCanonicalLength {
+		return nil, fmt.Errorf("huffman: max code length %d out of range 8-%d", opts.MaxCodeLength, maxCanonicalLength)
+	}
+	if opts.BlockSize == 0 {
+		opts.BlockSize = DefaultBlockSize
+	}
+	if opts.BlockSize < 1 || opts.BlockSize > MaxBlockSize {
+		return nil, fmt.Errorf("huffman: block size %d out of range 1-%d", opts.BlockSize, MaxBlockSize)
+	}
+	if opts.Concurrency == 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.Concurrency < 1 {
+		return nil, fmt.Errorf("huffman: invalid concurrency %d", opts.Concurrency)
+	}
+	if opts.Model != nil && opts.Codec != CodecHuffman {
+		return nil, fmt.Errorf("huffman: a model can't be used with codec %s", opts.Codec)
+	}
+	if opts.Index && opts.Codec == CodecAdaptive {
+		return nil, fmt.Errorf("huffman: codec %s can't write a block index", opts.Codec)
+	}
+	if opts.Symbols > WordSymbols {
+		return nil, fmt.Errorf("huffman: invalid symbol mode %d", opts.Symbols)
+	}
+	if opts.Symbols != ByteSymbols && (opts.Codec != CodecHuffman || opts.Model != nil) {
+		return nil, fmt.Errorf("huffman: %s symbols can only be used with codec huffman and no model", opts.Symbols)
+	}
+
+	if opts.Index && opts.Encryption != nil {
+		return nil, errors.New("huffman: a block index can't be used with encryption")
+	}
+
+	zw := &Writer{w: w, opts: opts}
+	if opts.Encryption != nil {
+		// The key is derived up front so that a bad key or passphrase fails here
+		h, err := newEncryptionHeader(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := h.aead(opts.Encryption)
+		if err != nil {
+			return nil, err
+		}
+		zw.encryption = h
+		zw.seal = &sealWriter{aead: aead, prefix: h.nonce}
+	}
+	if opts.Codec == CodecAdaptive {
+		zw.adaptive = newAdaptiveTree()
+	} else {
+		zw.buf = make([]byte, 0, opts.BlockSize*opts.Concurrency)
+	}
+	return zw, nil
+}
+
+// Write buffers p and encodes a batch of blocks every time the buffer fills up
+func (zw *Writer) Write(p []byte) (int, error) {
+	if zw.err != nil {
+		return 0, zw.err
+	}
+	if zw.adaptive != nil {
+		return zw.writeAdaptive(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(zw.buf[len(zw.buf):cap(zw.buf)], p)
+		zw.buf = zw.buf[:len(zw.buf)+n]
+		p = p[n:]
+		written += n
+
+		if len(zw.buf) == cap(zw.buf) {
+			if err := zw.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// writeAdaptive codes p with the adaptive code and writes out every complete 32 bits
+func (zw *Writer) writeAdaptive(p []byte) (int, error) {
+	if err := zw.Flush(); err != nil {
+		return 0, err
+	}
+	for _, b := range p {
+		zw.adaptive.encode(&zw.bits, int(b))
+	}
+	if _, err := zw.w.Write(zw.bits.out); err != nil {
+		zw.err = err
+		return 0, err
+	}
+	zw.bits.out = zw.bits.out[:0]
+
+	zw.size += uint64(len(p))
+	zw.crc = crc32.Update(zw.crc, crc32.IEEETable, p)
+	return len(p), nil
+}
+
+// Flush encodes any buffered input and writes it to the underlying writer. The last
+// block of the batch may be shorter than the block size. With CodecAdaptive, up to 31
+// coded bits stay buffered until more input arrives or the Writer is closed.
+func (zw *Writer) Flush() error {
+	if zw.err != nil {
+		return zw.err
+	}
+	if !zw.wroteHeader {
+		zw.wroteHeader = true
+		header := Header{Version: FormatVersion, Codec: zw.opts.Codec}
+		if zw.opts.Model != nil {
+			header.Flags |= flagModel
+			header.ModelID = zw.opts.Model.ID
+		}
+		if zw.opts.Index {
+			header.Flags |= flagIndex
+		}
+		if zw.encryption != nil {
+			header.Flags |= flagEncrypted
+		}
+		if err := writeHeader(zw.w, header); err != nil {
+			zw.err = err
+			return err
+		}
+		if zw.encryption != nil {
+			if _, err := zw.w.Write(zw.encryption.marshal()); err != nil {
+				zw.err = err
+				return err
+			}
+			// Everything after the header is sealed
+			zw.seal.w = zw.w
+			zw.seal.ad = encryptionAD(header, zw.encryption)
+			zw.w = zw.seal
+		}
+	}
+	if len(zw.buf) == 0 {
+		return nil
+	}
+
+	blocks, err := encodeBlocks(zw.buf, zw.opts)
+	if err != nil {
+		zw.err = err
+		return err
+	}
+	for _, block := range blocks {
+		if _, err := zw.w.Write(block.Bytes()); err != nil {
+			zw.err = err
+			return err
+		}
+	}
+	if zw.opts.Index {
+		zw.index = append(zw.index, indexBlocks(blocks, zw.buf, zw.opts.BlockSize)...)
+	}
+
+	zw.size += uint64(len(zw.buf))
+	zw.crc = crc32.Update(zw.crc, crc32.IEEETable, zw.buf)
+	zw.buf = zw.buf[:0]
+	return nil
+}
+
+// Close flushes any buffered input and terminates the stream with the end-of-stream
+// block, the block index if there is one, and the footer. It does not close the
+// underlying writer.
+func (zw *Writer) Close() error {
+	if err := zw.Flush(); err != nil {
+		return err
+	}
+	// The end of the stream is written at once, so that an encrypted stream seals it as
+	// a single record
+	var tail bytes.Buffer
+	if zw.adaptive != nil {
+		zw.adaptive.encode(&zw.bits, adaptiveEOF)
+		tail.Write(zw.bits.flush())
+	} else {
+		tail.WriteByte(blockEnd)
+	}
+	if zw.opts.Index {
+		writeIndex(&tail, zw.index)
+	}
+	writeFooter(&tail, zw.size, zw.crc)
+	if _, err := zw.w.Write(tail.Bytes()); err != nil {
+		zw.err = err
+		return err
+	}
+	zw.err = errors.New("huffman: write to closed Writer")
+	return nil
+}
+
+// encodeBlocks splits data into blocks of opts.BlockSize and encodes them concurrently,
+// returning the encoded blocks in order
+func encodeBlocks(data []byte, opts WriterOptions) ([]bytes.Buffer, error) {
+	n := (len(data) + opts.BlockSize - 1) / opts.BlockSize
+	blocks := make([]bytes.Buffer, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		start := i * opts.BlockSize
+		end := start + opts.BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		wg.Add(1)
+		go func(i int, chunk []byte) {
+			defer wg.Done()
+			switch {
+			case opts.Model != nil:
+				encodeModelBlock(&blocks[i], chunk, opts.Model)
+			case opts.Symbols != ByteSymbols:
+				errs[i] = encodeSymbolBlock(&blocks[i], chunk, opts.Symbols)
+			case opts.Codec == CodecLZH:
+				errs[i] = encodeLZHBlock(&blocks[i], chunk, opts)
+			case opts.Codec == CodecRange:
+				errs[i] = encodeRangeBlock(&blocks[i], chunk)
+			case opts.Codec == CodecContext:
+				errs[i] = encodeContextBlock(&blocks[i], chunk, opts)
+			case opts.Codec == CodecBWT:
+				errs[i] = encodeBWTBlock(&blocks[i], chunk, opts)
+			default:
+				errs[i] = encodeBlock(&blocks[i], chunk, opts)
+			}
+		}(i, data[start:end])
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+// encodeBlock writes data as a single block: the block type, the uvarint length of
+// the original data, the code description, the uvarint payload length and the payload
+func encodeBlock(w *bytes.Buffer, data []byte, opts WriterOptions) error {
+	frequencies, err := CountFrequencies(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	root, limited, err := limitTree(BuildHuffmanTree(frequencies), frequencies, opts.MaxCodeLength)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Header {
+	case CanonicalHeader:
+		lengths := CodeLengths(root)
+		w.WriteByte(blockCanonical)
+		writeUvarint(w, uint64(len(data)))
+		if err := WriteCodeLengths(lengths, w); err != nil {
+			return err
+		}
+		encoded := CanonicalCodeTable(lengths).Encode(data)
+		writeUvarint(w, uint64(len(encoded)))
+		w.Write(encoded)
+		return nil
+	case TreeHeader:
+		w.WriteByte(blockTree)
+		writeUvarint(w, uint64(len(data)))
+		err = WriteTree(root, w)
+	default:
+		if limited {
+			w.WriteByte(blockLimitedTable)
+			writeUvarint(w, uint64(len(data)))
+			w.WriteByte(byte(opts.MaxCodeLength))
+		} else {
+			w.WriteByte(blockTable)
+			writeUvarint(w, uint64(len(data)))
+		}
+		err = WriteFrequencyTable(frequencies, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded := NewCodeTable(root).Encode(data)
+
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+	return nil
+}
+
+func writeUvarint(w io.Writer, v uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	_, err := w.Write(buf[:n])
+	return err
+}
+
+// ReaderOptions configures a Reader
+type ReaderOptions struct {
+	// Concurrency is the number of blocks decoded at the same time. Zero means
+	// runtime.GOMAXPROCS(0).
+	Concurrency int
+	// Model is the shared code of streams written with WriterOptions.Model. A stream
+	// that needs a different model, or none, is rejected.
+	Model *Model
+	// MaxBlockSize is the largest block a stream may claim before it is rejected with
+	// ErrLimit, bounding the memory a crafted stream can make a Reader allocate. Zero
+	// means MaxBlockSize.
+	MaxBlockSize int
+	// MaxSize is the most data a stream may decompress to before reading fails with
+	// ErrLimit. Zero means no limit.
+	MaxSize int64
+	// Encryption holds the key or passphrase of encrypted streams. Reading one without
+	// it fails with ErrEncrypted.
+	Encryption *Encryption
+}
+
+// check validates opts and fills in the defaults
+func (opts *ReaderOptions) check() error {
+	if opts.Concurrency == 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.Concurrency < 1 {
+		return fmt.Errorf("huffman: invalid concurrency %d", opts.Concurrency)
+	}
+	if opts.MaxBlockSize == 0 {
+		opts.MaxBlockSize = MaxBlockSize
+	}
+	if opts.MaxBlockSize < 1 || opts.MaxBlockSize > MaxBlockSize {
+		return fmt.Errorf("huffman: block size limit %d out of range 1-%d", opts.MaxBlockSize, MaxBlockSize)
+	}
+	if opts.MaxSize < 0 {
+		return fmt.Errorf("huffman: invalid size limit %d", opts.MaxSize)
+	}
+	return nil
+}
+
+// Reader decompresses a container produced by Writer, or a legacy file. Blocks are
+// read ahead and decoded in parallel.
+type Reader struct {
+	Header Header
+
+	r        *bufio.Reader
+	opts     ReaderOptions
+	next     func() ([]byte, error)
+	adaptive *adaptiveDecoder
+	decoded  []byte
+	ready    [][]byte
+	ended    bool
+	size     uint64
+	crc      uint32
+	// total counts the bytes decoded so far, for MaxSize
+	total int64
+	err   error
+	// legacy decodes a legacy file, which holds a tree when legacyTree is set and a
+	// frequency table otherwise
+	legacy     *legacyDecoder
+	legacyTree bool
+}
+
+// NewReader reads the container header from r and returns a Reader that decompresses
+// the rest of the stream using the default options
+func NewReader(r io.Reader) (*Reader, error) {
+	return NewReaderOptions(r, ReaderOptions{})
+}
+
+// NewReaderOptions reads the container header from r and returns a Reader that
+// decompresses the rest of the stream using opts
+func NewReaderOptions(r io.Reader, opts ReaderOptions) (*Reader, error) {
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	header, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkModel(header, opts.Model); err != nil {
+		return nil, err
+	}
+	if header.Encrypted() {
+		if br, err = newOpenReader(br, header, opts.Encryption); err != nil {
+			return nil, err
+		}
+	}
+
+	zr := &Reader{Header: header, r: br, opts: opts}
+	switch {
+	case header.Legacy():
+		if zr.legacy, zr.legacyTree, err = newLegacyDecoder(br); err != nil {
+			return nil, err
+		}
+		zr.next = zr.legacy.next
+	case header.Codec == CodecAdaptive:
+		zr.adaptive = newAdaptiveDecoder(br)
+		zr.next = zr.nextAdaptive
+	default:
+		zr.next = zr.nextBlock
+	}
+	return zr, nil
+}
+
+// Read decompresses into p, decoding the next block whenever the current one is used up
+func (zr *Reader) Read(p []byte) (int, error) {
+	for len(zr.decoded) == 0 {
+		if zr.err != nil {
+			return 0, zr.err
+		}
+		zr.decoded, zr.err = zr.next()
+		zr.total += int64(len(zr.decoded))
+		if zr.opts.MaxSize > 0 && zr.total > zr.opts.MaxSize {
+			zr.decoded = nil
+			zr.err = fmt.Errorf("%w: stream decompresses to more than %d bytes", ErrLimit, zr.opts.MaxSize)
+		}
+	}
+
+	n := copy(p, zr.decoded)
+	zr.decoded = zr.decoded[n:]
+	return n, nil
+}
+
+// nextBlock returns the next decoded block, decoding a new batch when the previous one
+// is used up. Once the end-of-stream block is reached it checks the footer and returns
+// io.EOF.
+func (zr *Reader) nextBlock() ([]byte, error) {
+	if len(zr.ready) == 0 {
+		if zr.ended {
+			return nil, zr.verifyFooter()
+		}
+		if err := zr.decodeBatch(); err != nil {
+			return nil, err
+		}
+		if len(zr.ready) == 0 {
+			return nil, zr.verifyFooter()
+		}
+	}
+
+	decoded := zr.ready[0]
+	zr.ready[0] = nil
+	zr.ready = zr.ready[1:]
+
+	zr.size += uint64(len(decoded))
+	zr.crc = crc32.Update(zr.crc, crc32.IEEETable, decoded)
+	return decoded, nil
+}
+
+// nextAdaptive returns the next piece of an adaptive stream. Once the stream has ended
+// it checks the footer and returns io.EOF.
+func (zr *Reader) nextAdaptive() ([]byte, error) {
+	if zr.adaptive.ended {
+		return nil, zr.verifyFooter()
+	}
+	decoded, err := zr.adaptive.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	zr.size += uint64(len(decoded))
+	zr.crc = crc32.Update(zr.crc, crc32.IEEETable, decoded)
+	return decoded, nil
+}
+
+// decodeBatch reads up to Concurrency blocks and decodes them in parallel
+func (zr *Reader) decodeBatch() error {
+	var decoders []func() ([]byte, error)
+	for len(decoders) < zr.opts.Concurrency {
+		blockType, err := zr.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if blockType == blockEnd {
+			zr.ended = true
+			break
+		}
+
+		decode, err := zr.readBlock(blockType)
+		if err != nil {
+			return err
+		}
+		decoders = append(decoders, decode)
+	}
+
+	decoded := make([][]byte, len(decoders))
+	errs := make([]error, len(decoders))
+	var wg sync.WaitGroup
+	for i, decode := range decoders {
+		wg.Add(1)
+		go func(i int, decode func() ([]byte, error)) {
+			defer wg.Done()
+			decoded[i], errs[i] = decode()
+		}(i, decode)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	zr.ready = decoded
+	return nil
+}
+
+func (zr *Reader) verifyFooter() error {
+	if zr.Header.Flags&flagIndex != 0 {
+		if _, err := readIndex(zr.r); err != nil {
+			return err
+		}
+	}
+	size, checksum, err := readFooter(zr.r)
+	if err != nil {
+		return err
+	}
+	if size != zr.size || checksum != zr.crc {
+		return ErrChecksum
+	}
+	return io.EOF
+}
+
+// readBlock reads the rest of a block once its type has been read. The returned
+// function decodes the block and may run concurrently with other blocks.
+func (zr *Reader) readBlock(blockType byte) (func() ([]byte, error), error) {
+	if err := zr.checkBlockLength(); err != nil {
+		return nil, err
+	}
+
+	switch blockType {
+	case blockLZH:
+		return readLZHBlock(zr.r)
+	case blockRange:
+		return readRangeBlock(zr.r)
+	case blockContext:
+		return readContextBlock(zr.r)
+	case blockBWT:
+		return zr.readBWTBlock()
+	case blockModel:
+		return readModelBlock(zr.r, zr.opts.Model)
+	case blockSymbols:
+		return readSymbolBlock(zr.r)
+	}
+	if blockType != blockTable && blockType != blockTree && blockType != blockCanonical && blockType != blockLimitedTable {
+		return nil, fmt.Errorf("%w: unknown block type %d", ErrCorrupt, blockType)
+	}
+
+	root, length, payload, err := zr.readHuffmanBlock(blockType)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		// A block with a single distinct symbol has an empty code, so the payload is empty
+		if root.Left == nil && root.Right == nil {
+			return bytes.Repeat([]byte{root.Char}, int(length)), nil
+		}
+
+		root.Freq = int(length)
+		return DecodeText(payload, root)
+	}, nil
+}
+
+// readHuffmanBlock reads the rest of a block coded with a single Huffman code for bytes,
+// returning its tree, the length of its original data and its payload
+func (zr *Reader) readHuffmanBlock(blockType byte) (*Node[byte], uint64, []byte, error) {
+	length, err := binary.ReadUvarint(zr.r)
+	if err != nil {
+		return nil, 0, nil, noEOF(err)
+	}
+
+	// Before version 3 frequency ties were left to the order of the heap
+	buildTree := BuildHuffmanTree
+	if zr.Header.Version < 3 {
+		buildTree = buildHeapOrderTree
+	}
+
+	var root *Node[byte]
+	switch blockType {
+	case blockCanonical:
+		var lengths [256]uint8
+		lengths, err = ReadCodeLengths(zr.r)
+		if err == nil {
+			root, err = BuildCanonicalTree(lengths)
+		}
+	case blockTree:
+		root, err = ReadTree(zr.r)
+	case blockLimitedTable:
+		var maxLength byte
+		maxLength, err = zr.r.ReadByte()
+		if err != nil {
+			break
+		}
+		var frequencies map[byte]int
+		frequencies, err = readBlockFrequencies(zr.r, length)
+		if err == nil && len(frequencies) > 0 {
+			// n symbols need codes of at least ceil(log2(n)) bits, and at least one bit
+			minLength := bits.Len(uint(len(frequencies) - 1))
+			if minLength < 1 {
+				minLength = 1
+			}
+			if int(maxLength) < minLength || int(maxLength) > maxCanonicalLength {
+				err = fmt.Errorf("%w: code length limit %d out of range %d-%d for %d symbols", ErrCorrupt, maxLength, minLength, maxCanonicalLength, len(frequencies))
+				break
+			}
+			root, _, err = limitTree(buildTree(frequencies), frequencies, int(maxLength))
+		}
+	default:
+		var frequencies map[byte]int
+		frequencies, err = readBlockFrequencies(zr.r, length)
+		if err == nil && len(frequencies) > 0 {
+			root = buildTree(frequencies)
+		}
+	}
+	if err != nil {
+		return nil, 0, nil, noEOF(err)
+	}
+	if root == nil {
+		return nil, 0, nil, fmt.Errorf("%w: block has no code description", ErrCorrupt)
+	}
+
+	payload, err := readPayload(zr.r)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return root, length, payload, nil
+}
+
+// checkBlockLength checks the length of the next block against MaxBlockSize. Every
+// block type starts with the uvarint length of its original data, so the length is
+// peeked at once here rather than in every block reader.
+func (zr *Reader) checkBlockLength() error {
+	buf, _ := zr.r.Peek(binary.MaxVarintLen64)
+	length, n := binary.Uvarint(buf)
+	if n > 0 && length > uint64(zr.opts.MaxBlockSize) {
+		return fmt.Errorf("%w: block of %d bytes exceeds %d", ErrLimit, length, zr.opts.MaxBlockSize)
+	}
+	return nil
+}
+
+// readBlockFrequencies reads the frequency table of a block, which must add up to the
+// length of the block
+func readBlockFrequencies(r io.Reader, length uint64) (map[byte]int, error) {
+	frequencies, err := ReadFrequencyTable(r)
+	if err != nil {
+		return nil, err
+	}
+	total := uint64(0)
+	for _, freq := range frequencies {
+		total += uint64(freq)
+	}
+	if total != length {
+		return nil, fmt.Errorf("%w: frequencies add up to %d in a block of %d bytes", ErrCorrupt, total, length)
+	}
+	return frequencies, nil
+}
+
+// readBytes reads n bytes. n comes from the stream, so only small reads are allocated up
+// front; larger ones grow with the data actually read, and a corrupt length can't make
+// the reader allocate much more memory than the stream holds.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	if n <= 64<<10 {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, noEOF(err)
+		}
+		return buf, nil
+	}
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: length %d out of range", ErrCorrupt, n)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		return nil, noEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeCapacity returns how much to allocate up front for a block of length bytes
+// decoded from a payload of the given size. Codes that can spend less than a bit on a
+// byte can't bound the length by their payload, so the output of a small payload grows
+// as it's decoded instead of being allocated in full for a length the stream claims.
+func decodeCapacity(length uint64, payload int) int {
+	capacity := uint64(payload) * 8
+	if capacity < 64<<10 {
+		capacity = 64 << 10
+	}
+	if capacity > length {
+		capacity = length
+	}
+	return int(capacity)
+}
+
+// noEOF reports a clean EOF in the middle of a block as a truncated stream
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	large := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), DefaultBlockSize/20)
+
+	tests := []struct {
+		name  string
+		input []byte
+		mode  HeaderMode
+	}{
+		{"Empty input", []byte{}, CanonicalHeader},
+		{"Single symbol", []byte("aaaaaaaa"), FrequencyTableHeader},
+		{"Single symbol canonical", []byte("aaaaaaaa"), CanonicalHeader},
+		{"Frequency table", []byte("abracadabra"), FrequencyTableHeader},
+		{"Tree", []byte("abracadabra"), TreeHeader},
+		{"Canonical", []byte("abracadabra"), CanonicalHeader},
+		{"Multiple blocks", large, FrequencyTableHeader},
+		{"Multiple blocks with tree", large, TreeHeader},
+		{"Multiple blocks canonical", large, CanonicalHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			zw, err := NewWriterOptions(&buf, WriterOptions{Header: tt.mode})
+			if err != nil {
+				t.Fatalf("NewWriterOptions returned an error: %v", err)
+			}
+			if _, err := zw.Write(tt.input); err != nil {
+				t.Fatalf("Write returned an error: %v", err)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatalf("Close returned an error: %v", err)
+			}
+
+			zr, err := NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, tt.input) {
+				t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(tt.input))
+			}
+		})
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+
+	zw.Write([]byte("hello "))
+	if err := zw.Flush(); err != nil {
+		t.Fatalf("Flush returned an error: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Fatalf("Flush didn't write a block")
+	}
+	zw.Write([]byte("world"))
+	zw.Close()
+
+	zr, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Reading the stream returned an error: %v", err)
+	}
+	if string(decoded) != "hello world" {
+		t.Errorf("Expected %q, got %q", "hello world", decoded)
+	}
+}
+
+func TestReaderTruncatedStream(t *testing.T) {
+	var buf bytes.Buffer
+	zw := NewWriter(&buf)
+	zw.Write([]byte("abracadabra"))
+	zw.Close()
+
+	truncated := buf.Bytes()[:buf.Len()-footerSize-3]
+	zr, err := NewReader(bytes.NewReader(truncated))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	_, err = io.ReadAll(zr)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	zw := NewWriter(io.Discard)
+	zw.Close()
+
+	if _, err := zw.Write([]byte("a")); err == nil {
+		t.Errorf("Write after Close should have returned an error")
+	}
+}
+
+func TestWriterConcurrency(t *testing.T) {
+	input := bytes.Repeat([]byte("It was the best of times, it was the worst of times.\n"), 5000)
+
+	var outputs [][]byte
+	for _, concurrency := range []int{1, 3, 8} {
+		var buf bytes.Buffer
+		zw, err := NewWriterOptions(&buf, WriterOptions{BlockSize: 4096, Concurrency: concurrency})
+		if err != nil {
+			t.Fatalf("NewWriterOptions returned an error: %v", err)
+		}
+		// Uneven writes so block boundaries don't line up with them
+		for rest := input; len(rest) > 0; {
+			n := 1000
+			if n > len(rest) {
+				n = len(rest)
+			}
+			zw.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatalf("Close returned an error: %v", err)
+		}
+		outputs = append(outputs, buf.Bytes())
+
+		for _, readers := range []int{1, 4} {
+			zr, err := NewReaderOptions(bytes.NewReader(buf.Bytes()), ReaderOptions{Concurrency: readers})
+			if err != nil {
+				t.Fatalf("NewReaderOptions returned an error: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Reading the stream returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, input) {
+				t.Errorf("Writer concurrency %d, reader concurrency %d: decoded output doesn't match input", concurrency, readers)
+			}
+		}
+	}
+
+	// Block boundaries only depend on the block size, not on how many blocks are
+	// encoded at once
+	for _, output := range outputs[1:] {
+		if !bytes.Equal(output, outputs[0]) {
+			t.Errorf("Output depends on the writer concurrency")
+		}
+	}
+}
+
+func TestWriterOptionsValidation(t *testing.T) {
+	invalid := []WriterOptions{
+		{Header: HeaderMode(7)},
+		{MaxCodeLength: 4},
+		{BlockSize: -1},
+		{BlockSize: MaxBlockSize + 1},
+		{Concurrency: -2},
+	}
+
+	for _, opts := range invalid {
+		if _, err := NewWriterOptions(io.Discard, opts); err == nil {
+			t.Errorf("Expected an error for options %+v", opts)
+		}
+	}
+}
+
+func TestEncodingIsReproducible(t *testing.T) {
+	// Lots of equal frequencies, so that any tie broken differently changes the output
+	var input []byte
+	for i := 0; i < 200; i++ {
+		input = append(input, byte(i%64), byte(i%64), 'x', byte(255-i%32))
+	}
+
+	for name, opts := range roundTripConfigs(t) {
+		t.Run(name, func(t *testing.T) {
+			opts.BlockSize = 256
+			opts.Concurrency = 4
+			var first []byte
+			for i := 0; i < 20; i++ {
+				var buf bytes.Buffer
+				zw, err := NewWriterOptions(&buf, opts)
+				if err != nil {
+					t.Fatalf("NewWriterOptions returned an error: %v", err)
+				}
+				zw.Write(input)
+				if err := zw.Close(); err != nil {
+					t.Fatalf("Close returned an error: %v", err)
+				}
+				if i == 0 {
+					first = buf.Bytes()
+				} else if !bytes.Equal(buf.Bytes(), first) {
+					t.Fatalf("Run %d gave different output", i)
+				}
+			}
+		})
+	}
+}
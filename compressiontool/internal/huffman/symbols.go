@@ -0,0 +1,474 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A symbol block codes its data as a sequence of larger symbols than bytes: UTF-8
+// encoded runes, or words and the runs of other characters between them. Symbols that
+// occur only once, or that don't make it into the alphabet, are coded as an escape code
+// followed by their bytes, so any data round trips, valid UTF-8 or not.
+//
+// The block holds the type, the uvarint length of the original data, the symbol mode,
+// the uvarint number of symbols in the alphabet, the alphabet, the code lengths of the
+// alphabet and the escape, the code lengths of the escaped bytes, the uvarint payload
+// length and the payload.
+//
+// The alphabet is sorted and front coded: every symbol is stored as the uvarint length
+// of the prefix it shares with the previous one, the uvarint length of the rest and the
+// rest. The code lengths of the alphabet, with the escape last, are Huffman coded
+// like the context tables of context.go. An escaped symbol is the escape code, the
+// Elias gamma coded length of the symbol and its bytes in the escaped byte code.
+
+// SymbolMode selects the alphabet of the symbols a block codes
+type SymbolMode byte
+
+const (
+	// ByteSymbols codes every byte as a symbol
+	ByteSymbols SymbolMode = iota
+	// RuneSymbols codes every UTF-8 encoded rune as a symbol
+	RuneSymbols
+	// WordSymbols codes every run of letters and digits, and every run of other
+	// characters between them, as a symbol
+	WordSymbols
+)
+
+const (
+	// symbolMaxAlphabet is the most symbols a block alphabet holds; the rest are escaped
+	symbolMaxAlphabet = 1 << 15
+	// symbolMaxCodeLength is the code length limit of symbol blocks
+	symbolMaxCodeLength = 24
+)
+
+// ParseSymbolMode returns the symbol mode called name: byte, rune or word
+func ParseSymbolMode(name string) (SymbolMode, error) {
+	for m := ByteSymbols; m <= WordSymbols; m++ {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("huffman: unknown symbol mode %q", name)
+}
+
+func (m SymbolMode) String() string {
+	switch m {
+	case ByteSymbols:
+		return "byte"
+	case RuneSymbols:
+		return "rune"
+	case WordSymbols:
+		return "word"
+	}
+	return fmt.Sprintf("SymbolMode(%d)", byte(m))
+}
+
+// Symbols splits data into the symbols of mode. Concatenating them gives back data.
+// In RuneSymbols mode, a byte that isn't part of a valid UTF-8 sequence is a symbol of
+// its own.
+func Symbols(data []byte, mode SymbolMode) []string {
+	var symbols []string
+	for i := 0; i < len(data); {
+		start := i
+		switch mode {
+		case RuneSymbols:
+			_, size := utf8.DecodeRune(data[i:])
+			i += size
+		case WordSymbols:
+			r, size := utf8.DecodeRune(data[i:])
+			word := isWordRune(r)
+			for i += size; i < len(data); i += size {
+				r, size = utf8.DecodeRune(data[i:])
+				if isWordRune(r) != word {
+					break
+				}
+			}
+		default:
+			i++
+		}
+		symbols = append(symbols, string(data[start:i]))
+	}
+	return symbols
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// CountSymbols returns the frequency of every symbol of mode in r
+func CountSymbols(r io.Reader, mode SymbolMode) (map[string]int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, symbol := range Symbols(data, mode) {
+		counts[symbol]++
+	}
+	return counts, nil
+}
+
+// symbolAlphabet returns the sorted symbols worth a code of their own: those that occur
+// more than once, keeping the most frequent ones if there are too many
+func symbolAlphabet(counts map[string]int) []string {
+	var alphabet []string
+	for symbol, count := range counts {
+		if count > 1 {
+			alphabet = append(alphabet, symbol)
+		}
+	}
+	if len(alphabet) > symbolMaxAlphabet {
+		sort.Slice(alphabet, func(i, j int) bool {
+			a, b := alphabet[i], alphabet[j]
+			return counts[a] > counts[b] || counts[a] == counts[b] && a < b
+		})
+		alphabet = alphabet[:symbolMaxAlphabet]
+	}
+	sort.Strings(alphabet)
+	return alphabet
+}
+
+// symbolCodeLengths returns code lengths for the n symbol indices counted in freqs, at
+// most symbolMaxCodeLength bits long. A lone symbol gets length 1.
+func symbolCodeLengths(freqs map[int]int, n int) ([]uint8, error) {
+	lengths := make([]uint8, n)
+	if len(freqs) == 0 {
+		return lengths, nil
+	}
+	root := BuildTree(freqs, func(a, b int) bool { return a < b })
+	if root.Left == nil && root.Right == nil {
+		lengths[root.Char] = 1
+		return lengths, nil
+	}
+	if fillSymbolLengths(root, 0, lengths) <= symbolMaxCodeLength {
+		return lengths, nil
+	}
+
+	// The tree is too deep, so fall back to package-merge like limitTree does
+	var leaves []pmItem
+	for i := range lengths {
+		lengths[i] = 0
+		if freq, ok := freqs[i]; ok {
+			leaves = append(leaves, pmItem{weight: freq, symbols: []uint16{uint16(i)}})
+		}
+	}
+	return lengths, packageMerge(leaves, symbolMaxCodeLength, lengths)
+}
+
+// fillSymbolLengths sets the depth of every leaf below node and returns the largest
+func fillSymbolLengths(node *Node[int], depth int, lengths []uint8) int {
+	if node.Left == nil && node.Right == nil {
+		lengths[node.Char] = uint8(depth)
+		return depth
+	}
+	left := fillSymbolLengths(node.Left, depth+1, lengths)
+	if right := fillSymbolLengths(node.Right, depth+1, lengths); right > left {
+		return right
+	}
+	return left
+}
+
+// canonicalSymbolCodes is CanonicalCodeTable for an alphabet of any size
+func canonicalSymbolCodes(lengths []uint8) []Code {
+	codes := make([]Code, len(lengths))
+	symbols := 0
+	for _, length := range lengths {
+		if length > 0 {
+			symbols++
+		}
+	}
+	// A lone symbol gets the empty code
+	if symbols == 1 {
+		return codes
+	}
+
+	nextCode := canonicalFirstCodes(lengths)
+	for i, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		codes[i] = Code{Bits: nextCode[length], Len: length}
+		nextCode[length]++
+	}
+	return codes
+}
+
+// buildSymbolTree is BuildCanonicalTree for an alphabet of any size. It returns nil when
+// no symbol has a code.
+func buildSymbolTree(lengths []uint8) (*Node[int], error) {
+	if err := validateLengths(lengths); err != nil {
+		return nil, err
+	}
+
+	var root *Node[int]
+	for i, code := range canonicalSymbolCodes(lengths) {
+		if lengths[i] == 0 {
+			continue
+		}
+		if code.Len == 0 {
+			return &Node[int]{Char: i}, nil
+		}
+
+		if root == nil {
+			root = &Node[int]{}
+		}
+		node := root
+		for bit := int(code.Len) - 1; bit >= 0; bit-- {
+			next := &node.Left
+			if (code.Bits>>uint(bit))&1 == 1 {
+				next = &node.Right
+			}
+			if *next == nil {
+				*next = &Node[int]{}
+			}
+			node = *next
+		}
+		node.Char = i
+	}
+	return root, nil
+}
+
+// writeGamma writes n, at least 1, as an Elias gamma code: as many zeros as n has bits
+// after the leading one, followed by n
+func writeGamma(w *bitWriter, n uint64) {
+	length := uint(bits.Len64(n))
+	w.writeBits(0, length-1)
+	w.writeBits(n, length)
+}
+
+// readGamma reads an Elias gamma code written by writeGamma
+func readGamma(br *bitReader) (uint64, error) {
+	zeros := uint(0)
+	for br.readBits(1) == 0 {
+		zeros++
+		if zeros > 32 || br.overrun() {
+			return 0, fmt.Errorf("%w: invalid escaped symbol length", ErrCorrupt)
+		}
+	}
+	return 1<<zeros | br.readBits(zeros), nil
+}
+
+// encodeSymbolBlock writes data as a symbol block
+func encodeSymbolBlock(w *bytes.Buffer, data []byte, mode SymbolMode) error {
+	symbols := Symbols(data, mode)
+	counts := make(map[string]int)
+	for _, symbol := range symbols {
+		counts[symbol]++
+	}
+	alphabet := symbolAlphabet(counts)
+	index := make(map[string]int, len(alphabet))
+	for i, symbol := range alphabet {
+		index[symbol] = i
+	}
+	escape := len(alphabet)
+
+	freqs := make(map[int]int)
+	var escapedCounts [256]int
+	for _, symbol := range symbols {
+		i, ok := index[symbol]
+		if !ok {
+			i = escape
+			for j := 0; j < len(symbol); j++ {
+				escapedCounts[symbol[j]]++
+			}
+		}
+		freqs[i]++
+	}
+
+	lengths, err := symbolCodeLengths(freqs, len(alphabet)+1)
+	if err != nil {
+		return err
+	}
+	codes := canonicalSymbolCodes(lengths)
+	escapedLengths, err := lzhCodeLengths(&escapedCounts, DefaultMaxCodeLength)
+	if err != nil {
+		return err
+	}
+	escapedTable := CanonicalCodeTable(escapedLengths)
+
+	w.WriteByte(blockSymbols)
+	writeUvarint(w, uint64(len(data)))
+	w.WriteByte(byte(mode))
+	writeUvarint(w, uint64(len(alphabet)))
+	previous := ""
+	for _, symbol := range alphabet {
+		shared := 0
+		for shared < len(previous) && shared < len(symbol) && previous[shared] == symbol[shared] {
+			shared++
+		}
+		writeUvarint(w, uint64(shared))
+		writeUvarint(w, uint64(len(symbol)-shared))
+		w.WriteString(symbol[shared:])
+		previous = symbol
+	}
+
+	var lengthCounts [256]int
+	for _, length := range lengths {
+		lengthCounts[length]++
+	}
+	lengthsLengths, err := lzhCodeLengths(&lengthCounts, DefaultMaxCodeLength)
+	if err != nil {
+		return err
+	}
+	if err := WriteCodeLengths(lengthsLengths, w); err != nil {
+		return err
+	}
+	encodedLengths := CanonicalCodeTable(lengthsLengths).Encode(lengths)
+	writeUvarint(w, uint64(len(encodedLengths)))
+	w.Write(encodedLengths)
+	if err := WriteCodeLengths(escapedLengths, w); err != nil {
+		return err
+	}
+
+	bw := bitWriter{out: make([]byte, 0, len(data)/3+8)}
+	for _, symbol := range symbols {
+		if i, ok := index[symbol]; ok {
+			bw.writeBits(codes[i].Bits, uint(codes[i].Len))
+			continue
+		}
+		bw.writeBits(codes[escape].Bits, uint(codes[escape].Len))
+		writeGamma(&bw, uint64(len(symbol)))
+		for j := 0; j < len(symbol); j++ {
+			code := escapedTable[symbol[j]]
+			bw.writeBits(code.Bits, uint(code.Len))
+		}
+	}
+	encoded := bw.flush()
+
+	writeUvarint(w, uint64(len(encoded)))
+	w.Write(encoded)
+	return nil
+}
+
+// readSymbolBlock reads the rest of a symbol block once its type has been read
+func readSymbolBlock(r *bufio.Reader) (func() ([]byte, error), error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	mode, err := r.ReadByte()
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if SymbolMode(mode) != RuneSymbols && SymbolMode(mode) != WordSymbols {
+		return nil, fmt.Errorf("%w: unknown symbol mode %d", ErrCorrupt, mode)
+	}
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if n > symbolMaxAlphabet {
+		return nil, fmt.Errorf("%w: alphabet of %d symbols", ErrCorrupt, n)
+	}
+	alphabet := make([]string, n)
+	previous := ""
+	// Every symbol of the alphabet occurs in the block, so together they can't be longer
+	// than it, which bounds the memory the alphabet takes
+	size := uint64(0)
+	for i := range alphabet {
+		shared, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		rest, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, noEOF(err)
+		}
+		if shared > uint64(len(previous)) || rest > length || shared+rest == 0 {
+			return nil, fmt.Errorf("%w: invalid alphabet symbol", ErrCorrupt)
+		}
+		if size += shared + rest; size > length {
+			return nil, fmt.Errorf("%w: alphabet longer than the block of %d bytes", ErrCorrupt, length)
+		}
+		suffix, err := readBytes(r, rest)
+		if err != nil {
+			return nil, err
+		}
+		alphabet[i] = previous[:shared] + string(suffix)
+		previous = alphabet[i]
+	}
+
+	lengthsLengths, err := ReadCodeLengths(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	encodedLengths, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+	escapedLengths, err := ReadCodeLengths(r)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	payload, err := readPayload(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() ([]byte, error) {
+		lengths, err := decodeCanonical(lengthsLengths, encodedLengths, len(alphabet)+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lengths {
+			if l > symbolMaxCodeLength {
+				return nil, fmt.Errorf("%w: symbol code length %d exceeds %d", ErrCorrupt, l, symbolMaxCodeLength)
+			}
+		}
+		root, err := buildSymbolTree(lengths)
+		if err != nil {
+			return nil, err
+		}
+		escaped, err := newLengthsDecoder(escapedLengths)
+		if err != nil {
+			return nil, err
+		}
+
+		// A word codes many bytes in a few bits, so the output grows as it's decoded
+		decoded := make([]byte, 0, decodeCapacity(length, len(payload)))
+		br := newBitReader(payload)
+		for uint64(len(decoded)) < length {
+			if root == nil {
+				return nil, fmt.Errorf("%w: block has no symbol code", ErrCorrupt)
+			}
+			i, err := walkTree(br, root)
+			if err != nil {
+				return nil, err
+			}
+			if br.overrun() {
+				return nil, fmt.Errorf("%w: payload ends after %d of %d bytes", ErrCorrupt, len(decoded), length)
+			}
+			if i < len(alphabet) {
+				decoded = append(decoded, alphabet[i]...)
+				continue
+			}
+
+			size, err := readGamma(br)
+			if err != nil {
+				return nil, err
+			}
+			if size > length-uint64(len(decoded)) || escaped == nil {
+				return nil, fmt.Errorf("%w: invalid escaped symbol", ErrCorrupt)
+			}
+			for j := uint64(0); j < size; j++ {
+				b, err := br.readSymbol(escaped)
+				if err != nil {
+					return nil, err
+				}
+				decoded = append(decoded, b)
+			}
+		}
+		if uint64(len(decoded)) != length || br.overrun() {
+			return nil, fmt.Errorf("%w: symbol block doesn't decode to %d bytes", ErrCorrupt, length)
+		}
+		return decoded, nil
+	}, nil
+}
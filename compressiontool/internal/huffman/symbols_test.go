@@ -0,0 +1,156 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func encodeSymbols(t *testing.T, input []byte, mode SymbolMode) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := NewWriterOptions(&buf, WriterOptions{Symbols: mode})
+	if err != nil {
+		t.Fatalf("NewWriterOptions returned an error: %v", err)
+	}
+	if _, err := zw.Write(input); err != nil {
+		t.Fatalf("Write returned an error: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Close returned an error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSymbols(t *testing.T) {
+	input := []byte("Grüße, 世界!\xff ok")
+
+	tests := []struct {
+		mode SymbolMode
+		want []string
+	}{
+		{RuneSymbols, []string{"G", "r", "ü", "ß", "e", ",", " ", "世", "界", "!", "\xff", " ", "o", "k"}},
+		{WordSymbols, []string{"Grüße", ", ", "世界", "!\xff ", "ok"}},
+	}
+
+	for _, tt := range tests {
+		got := Symbols(input, tt.mode)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s symbols: expected %q, got %q", tt.mode, tt.want, got)
+		}
+		if strings.Join(got, "") != string(input) {
+			t.Errorf("%s symbols don't add up to the input", tt.mode)
+		}
+	}
+}
+
+func TestBuildTreeOverWords(t *testing.T) {
+	freqs := map[string]int{"the": 50, "cat": 20, "sat": 20, "on": 5, "mat": 5}
+
+	codes := GenerateCodes(BuildTree(freqs, func(a, b string) bool { return a < b }))
+	if len(codes) != len(freqs) {
+		t.Fatalf("Expected %d codes, got %d", len(freqs), len(codes))
+	}
+	for word, code := range codes {
+		if len(code) < len(codes["the"]) {
+			t.Errorf("Code %q of %q is shorter than the code of the most frequent word", code, word)
+		}
+		for other, otherCode := range codes {
+			if word != other && strings.HasPrefix(otherCode, code) {
+				t.Errorf("Code %q of %q is a prefix of the code of %q", code, word, other)
+			}
+		}
+	}
+}
+
+func TestSymbolCodeLengthsLimited(t *testing.T) {
+	// Fibonacci frequencies give the deepest possible tree
+	freqs := make(map[int]int)
+	a, b := 1, 1
+	for i := 0; i < 40; i++ {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+
+	lengths, err := symbolCodeLengths(freqs, 40)
+	if err != nil {
+		t.Fatalf("symbolCodeLengths returned an error: %v", err)
+	}
+	for i, length := range lengths {
+		if length == 0 || length > symbolMaxCodeLength {
+			t.Errorf("Symbol %d got code length %d", i, length)
+		}
+	}
+	if err := validateLengths(lengths); err != nil {
+		t.Errorf("Limited lengths aren't a complete code: %v", err)
+	}
+}
+
+func TestSymbolRoundTrip(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(6)).Read(random)
+
+	inputs := map[string][]byte{
+		"Empty":         {},
+		"Single symbol": bytes.Repeat([]byte("héllo"), 1000),
+		"Unique words":  []byte("every word here occurs once"),
+		"Mixed scripts": bytes.Repeat([]byte("Grüße aus 東京, привет мир! "), 200),
+		"Invalid UTF-8": []byte("ab\xff\xfe\xc3cd\xe4\xb8 ab\xff\xfe\xc3cd\xe4\xb8"),
+		"Random":        random,
+		"Corpus":        readCorpus(t),
+	}
+
+	for _, mode := range []SymbolMode{RuneSymbols, WordSymbols} {
+		for name, input := range inputs {
+			t.Run(mode.String()+"/"+name, func(t *testing.T) {
+				encoded := encodeSymbols(t, input, mode)
+
+				zr, err := NewReader(bytes.NewReader(encoded))
+				if err != nil {
+					t.Fatalf("NewReader returned an error: %v", err)
+				}
+				decoded, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("Reading the stream returned an error: %v", err)
+				}
+				if !bytes.Equal(decoded, input) {
+					t.Errorf("Decoded output doesn't match input. Got %d bytes, want %d", len(decoded), len(input))
+				}
+			})
+		}
+	}
+}
+
+func TestWordSymbolsBeatBytesOnText(t *testing.T) {
+	corpus := readCorpus(t)
+	bytewise := encodeCodec(t, corpus, CodecHuffman)
+	words := encodeSymbols(t, corpus, WordSymbols)
+
+	if len(words) > len(bytewise)*80/100 {
+		t.Errorf("Expected word symbols to save at least 20%% over %d bytes, got %d", len(bytewise), len(words))
+	}
+}
+
+func TestReaderRejectsLongAlphabet(t *testing.T) {
+	// Every symbol repeats the whole previous one and adds ten bytes, so the alphabet
+	// outgrows the block of 100 bytes long before the symbols themselves would
+	block := []byte{blockSymbols, 100, byte(WordSymbols), 20}
+	for i := 0; i < 20; i++ {
+		block = binary.AppendUvarint(block, uint64(10*i))
+		block = append(block, 10)
+		block = append(block, bytes.Repeat([]byte{'x'}, 10)...)
+	}
+
+	zr, err := NewReader(bytes.NewReader(craftStream(block)))
+	if err != nil {
+		t.Fatalf("NewReader returned an error: %v", err)
+	}
+	if _, err := io.ReadAll(zr); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+	}
+}
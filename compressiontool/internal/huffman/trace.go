@@ -0,0 +1,195 @@
+package huffman
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TraceEvent describes one bit read while decoding a Huffman code
+type TraceEvent struct {
+	// Block is the index of the block holding the bit in its stream
+	Block int
+	// Bit is the offset of the bit, counted in bits from the start of the input and
+	// from the most significant bit of every byte
+	Bit int64
+	// Byte is the input byte holding the bit
+	Byte byte
+	// Value is the bit itself, 0 or 1
+	Value byte
+	// Path holds the bits read since the root of the tree, ending with this one
+	Path string
+	// Leaf is set when the path reaches a leaf, decoding Symbol
+	Leaf   bool
+	Symbol byte
+	// Position is the offset in the decoded data of the symbol the bit belongs to
+	Position int64
+}
+
+// TraceText decodes root.Freq symbols from the input like DecodeText, but one bit at a
+// time, calling fn for every bit read. Decoding stops at the first error fn returns,
+// which TraceText returns. A tree that is a single leaf reads no bits at all. If the
+// input ends before every symbol is decoded TraceText returns io.ErrUnexpectedEOF.
+func TraceText(input []byte, root *Node[byte], fn func(TraceEvent) error) error {
+	return traceText(input, root, TraceEvent{}, 0, fn)
+}
+
+// traceText traces the decoding of input, whose first bit and symbol are at the Bit and
+// Position of start. Bits before from are decoded without calling fn.
+func traceText(input []byte, root *Node[byte], start TraceEvent, from int64, fn func(TraceEvent) error) error {
+	if root == nil {
+		return fmt.Errorf("%w: missing Huffman tree", ErrCorrupt)
+	}
+	if root.Freq < 0 {
+		return fmt.Errorf("%w: negative symbol count %d", ErrCorrupt, root.Freq)
+	}
+	if root.Left == nil && root.Right == nil {
+		return nil
+	}
+
+	event := start
+	// Paths are only turned into strings for the events passed to fn
+	var path []byte
+	node := root
+	decoded := 0
+	for _, b := range input {
+		event.Byte = b
+		for i := 7; i >= 0; i-- {
+			if decoded == root.Freq {
+				return nil
+			}
+
+			event.Value = b >> i & 1
+			if event.Value == 0 {
+				node = node.Left
+			} else {
+				node = node.Right
+			}
+			path = append(path, '0'+event.Value)
+			event.Leaf = node != nil && node.Left == nil && node.Right == nil
+			if event.Bit >= from {
+				event.Path = string(path)
+				event.Symbol = 0
+				if event.Leaf {
+					event.Symbol = node.Char
+				}
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+
+			if node == nil {
+				return fmt.Errorf("%w: code %s at bit %d matches no symbol", ErrCorrupt, path, event.Bit)
+			}
+			if event.Leaf {
+				decoded++
+				event.Position++
+				node = root
+				path = path[:0]
+			}
+			event.Bit++
+		}
+	}
+	if decoded != root.Freq {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// Trace reads the container from r and traces the decoding of its Huffman coded
+// blocks, calling fn for every bit of their payloads from the bit at offset from on,
+// counted from the start of r. Decoding stops at the first error fn returns, which
+// Trace returns.
+//
+// Only blocks coded with a single Huffman code for bytes can be traced; the blocks of
+// other codecs and symbol modes are read and skipped, as are blocks whose payload ends
+// before from. Trace stops at the end of the blocks, without checking the footer.
+func Trace(r io.Reader, opts ReaderOptions, from int64, fn func(TraceEvent) error) error {
+	counter := &countingReader{r: r}
+	br := bufio.NewReader(counter)
+	offset := func() int64 {
+		return counter.n - int64(br.Buffered())
+	}
+
+	zr, err := NewReaderOptions(br, opts)
+	if err != nil {
+		return err
+	}
+	switch {
+	case zr.Header.Legacy():
+		return errors.New("huffman: legacy streams can't be traced")
+	case zr.Header.Codec == CodecAdaptive:
+		return errors.New("huffman: adaptive streams can't be traced")
+	case zr.Header.Encrypted():
+		// Bit offsets in the decrypted blocks don't match the bits of the file
+		return errors.New("huffman: encrypted streams can't be traced")
+	}
+
+	event := TraceEvent{}
+	for ; ; event.Block++ {
+		blockType, err := br.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if blockType == blockEnd {
+			return nil
+		}
+		if err := zr.checkBlockLength(); err != nil {
+			return err
+		}
+
+		var root *Node[byte]
+		var length uint64
+		var payload []byte
+		switch blockType {
+		case blockTable, blockTree, blockCanonical, blockLimitedTable:
+			root, length, payload, err = zr.readHuffmanBlock(blockType)
+		case blockModel:
+			if opts.Model == nil {
+				return fmt.Errorf("%w: model block in a stream without a model", ErrCorrupt)
+			}
+			// The tree of the model is shared, so the symbol count is set on a copy
+			model := *opts.Model.root
+			root = &model
+			if length, err = binary.ReadUvarint(br); err != nil {
+				return noEOF(err)
+			}
+			payload, err = readPayload(br)
+		default:
+			// The length of the block is peeked before readBlock consumes it
+			buf, _ := br.Peek(binary.MaxVarintLen64)
+			length, _ = binary.Uvarint(buf)
+			_, err = zr.readBlock(blockType)
+		}
+		if err != nil {
+			return err
+		}
+
+		event.Bit = (offset() - int64(len(payload))) * 8
+		if root != nil && event.Bit+int64(len(payload))*8 > from {
+			root.Freq = int(length)
+			err := traceText(payload, root, event, from, fn)
+			if err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%w: payload of block %d ends after too few symbols", ErrCorrupt, event.Block)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		event.Position += int64(length)
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,185 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestTraceText(t *testing.T) {
+	root := &Node[byte]{
+		Freq: 4,
+		Left: &Node[byte]{Char: 'a', Freq: 1},
+		Right: &Node[byte]{
+			Freq: 3,
+			Left: &Node[byte]{Char: 'b', Freq: 1},
+			Right: &Node[byte]{
+				Freq:  2,
+				Left:  &Node[byte]{Char: 'c', Freq: 1},
+				Right: &Node[byte]{Char: 'd', Freq: 1},
+			},
+		},
+	}
+	input := []byte{0b01011011, 0b10000001}
+
+	var events []TraceEvent
+	err := TraceText(input, root, func(e TraceEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TraceText returned an error: %v", err)
+	}
+
+	expected := []TraceEvent{
+		{Bit: 0, Byte: input[0], Value: 0, Path: "0", Leaf: true, Symbol: 'a', Position: 0},
+		{Bit: 1, Byte: input[0], Value: 1, Path: "1", Position: 1},
+		{Bit: 2, Byte: input[0], Value: 0, Path: "10", Leaf: true, Symbol: 'b', Position: 1},
+		{Bit: 3, Byte: input[0], Value: 1, Path: "1", Position: 2},
+		{Bit: 4, Byte: input[0], Value: 1, Path: "11", Position: 2},
+		{Bit: 5, Byte: input[0], Value: 0, Path: "110", Leaf: true, Symbol: 'c', Position: 2},
+		{Bit: 6, Byte: input[0], Value: 1, Path: "1", Position: 3},
+		{Bit: 7, Byte: input[0], Value: 1, Path: "11", Position: 3},
+		{Bit: 8, Byte: input[1], Value: 1, Path: "111", Leaf: true, Symbol: 'd', Position: 3},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("TraceText reported\n%+v\nwant\n%+v", events, expected)
+	}
+
+	t.Run("Input too short", func(t *testing.T) {
+		err := TraceText(input[:1], root, func(TraceEvent) error { return nil })
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("TraceText returned %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	})
+
+	t.Run("Stopped by callback", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := TraceText(input, root, func(TraceEvent) error {
+			calls++
+			if calls == 3 {
+				return stop
+			}
+			return nil
+		})
+		if err != stop || calls != 3 {
+			t.Errorf("TraceText returned %v after %d calls, want %v after 3", err, calls, stop)
+		}
+	})
+
+	t.Run("Missing tree", func(t *testing.T) {
+		if err := TraceText(input, nil, func(TraceEvent) error { return nil }); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("TraceText returned %v, want %v", err, ErrCorrupt)
+		}
+	})
+}
+
+func TestTrace(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra, the quick brown fox. "), 40)
+	frequencies, _ := CountFrequencies(bytes.NewReader(data))
+	model, err := TrainModel(frequencies)
+	if err != nil {
+		t.Fatalf("TrainModel returned an error: %v", err)
+	}
+
+	testCases := map[string]WriterOptions{
+		"Canonical":     {BlockSize: 256},
+		"Tree":          {BlockSize: 256, Header: TreeHeader},
+		"Table":         {BlockSize: 256, Header: FrequencyTableHeader},
+		"Limited table": {BlockSize: 256, Header: FrequencyTableHeader, MaxCodeLength: 8},
+		"Model":         {BlockSize: 256, Model: model},
+	}
+	for name, opts := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var stream bytes.Buffer
+			zw, err := NewWriterOptions(&stream, opts)
+			if err != nil {
+				t.Fatalf("NewWriterOptions returned an error: %v", err)
+			}
+			zw.Write(data)
+			zw.Close()
+			encoded := stream.Bytes()
+
+			var decoded []byte
+			blocks := map[int]bool{}
+			err = Trace(bytes.NewReader(encoded), ReaderOptions{Model: opts.Model}, 0, func(e TraceEvent) error {
+				if e.Byte != encoded[e.Bit/8] || e.Value != encoded[e.Bit/8]>>(7-e.Bit%8)&1 {
+					t.Fatalf("Bit %d is reported as %d of %#x, stream holds %#x", e.Bit, e.Value, e.Byte, encoded[e.Bit/8])
+				}
+				if e.Leaf {
+					if e.Position != int64(len(decoded)) {
+						t.Fatalf("Symbol at bit %d is reported at position %d, want %d", e.Bit, e.Position, len(decoded))
+					}
+					decoded = append(decoded, e.Symbol)
+				}
+				blocks[e.Block] = true
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Trace returned an error: %v", err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("Traced symbols don't match the data")
+			}
+			if want := (len(data) + 255) / 256; len(blocks) != want {
+				t.Errorf("Traced %d blocks, want %d", len(blocks), want)
+			}
+
+			// Tracing from a later bit reports exactly the events from that bit on
+			from := int64(len(encoded) * 8 / 2)
+			first := TraceEvent{Bit: -1}
+			err = Trace(bytes.NewReader(encoded), ReaderOptions{Model: opts.Model}, from, func(e TraceEvent) error {
+				first = e
+				return errors.New("stop")
+			})
+			if err == nil || first.Bit < from || first.Bit > from+64 {
+				t.Errorf("Tracing from bit %d started at bit %d", from, first.Bit)
+			}
+		})
+	}
+}
+
+func TestTraceSkipsOtherCodecs(t *testing.T) {
+	data := bytes.Repeat([]byte("abracadabra "), 100)
+	for _, codec := range []Codec{CodecLZH, CodecRange, CodecContext, CodecBWT} {
+		var stream bytes.Buffer
+		zw, _ := NewWriterOptions(&stream, WriterOptions{Codec: codec})
+		zw.Write(data)
+		zw.Close()
+
+		events := 0
+		err := Trace(&stream, ReaderOptions{}, 0, func(TraceEvent) error {
+			events++
+			return nil
+		})
+		if err != nil || events != 0 {
+			t.Errorf("Tracing %s returned %v after %d events, want no error and no events", codec, err, events)
+		}
+	}
+
+	var stream bytes.Buffer
+	zw, _ := NewWriterOptions(&stream, WriterOptions{Codec: CodecAdaptive})
+	zw.Write(data)
+	zw.Close()
+	if err := Trace(&stream, ReaderOptions{}, 0, func(TraceEvent) error { return nil }); err == nil {
+		t.Errorf("Tracing an adaptive stream should have returned an error")
+	}
+}
+
+func TestTraceShortPayload(t *testing.T) {
+	// A block of 9 symbols with one bit codes and a single payload byte
+	tree := []byte{1, 2, 0, 0, 0, 0, 1, 1, 0, 0, 0, 1, 'a', 1, 1, 0, 0, 0, 1, 'b'}
+	block := append(append([]byte{blockTree, 9}, tree...), 1, 0b01010101, blockEnd)
+
+	events := 0
+	err := Trace(bytes.NewReader(craftStream(block)), ReaderOptions{}, 0, func(TraceEvent) error {
+		events++
+		return nil
+	})
+	if !errors.Is(err, ErrCorrupt) || events != 8 {
+		t.Errorf("Trace returned %v after %d events, want %v after 8", err, events, ErrCorrupt)
+	}
+}
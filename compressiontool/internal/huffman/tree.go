@@ -1,34 +1,47 @@
 package huffman
 
 import (
+	"bytes"
 	"container/heap"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
 )
 
-// Node represents a node in the Huffman tree
-type Node struct {
-	Char  byte
+// Node represents a node in the Huffman tree. T is the type of the symbols: byte for
+// the byte-oriented codecs, and rune, string or symbol indices for larger alphabets.
+type Node[T comparable] struct {
+	Char  T
 	Freq  int
-	Left  *Node
-	Right *Node
+	Left  *Node[T]
+	Right *Node[T]
+
+	// order breaks frequency ties in a PriorityQueue. BuildTree numbers the leaves in
+	// symbol order and the internal nodes after them in the order they are created.
+	order int
 }
 
-// PriorityQueue implements heap.Interface and holds Nodes
-type PriorityQueue []*Node
+// PriorityQueue implements heap.Interface and holds Nodes, lowest frequency first
+type PriorityQueue[T comparable] []*Node[T]
 
-func (pq PriorityQueue) Len() int           { return len(pq) }
-func (pq PriorityQueue) Less(i, j int) bool { return pq[i].Freq < pq[j].Freq }
-func (pq PriorityQueue) Swap(i, j int)      { pq[i], pq[j] = pq[j], pq[i] }
+func (pq PriorityQueue[T]) Len() int { return len(pq) }
+func (pq PriorityQueue[T]) Less(i, j int) bool {
+	if pq[i].Freq != pq[j].Freq {
+		return pq[i].Freq < pq[j].Freq
+	}
+	return pq[i].order < pq[j].order
+}
+func (pq PriorityQueue[T]) Swap(i, j int) { pq[i], pq[j] = pq[j], pq[i] }
 
-func (pq *PriorityQueue) Push(x interface{}) {
-	item := x.(*Node)
+func (pq *PriorityQueue[T]) Push(x interface{}) {
+	item := x.(*Node[T])
 	*pq = append(*pq, item)
 }
 
-func (pq *PriorityQueue) Pop() interface{} {
+func (pq *PriorityQueue[T]) Pop() interface{} {
 	old := *pq
 	n := len(old)
 	item := old[n-1]
@@ -37,42 +50,86 @@ func (pq *PriorityQueue) Pop() interface{} {
 }
 
 // BuildHuffmanTree constructs a Huffman tree from the given frequency map
-func BuildHuffmanTree(freqs map[byte]int) *Node {
-	pq := make(PriorityQueue, 0)
+func BuildHuffmanTree(freqs map[byte]int) *Node[byte] {
+	return BuildTree(freqs, func(a, b byte) bool { return a < b })
+}
+
+// buildHeapOrderTree constructs a Huffman tree the way BuildHuffmanTree did before
+// format version 3, leaving frequency ties to the order of the heap. Decoders rebuild
+// the trees of frequency tables from older streams, and the codes of model files, this
+// way.
+func buildHeapOrderTree(freqs map[byte]int) *Node[byte] {
+	return buildTree(freqs, func(a, b byte) bool { return a < b }, false)
+}
+
+// BuildTree constructs a Huffman tree over any alphabet from the given frequency map.
+// The tree only depends on the frequencies: nodes of equal frequency are combined
+// leaves first, in the order given by less, then internal nodes in the order they
+// were created. A decoder rebuilding the tree from a frequency table ends up with
+// exactly the tree the encoder used, and encoding the same data always gives the same
+// bytes.
+func BuildTree[T comparable](freqs map[T]int, less func(a, b T) bool) *Node[T] {
+	return buildTree(freqs, less, true)
+}
+
+// buildTree constructs a Huffman tree, breaking frequency ties by node order if ordered
+// is set and by heap order otherwise
+func buildTree[T comparable](freqs map[T]int, less func(a, b T) bool, ordered bool) *Node[T] {
+	symbols := make([]T, 0, len(freqs))
+	for symbol := range freqs {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return less(symbols[i], symbols[j]) })
+
+	pq := make(PriorityQueue[T], 0, len(symbols))
 	heap.Init(&pq)
 
-	// Create leaf nodes for each character and add to the priority queue
-	for char, freq := range freqs {
-		heap.Push(&pq, &Node{Char: char, Freq: freq})
+	// Create leaf nodes for each symbol and add to the priority queue
+	for i, symbol := range symbols {
+		leaf := &Node[T]{Char: symbol, Freq: freqs[symbol]}
+		if ordered {
+			leaf.order = i
+		}
+		heap.Push(&pq, leaf)
 	}
 
 	// Build the tree by combining nodes
+	next := len(symbols)
 	for pq.Len() > 1 {
-		left := heap.Pop(&pq).(*Node)
-		right := heap.Pop(&pq).(*Node)
-		parent := &Node{
+		left := heap.Pop(&pq).(*Node[T])
+		right := heap.Pop(&pq).(*Node[T])
+		parent := &Node[T]{
 			Freq:  left.Freq + right.Freq,
 			Left:  left,
 			Right: right,
 		}
+		if ordered {
+			parent.order = next
+			next++
+		}
 		heap.Push(&pq, parent)
 	}
 
 	// Return the root of the Huffman tree
-	return heap.Pop(&pq).(*Node)
+	return heap.Pop(&pq).(*Node[T])
 }
 
 // HuffmanCode represents the mapping of characters to their Huffman codes
 type HuffmanCode map[byte]string
 
 // GenerateHuffmanCodes creates a mapping of characters to their Huffman codes
-func GenerateHuffmanCodes(root *Node) HuffmanCode {
-	codes := make(HuffmanCode)
+func GenerateHuffmanCodes(root *Node[byte]) HuffmanCode {
+	return GenerateCodes(root)
+}
+
+// GenerateCodes creates a mapping of the symbols of any tree to their Huffman codes
+func GenerateCodes[T comparable](root *Node[T]) map[T]string {
+	codes := make(map[T]string)
 	generateCodesRecursive(root, "", codes)
 	return codes
 }
 
-func generateCodesRecursive(node *Node, currentCode string, codes HuffmanCode) {
+func generateCodesRecursive[T comparable](node *Node[T], currentCode string, codes map[T]string) {
 	if node == nil {
 		return
 	}
@@ -92,34 +149,11 @@ func generateCodesRecursive(node *Node, currentCode string, codes HuffmanCode) {
 
 // EncodeText encodes the input text using the generated Huffman codes
 func EncodeText(input []byte, codes HuffmanCode) []byte {
-	var encoded []byte
-	var currentByte byte
-	bitCount := 0
-
-	for _, b := range input {
-		code := codes[b]
-		for _, bit := range code {
-			if bit == '1' {
-				currentByte |= 1 << (7 - bitCount)
-			}
-			bitCount++
-			if bitCount == 8 {
-				encoded = append(encoded, currentByte)
-				currentByte = 0
-				bitCount = 0
-			}
-		}
-	}
-
-	if bitCount > 0 {
-		encoded = append(encoded, currentByte)
-	}
-
-	return encoded
+	return codes.Table().Encode(input)
 }
 
 // WriteTree writes the Huffman tree structure to the given writer
-func WriteTree(node *Node, w io.Writer) error {
+func WriteTree(node *Node[byte], w io.Writer) error {
 	if node == nil {
 		return binary.Write(w, binary.LittleEndian, uint8(0))
 	}
@@ -149,14 +183,19 @@ func WriteTree(node *Node, w io.Writer) error {
 	return WriteTree(node.Right, w)
 }
 
-// WriteFrequencyTable writes the character frequency table to the given writer
+// WriteFrequencyTable writes the character frequency table to the given writer, in
+// byte order so that the same table is always written the same way
 func WriteFrequencyTable(freqs map[byte]int, w io.Writer) error {
 	if err := binary.Write(w, binary.LittleEndian, uint32(len(freqs))); err != nil {
 		return err
 	}
 
-	for char, freq := range freqs {
-		if err := binary.Write(w, binary.LittleEndian, char); err != nil {
+	for c := 0; c < 256; c++ {
+		freq, ok := freqs[byte(c)]
+		if !ok {
+			continue
+		}
+		if err := binary.Write(w, binary.LittleEndian, byte(c)); err != nil {
 			return err
 		}
 		if err := binary.Write(w, binary.LittleEndian, uint32(freq)); err != nil {
@@ -167,43 +206,75 @@ func WriteFrequencyTable(freqs map[byte]int, w io.Writer) error {
 	return nil
 }
 
-// ReadTree reads a Huffman tree from the given reader
-func ReadTree(r io.Reader) (*Node, error) {
+// maxTreeDepth is the deepest a Huffman tree over bytes can be: every internal node has
+// two children, so a tree with at most 256 leaves has at most 255 levels below its root
+const maxTreeDepth = 255
+
+// ReadTree reads a Huffman tree from the given reader. Trees no encoder could have
+// written are rejected with ErrCorrupt: every internal node must have two children, no
+// byte may appear in more than one leaf and the tree may be at most maxTreeDepth deep.
+func ReadTree(r io.Reader) (*Node[byte], error) {
+	var seen [256]bool
+	return readTree(r, &seen, 0)
+}
+
+func readTree(r io.Reader, seen *[256]bool, depth int) (*Node[byte], error) {
 	var nodeType uint8
 	if err := binary.Read(r, binary.LittleEndian, &nodeType); err != nil {
 		return nil, err
 	}
 
 	if nodeType == 0 {
+		// Only an empty tree is written as a missing node
+		if depth > 0 {
+			return nil, fmt.Errorf("%w: tree node with a missing child", ErrCorrupt)
+		}
 		return nil, nil
 	}
+	if nodeType != 1 {
+		return nil, fmt.Errorf("%w: unknown tree node type %d", ErrCorrupt, nodeType)
+	}
+	if depth > maxTreeDepth {
+		return nil, fmt.Errorf("%w: tree deeper than %d levels", ErrCorrupt, maxTreeDepth)
+	}
 
 	var freq int32
 	if err := binary.Read(r, binary.LittleEndian, &freq); err != nil {
 		return nil, err
 	}
+	if freq < 0 {
+		return nil, fmt.Errorf("%w: tree node with frequency %d", ErrCorrupt, freq)
+	}
 
-	node := &Node{Freq: int(freq)}
+	node := &Node[byte]{Freq: int(freq)}
 
 	var isLeaf uint8
 	if err := binary.Read(r, binary.LittleEndian, &isLeaf); err != nil {
 		return nil, err
 	}
 
-	if isLeaf == 1 {
+	switch isLeaf {
+	case 1:
 		if err := binary.Read(r, binary.LittleEndian, &node.Char); err != nil {
 			return nil, err
 		}
+		if seen[node.Char] {
+			return nil, fmt.Errorf("%w: byte %d has two leaves", ErrCorrupt, node.Char)
+		}
+		seen[node.Char] = true
 		return node, nil
+	case 0:
+	default:
+		return nil, fmt.Errorf("%w: unknown tree leaf flag %d", ErrCorrupt, isLeaf)
 	}
 
-	left, err := ReadTree(r)
+	left, err := readTree(r, seen, depth+1)
 	if err != nil {
 		return nil, err
 	}
 	node.Left = left
 
-	right, err := ReadTree(r)
+	right, err := readTree(r, seen, depth+1)
 	if err != nil {
 		return nil, err
 	}
@@ -212,15 +283,21 @@ func ReadTree(r io.Reader) (*Node, error) {
 	return node, nil
 }
 
-// ReadFrequencyTable reads the character frequency table from the given reader
+// ReadFrequencyTable reads the character frequency table from the given reader. A
+// table with more than 256 entries, a byte listed twice or frequencies adding up to
+// more than the 32-bit length of a legacy file is rejected with ErrCorrupt.
 func ReadFrequencyTable(r io.Reader) (map[byte]int, error) {
 	var count uint32
 	err := binary.Read(r, binary.LittleEndian, &count)
 	if err != nil {
 		return nil, err
 	}
+	if count > 256 {
+		return nil, fmt.Errorf("%w: frequency table with %d entries", ErrCorrupt, count)
+	}
 
 	freqs := make(map[byte]int)
+	total := uint64(0)
 	for i := uint32(0); i < count; i++ {
 		var char byte
 		var freq uint32
@@ -232,104 +309,71 @@ func ReadFrequencyTable(r io.Reader) (map[byte]int, error) {
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := freqs[char]; ok {
+			return nil, fmt.Errorf("%w: byte %d listed twice in the frequency table", ErrCorrupt, char)
+		}
 		freqs[char] = int(freq)
+		total += uint64(freq)
+	}
+	if total > math.MaxUint32 {
+		return nil, fmt.Errorf("%w: frequencies add up to %d", ErrCorrupt, total)
 	}
 
 	return freqs, nil
 }
 
-// DecodeText decodes the input using the Huffman tree
-func DecodeText(input []byte, root *Node) ([]byte, error) {
-	var decoded []byte
-	node := root
-	bitIndex := 0
-	totalBits := len(input) * 8
-
-	for _, b := range input {
-		for i := 7; i >= 0; i-- {
-			if len(decoded) == root.Freq {
-				// We've decoded all expected characters
-				return decoded, nil
-			}
-
-			if bitIndex >= totalBits {
-				return nil, fmt.Errorf("unexpected end of input at bit %d", bitIndex)
-			}
-
-			bit := (b >> i) & 1
-			if bit == 0 {
-				node = node.Left
-			} else {
-				node = node.Right
-			}
-
-			if node == nil {
-				return nil, fmt.Errorf("invalid encoded data at bit %d", bitIndex)
-			}
-
-			if node.Left == nil && node.Right == nil {
-				decoded = append(decoded, node.Char)
-				node = root
-			}
-
-			bitIndex++
-		}
+// DecodeText decodes root.Freq symbols from the input using the Huffman tree. It
+// resolves several bits per step through a lookup table built from the tree.
+func DecodeText(input []byte, root *Node[byte]) ([]byte, error) {
+	if root == nil {
+		return nil, fmt.Errorf("%w: missing Huffman tree", ErrCorrupt)
 	}
-
-	// Handle any remaining bits
-	for len(decoded) < root.Freq {
-		decoded = append(decoded, ' ') // Append space for any missing characters
+	if root.Freq < 0 {
+		return nil, fmt.Errorf("%w: negative symbol count %d", ErrCorrupt, root.Freq)
 	}
-
-	return decoded, nil
+	// Unless the tree is a single leaf every code takes at least one bit, so the input
+	// is too short before anything is allocated for the output
+	if (root.Left != nil || root.Right != nil) && root.Freq > len(input)*8 {
+		return nil, fmt.Errorf("%w: %d bytes can't hold %d symbols", ErrCorrupt, len(input), root.Freq)
+	}
+	return newTableDecoder(root).decode(input, root.Freq)
 }
 
-// DecodeTextWithSteps decodes the input using the Huffman tree and returns intermediate results
-func DecodeTextWithSteps(input []byte, root *Node) ([]byte, []string, error) {
+// DecodeTextWithSteps decodes the input using the Huffman tree and returns intermediate
+// results. It keeps every step in memory; TraceText streams them instead.
+func DecodeTextWithSteps(input []byte, root *Node[byte]) ([]byte, []string, error) {
+	if root == nil {
+		return nil, nil, fmt.Errorf("%w: missing Huffman tree", ErrCorrupt)
+	}
+	// A single leaf has an empty code, so it decodes without reading any bits
+	if root.Left == nil && root.Right == nil && root.Freq > 0 {
+		return bytes.Repeat([]byte{root.Char}, root.Freq), nil, nil
+	}
+
 	var decoded []byte
 	var steps []string
-	node := root
-	bitIndex := 0
-
-	for byteIndex, b := range input {
-		for bitPosition := 0; bitPosition < 8; bitPosition++ {
-			if len(decoded) == root.Freq {
-				// We've decoded all expected characters
-				steps = append(steps, fmt.Sprintf("Decoding complete. Total decoded: %d", len(decoded)))
-				return decoded, steps, nil
-			}
-
-			bit := (b >> (7 - bitPosition)) & 1
-			steps = append(steps, fmt.Sprintf("Processing bit %d of byte %d: %d", bitPosition, byteIndex, bit))
-
-			if bit == 0 {
-				node = node.Left
-				steps = append(steps, "Moving to left child")
-			} else {
-				node = node.Right
-				steps = append(steps, "Moving to right child")
-			}
-
-			if node == nil {
-				steps = append(steps, "Invalid node reached")
-				return nil, steps, errors.New("invalid encoded data: unexpected bit sequence")
-			}
-
-			if node.Left == nil && node.Right == nil {
-				decoded = append(decoded, node.Char)
-				steps = append(steps, fmt.Sprintf("Leaf node reached. Decoded character: %c", node.Char))
-				node = root
-				steps = append(steps, "Resetting to root node")
-			}
-
-			bitIndex++
+	err := TraceText(input, root, func(e TraceEvent) error {
+		steps = append(steps, fmt.Sprintf("Processing bit %d of byte %d: %d", e.Bit%8, e.Bit/8, e.Value))
+		if e.Value == 0 {
+			steps = append(steps, "Moving to left child")
+		} else {
+			steps = append(steps, "Moving to right child")
 		}
-	}
-
-	if len(decoded) != root.Freq {
+		if e.Leaf {
+			decoded = append(decoded, e.Symbol)
+			steps = append(steps, fmt.Sprintf("Leaf node reached. Decoded character: %c", e.Symbol), "Resetting to root node")
+		}
+		return nil
+	})
+	switch {
+	case err == io.ErrUnexpectedEOF:
 		steps = append(steps, fmt.Sprintf("Decoding incomplete. Expected %d characters, got %d", root.Freq, len(decoded)))
 		return nil, steps, errors.New("unexpected end of input")
+	case err != nil:
+		steps = append(steps, "Invalid node reached")
+		return nil, steps, errors.New("invalid encoded data: unexpected bit sequence")
 	}
 
+	steps = append(steps, fmt.Sprintf("Decoding complete. Total decoded: %d", len(decoded)))
 	return decoded, steps, nil
 }
@@ -3,6 +3,7 @@ package huffman
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -100,25 +101,25 @@ func TestEncodeText(t *testing.T) {
 // Add more tests for WriteTree and WriteFrequencyTable
 
 func TestWriteTree(t *testing.T) {
-	root := &Node{
+	root := &Node[byte]{
 		Freq: 11,
-		Left: &Node{
+		Left: &Node[byte]{
 			Char: 'a',
 			Freq: 5,
 		},
-		Right: &Node{
+		Right: &Node[byte]{
 			Freq: 6,
-			Left: &Node{
+			Left: &Node[byte]{
 				Char: 'd',
 				Freq: 3,
 			},
-			Right: &Node{
+			Right: &Node[byte]{
 				Freq: 3,
-				Left: &Node{
+				Left: &Node[byte]{
 					Char: 'c',
 					Freq: 1,
 				},
-				Right: &Node{
+				Right: &Node[byte]{
 					Char: 'b',
 					Freq: 2,
 				},
@@ -261,16 +262,16 @@ func TestReadFrequencyTable(t *testing.T) {
 }
 
 func TestDecodeTextWithSteps(t *testing.T) {
-	root := &Node{
+	root := &Node[byte]{
 		Freq: 4,
-		Left: &Node{Char: 'a', Freq: 1},
-		Right: &Node{
+		Left: &Node[byte]{Char: 'a', Freq: 1},
+		Right: &Node[byte]{
 			Freq: 3,
-			Left: &Node{Char: 'b', Freq: 1},
-			Right: &Node{
+			Left: &Node[byte]{Char: 'b', Freq: 1},
+			Right: &Node[byte]{
 				Freq:  2,
-				Left:  &Node{Char: 'c', Freq: 1},
-				Right: &Node{Char: 'd', Freq: 1},
+				Left:  &Node[byte]{Char: 'c', Freq: 1},
+				Right: &Node[byte]{Char: 'd', Freq: 1},
 			},
 		},
 	}
@@ -341,16 +342,16 @@ func TestBuildAndVerifyTree(t *testing.T) {
 }
 
 func TestGenerateAndVerifyCodes(t *testing.T) {
-	root := &Node{
+	root := &Node[byte]{
 		Freq: 11,
-		Left: &Node{Char: 'a', Freq: 5},
-		Right: &Node{
+		Left: &Node[byte]{Char: 'a', Freq: 5},
+		Right: &Node[byte]{
 			Freq: 6,
-			Left: &Node{Char: 'd', Freq: 3},
-			Right: &Node{
+			Left: &Node[byte]{Char: 'd', Freq: 3},
+			Right: &Node[byte]{
 				Freq:  3,
-				Left:  &Node{Char: 'c', Freq: 1},
-				Right: &Node{Char: 'b', Freq: 2},
+				Left:  &Node[byte]{Char: 'c', Freq: 1},
+				Right: &Node[byte]{Char: 'b', Freq: 2},
 			},
 		},
 	}
@@ -375,16 +376,16 @@ func TestEncodeAndVerify(t *testing.T) {
 }
 
 func TestWriteAndReadTree(t *testing.T) {
-	root := &Node{
+	root := &Node[byte]{
 		Freq: 11,
-		Left: &Node{Char: 'a', Freq: 5},
-		Right: &Node{
+		Left: &Node[byte]{Char: 'a', Freq: 5},
+		Right: &Node[byte]{
 			Freq: 6,
-			Left: &Node{Char: 'd', Freq: 3},
-			Right: &Node{
+			Left: &Node[byte]{Char: 'd', Freq: 3},
+			Right: &Node[byte]{
 				Freq:  3,
-				Left:  &Node{Char: 'c', Freq: 1},
-				Right: &Node{Char: 'b', Freq: 2},
+				Left:  &Node[byte]{Char: 'c', Freq: 1},
+				Right: &Node[byte]{Char: 'b', Freq: 2},
 			},
 		},
 	}
@@ -405,7 +406,7 @@ func TestWriteAndReadTree(t *testing.T) {
 	}
 }
 
-func compareNodes(n1, n2 *Node) bool {
+func compareNodes(n1, n2 *Node[byte]) bool {
 	if n1 == nil && n2 == nil {
 		return true
 	}
@@ -444,3 +445,127 @@ func TestFullEncodeDecode(t *testing.T) {
 		t.Errorf("Decoded output doesn't match input. Got %s, want %s", decoded, input)
 	}
 }
+
+func TestDecodeTextShortInput(t *testing.T) {
+	root := BuildHuffmanTree(map[byte]int{'a': 5, 'b': 2, 'c': 1, 'd': 3})
+	codes := GenerateHuffmanCodes(root)
+	encoded := EncodeText([]byte("abcdabcd"), codes)
+
+	root.Freq = 100
+	if _, err := DecodeText(encoded, root); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+	}
+}
+
+func TestReadTreeRejectsMalformedTrees(t *testing.T) {
+	leaf := func(c byte) []byte { return []byte{1, 1, 0, 0, 0, 1, c} }
+	internal := []byte{1, 2, 0, 0, 0, 0}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := map[string][]byte{
+		"Missing child":      join(internal, leaf('a'), []byte{0}),
+		"Duplicate leaf":     join(internal, leaf('a'), leaf('a')),
+		"Negative frequency": join([]byte{1, 0, 0, 0, 0x80, 1, 'a'}),
+		"Unknown node type":  join([]byte{2}, leaf('a')),
+		"Unknown leaf flag":  join([]byte{1, 1, 0, 0, 0, 2, 'a'}),
+		"Too deep":           join(bytes.Repeat(internal, maxTreeDepth+1), leaf('a'), leaf('b')),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadTree(bytes.NewReader(data)); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+			}
+		})
+	}
+}
+
+func TestReadTreeDeepestTree(t *testing.T) {
+	// A tree over every byte with one leaf per level is as deep as a tree can be
+	root := &Node[byte]{Char: 255}
+	for c := 254; c >= 0; c-- {
+		root = &Node[byte]{Left: &Node[byte]{Char: byte(c)}, Right: root}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTree(root, &buf); err != nil {
+		t.Fatalf("WriteTree returned an error: %v", err)
+	}
+	if _, err := ReadTree(&buf); err != nil {
+		t.Errorf("ReadTree rejected a tree %d levels deep: %v", maxTreeDepth, err)
+	}
+}
+
+func TestReadFrequencyTableRejectsMalformedTables(t *testing.T) {
+	entry := func(c byte, freq uint32) []byte {
+		return append([]byte{c}, binary.LittleEndian.AppendUint32(nil, freq)...)
+	}
+	table := func(count uint32, entries ...[]byte) []byte {
+		return append(binary.LittleEndian.AppendUint32(nil, count), bytes.Join(entries, nil)...)
+	}
+
+	tests := map[string][]byte{
+		"Too many entries": table(257),
+		"Duplicate byte":   table(2, entry('a', 1), entry('a', 2)),
+		"Total overflows":  table(2, entry('a', 1<<31), entry('b', 1<<31)),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadFrequencyTable(bytes.NewReader(data)); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Expected %v, got %v", ErrCorrupt, err)
+			}
+		})
+	}
+}
+
+func TestDecodeTextRejectsImpossibleCounts(t *testing.T) {
+	root := BuildHuffmanTree(map[byte]int{'a': 1, 'b': 1})
+
+	for _, n := range []int{-1, 1 << 40} {
+		root.Freq = n
+		if _, err := DecodeText([]byte{0}, root); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Expected %v for %d symbols, got %v", ErrCorrupt, n, err)
+		}
+	}
+}
+
+func TestBuildHuffmanTreeBreaksTiesBySymbol(t *testing.T) {
+	// a and b are combined first, then c and d; e ties with nothing, and of the two
+	// internal nodes of frequency 2 the older one is combined with it
+	freqs := map[byte]int{'a': 1, 'b': 1, 'c': 1, 'd': 1, 'e': 1}
+	expected := HuffmanCode{'a': "110", 'b': "111", 'c': "00", 'd': "01", 'e': "10"}
+
+	for i := 0; i < 50; i++ {
+		// A fresh map every time, so that map iteration order varies
+		copied := make(map[byte]int)
+		for c, freq := range freqs {
+			copied[c] = freq
+		}
+		if codes := GenerateHuffmanCodes(BuildHuffmanTree(copied)); !reflect.DeepEqual(codes, expected) {
+			t.Fatalf("Run %d: expected codes %v, got %v", i, expected, codes)
+		}
+	}
+}
+
+func TestWriteFrequencyTableIsSorted(t *testing.T) {
+	freqs := map[byte]int{'d': 3, 'a': 5, 0xff: 1, 'c': 1, 0: 2}
+	expected := []byte{
+		5, 0, 0, 0,
+		0, 2, 0, 0, 0,
+		'a', 5, 0, 0, 0,
+		'c', 1, 0, 0, 0,
+		'd', 3, 0, 0, 0,
+		0xff, 1, 0, 0, 0,
+	}
+
+	for i := 0; i < 50; i++ {
+		var buf bytes.Buffer
+		if err := WriteFrequencyTable(freqs, &buf); err != nil {
+			t.Fatalf("WriteFrequencyTable returned an error: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("Run %d: expected table %v, got %v", i, expected, buf.Bytes())
+		}
+	}
+}